@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/crdant/replicated-license-enforcer/pkg/enforce"
+)
+
+// A command the enforcer can run, each with its own flags and help
+type command struct {
+	name        string
+	summary     string
+	description string
+	flags       func(flags *flag.FlagSet)
+	run         func(flags *flag.FlagSet)
+}
+
+var commands = []*command{
+	{
+		name:    "check",
+		summary: "Check the license once and exit, for init containers",
+		description: `Checks the license once and exits. The exit code says why the check
+failed, and a summary is written to the termination message. Retries for
+a while if the Replicated SDK isn't reachable yet.`,
+		flags: func(flags *flag.FlagSet) {
+			enforcementFlags(flags)
+			kubernetesFlags(flags)
+		},
+		run: runCheck,
+	},
+	{
+		name:    "monitor",
+		summary: "Check the license and keep checking it, for sidecars",
+		description: `Checks the license, exiting if it isn't valid, then keeps checking it on
+an interval until the enforcer is stopped. Actions set with --on-invalid
+run when the license becomes invalid. Changes to the rules and the
+interval in the --config file are applied without a restart.`,
+		flags: func(flags *flag.FlagSet) {
+			flags.DurationVar(&recheckInterval, "interval", time.Hour, "How often to check the license")
+			flags.StringVar(&schedule, "schedule", "", "Check the license on this cron schedule instead of an interval, e.g. '5 0 * * *'")
+			flags.StringVar(&timezone, "timezone", "", "Timezone for the cron schedule, e.g. UTC or America/New_York, defaults to local time")
+			flags.BoolVar(&checkAtExpiration, "check-at-expiration", false, "Also check the license at the moment it expires")
+			flags.BoolVar(&adaptive, "adaptive", false, "Check the license more often as it gets closer to expiring instead of on an interval")
+			flags.DurationVar(&minInterval, "min-interval", enforce.DefaultAdaptiveMin, "The shortest time between adaptive checks")
+			flags.DurationVar(&maxInterval, "max-interval", enforce.DefaultAdaptiveMax, "The longest time between adaptive checks")
+			flags.StringVar(&listenAddress, "listen", "", "Serve /healthz, /readyz, /license and /metrics on this address, e.g. :8080")
+			enforcementFlags(flags)
+			kubernetesFlags(flags)
+		},
+		run: runMonitor,
+	},
+	{
+		name:    "inspect",
+		summary: "Print the license and the verification status of every field",
+		description: `Prints the application, the license, and every field in the license with
+whether its signature could be verified. Problems with the license are
+printed rather than failing the command.`,
+		flags: licenseFlags,
+		run:   runInspect,
+	},
+	{
+		name:    "verify",
+		summary: "Verify a signed license file offline",
+		description: `Verifies the signature on a license file without the Replicated SDK or a
+Kubernetes cluster, and checks that the license hasn't expired. Exits
+with the same codes as check.`,
+		flags: func(flags *flag.FlagSet) {
+			flags.StringVar(&licenseFile, "file", "", "The signed license file to verify")
+			flags.StringVar(&publicKeys, "public-keys", "", "Also trust the PEM encoded public keys in this file to sign the license")
+			flags.BoolVar(&rejectLegacy, "reject-legacy-signatures", false, "Reject license fields that are only signed with the legacy MD5 scheme")
+			flags.StringVar(&expirationTimezone, "expiration-timezone", "", "Timezone for expiration dates without a time, e.g. America/New_York, defaults to UTC")
+		},
+		run: runVerify,
+	},
+}
+
+// adds the flags the Kubernetes client libraries register globally, like
+// --kubeconfig, so commands that talk to the cluster accept them too
+func kubernetesFlags(flags *flag.FlagSet) {
+	flag.CommandLine.VisitAll(func(global *flag.Flag) {
+		if flags.Lookup(global.Name) == nil {
+			flags.Var(global.Value, global.Name, global.Usage)
+		}
+	})
+}
+
+// returns the command with the name, or nil if there isn't one
+func findCommand(name string) *command {
+	for _, command := range commands {
+		if command.name == name {
+			return command
+		}
+	}
+	return nil
+}
+
+func (c *command) flagSet() *flag.FlagSet {
+	flags := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	c.flags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: enforcer %s [flags]\n\n%s\n\nFlags:\n", c.name, c.description)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parses the flags for the command, exiting if they aren't valid
+func (c *command) parse(args []string) *flag.FlagSet {
+	flags := c.flagSet()
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(exitOK)
+	}
+	if err != nil {
+		os.Exit(exitConfiguration)
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(flags.Output(), "Unexpected arguments: %v\n", flags.Args())
+		flags.Usage()
+		os.Exit(exitConfiguration)
+	}
+	return flags
+}
+
+func usage() {
+	output := flag.CommandLine.Output()
+	fmt.Fprintf(output, "Usage: enforcer <command> [flags]\n\nCommands:\n")
+	for _, command := range commands {
+		fmt.Fprintf(output, "  %-10s%s\n", command.name, command.summary)
+	}
+	fmt.Fprintf(output, "\nRun 'enforcer <command> -h' for the flags for each command.\n")
+	fmt.Fprintf(output, "\nWithout a command the enforcer checks the license and keeps running, use\n--recheck to check it periodically. These flags are supported:\n")
+	flag.PrintDefaults()
+}
+
+func runCheck(flags *flag.FlagSet) {
+	settings := resolveConfig(flags)
+	logVersion()
+	ctx, stop := signalContext()
+	defer stop()
+	enforceLicense(ctx, settings)
+}
+
+func runMonitor(flags *flag.FlagSet) {
+	settings := resolveConfig(flags)
+	if interval := settings.Recheck.Interval.Duration(); settings.Recheck.Schedule == "" && !settings.Recheck.Adaptive && interval <= 0 {
+		failConfiguration("Error configuring license monitoring", fmt.Errorf("interval must be positive, got %v", interval))
+	}
+	logVersion()
+	ctx, stop := signalContext()
+	defer stop()
+	enforcer := enforceLicense(ctx, settings)
+	if err := scheduleChecks(enforcer, settings.Recheck); err != nil {
+		failConfiguration("Error scheduling license checks", err)
+	}
+	if configFile != "" {
+		go watchConfig(ctx, flags, enforcer, settings)
+	}
+	runEnforcer(ctx, enforcer)
+}
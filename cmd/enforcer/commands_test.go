@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFindCommand(t *testing.T) {
+	for _, name := range []string{"check", "monitor", "inspect", "verify"} {
+		if command := findCommand(name); command == nil || command.name != name {
+			t.Errorf("Expected to find command %s, got %v", name, command)
+		}
+	}
+	if command := findCommand("recheck"); command != nil {
+		t.Errorf("Expected no command named recheck, got %v", command.name)
+	}
+}
+
+func TestMonitorFlags(t *testing.T) {
+	flags := findCommand("monitor").flagSet()
+	err := flags.Parse([]string{"-interval=15m", "-listen=:8080", "-grace-period=24h", "-rule=license.fields.is_enterprise"})
+	if err != nil {
+		t.Fatalf("Expected monitor flags to parse, got %v", err)
+	}
+
+	if recheckInterval != 15*time.Minute {
+		t.Errorf("Expected interval of %v, got %v", 15*time.Minute, recheckInterval)
+	}
+	if listenAddress != ":8080" {
+		t.Errorf("Expected listen address :8080, got %v", listenAddress)
+	}
+	if gracePeriod != 24*time.Hour {
+		t.Errorf("Expected grace period of %v, got %v", 24*time.Hour, gracePeriod)
+	}
+}
+
+func TestCheckFlags(t *testing.T) {
+	flags := findCommand("check").flagSet()
+	if err := flags.Parse([]string{"-license-file=/etc/replicated/license.yaml"}); err != nil {
+		t.Fatalf("Expected check flags to parse, got %v", err)
+	}
+	if licenseFile != "/etc/replicated/license.yaml" {
+		t.Errorf("Expected license file /etc/replicated/license.yaml, got %v", licenseFile)
+	}
+
+	// checking once doesn't serve anything or recheck
+	for _, name := range []string{"listen", "interval", "recheck"} {
+		if flags.Lookup(name) != nil {
+			t.Errorf("Expected check not to have a %s flag", name)
+		}
+	}
+}
+
+func TestVerifyFlags(t *testing.T) {
+	flags := findCommand("verify").flagSet()
+	if err := flags.Parse([]string{"-file=license.yaml", "-reject-legacy-signatures"}); err != nil {
+		t.Fatalf("Expected verify flags to parse, got %v", err)
+	}
+	if licenseFile != "license.yaml" || !rejectLegacy {
+		t.Errorf("Expected license.yaml rejecting legacy signatures, got %v %v", licenseFile, rejectLegacy)
+	}
+	rejectLegacy = false
+
+	if err := findCommand("verify").flagSet().Parse([]string{"-rule=true"}); err == nil {
+		t.Errorf("Expected verify to reject enforcement flags")
+	}
+}
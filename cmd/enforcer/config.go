@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/crdant/replicated-license-enforcer/pkg/config"
+	"github.com/crdant/replicated-license-enforcer/pkg/enforce"
+)
+
+var configFile string
+
+// how often to look for changes to the configuration file, Kubernetes takes
+// about a minute to update a mounted ConfigMap so there's no need to be faster
+const configPollInterval = 10 * time.Second
+
+func configFlags(flags *flag.FlagSet) {
+	flags.StringVar(&configFile, "config", os.Getenv("ENFORCER_CONFIG"), "Read settings from this YAML configuration file, environment variables and flags override it")
+}
+
+// resolves the settings for the enforcer, starting with the configuration
+// file, then the environment, then the flags that were set on the command
+// line, exiting if the result isn't valid
+func resolveConfig(flags *flag.FlagSet) *config.Config {
+	settings := config.Default()
+	if configFile != "" {
+		loaded, err := config.Load(configFile)
+		if err != nil {
+			failConfiguration("Error loading configuration", err)
+		}
+		settings = loaded
+	}
+	if err := overrideConfig(flags, settings); err != nil {
+		failConfiguration("Invalid configuration", err)
+	}
+
+	if settings.LogLevel != "" {
+		level, _ := log.ParseLevel(settings.LogLevel)
+		log.SetLevel(level)
+	}
+	// events are recorded against the pod named in the environment
+	for name, value := range map[string]string{
+		"POD_NAME":      settings.Events.Pod.Name,
+		"POD_NAMESPACE": settings.Events.Pod.Namespace,
+		"POD_UID":       settings.Events.Pod.UID,
+	} {
+		if value != "" {
+			os.Setenv(name, value)
+		}
+	}
+	return settings
+}
+
+// overrides the settings from the configuration file with the environment
+// and the flags that were set on the command line, then validates them
+func overrideConfig(flags *flag.FlagSet, settings *config.Config) error {
+	settings.ApplyEnvironment()
+
+	overrides := map[string]func(){
+		"grace-period": func() { settings.GracePeriod = config.Duration(gracePeriod) },
+		"warn-before": func() {
+			settings.Events.WarnBefore = nil
+			for _, threshold := range warnBefore {
+				settings.Events.WarnBefore = append(settings.Events.WarnBefore, config.Duration(threshold))
+			}
+		},
+		"rule":                     func() { settings.Rules = rules },
+		"on-invalid":               func() { settings.Actions = onInvalid },
+		"license-file":             func() { settings.License.File = licenseFile },
+		"public-keys":              func() { settings.License.PublicKeys = publicKeys },
+		"reject-legacy-signatures": func() { settings.License.RejectLegacySignatures = rejectLegacy },
+		"expiration-timezone":      func() { settings.License.ExpirationTimezone = expirationTimezone },
+		"listen":                   func() { settings.Listen = listenAddress },
+		"retry-initial-interval":   func() { settings.Retry.InitialInterval = config.Duration(retryInitialInterval) },
+		"retry-max-interval":       func() { settings.Retry.MaxInterval = config.Duration(retryMaxInterval) },
+		"retry-max-elapsed-time":   func() { settings.Retry.MaxElapsedTime = config.Duration(retryMaxElapsedTime) },
+		"retry-jitter":             func() { settings.Retry.Jitter = &retryJitter },
+		"retry-max-attempts":       func() { settings.Retry.MaxAttempts = retryMaxAttempts },
+		"outage-policy":            func() { settings.Outage.Policy = outagePolicy },
+		"outage-max-age":           func() { settings.Outage.MaxAge = config.Duration(outageMaxAge) },
+		"outage-snapshot":          func() { settings.Outage.Snapshot = outageSnapshot },
+		"recheck":                  func() { settings.Recheck.Interval, settings.Recheck.Schedule, settings.Recheck.Adaptive = config.Duration(recheckInterval), "", false },
+		"interval":                 func() { settings.Recheck.Interval, settings.Recheck.Schedule, settings.Recheck.Adaptive = config.Duration(recheckInterval), "", false },
+		"schedule":                 func() { settings.Recheck.Interval, settings.Recheck.Schedule, settings.Recheck.Adaptive = 0, schedule, false },
+		"adaptive":                 func() { settings.Recheck.Interval, settings.Recheck.Schedule, settings.Recheck.Adaptive = 0, "", adaptive },
+		"min-interval":             func() { settings.Recheck.MinInterval = config.Duration(minInterval) },
+		"max-interval":             func() { settings.Recheck.MaxInterval = config.Duration(maxInterval) },
+		"timezone":                 func() { settings.Recheck.Timezone = timezone },
+		"check-at-expiration":      func() { settings.Recheck.AtExpiration = checkAtExpiration },
+	}
+	flags.Visit(func(set *flag.Flag) {
+		if override, ok := overrides[set.Name]; ok {
+			override()
+		}
+	})
+	// monitor checks hourly unless it's told otherwise
+	if settings.Recheck.Interval == 0 && settings.Recheck.Schedule == "" && !settings.Recheck.Adaptive {
+		settings.Recheck.Interval = config.Duration(recheckInterval)
+	}
+
+	return settings.Validate()
+}
+
+// watches the configuration file and applies the rules and recheck schedule
+// from it when it changes, a new configuration that isn't valid is rejected
+// with an event and the current one stays in place
+func watchConfig(ctx context.Context, flags *flag.FlagSet, enforcer *enforce.Enforcer, settings *config.Config) {
+	log.Info("Watching configuration for changes", "path", configFile)
+	config.NewWatcher(configFile, configPollInterval).Watch(ctx, func(loaded *config.Config, err error) {
+		if err == nil {
+			err = overrideConfig(flags, loaded)
+		}
+		if err == nil {
+			err = reconfigure(enforcer, settings, loaded)
+		}
+		if err != nil {
+			enforcer.RejectConfiguration(ctx, err)
+			return
+		}
+		settings = loaded
+	})
+}
+
+// applies the rules and recheck schedule from the new settings, the other
+// settings only take effect when the enforcer restarts. The new settings are
+// applied together or not at all, so the schedule is put back if the new
+// rules can't be applied.
+func reconfigure(enforcer *enforce.Enforcer, current *config.Config, next *config.Config) error {
+	interval := next.Recheck.Interval.Duration()
+	if next.Recheck.Schedule == "" && !next.Recheck.Adaptive && interval <= 0 {
+		return fmt.Errorf("recheck.interval: must be positive, got %v", interval)
+	}
+
+	// the timezone and the check at expiration need a restart
+	rescheduled := next.Recheck
+	rescheduled.Timezone, rescheduled.AtExpiration = current.Recheck.Timezone, current.Recheck.AtExpiration
+	if rescheduled != current.Recheck {
+		if err := scheduleChecks(enforcer, next.Recheck); err != nil {
+			return err
+		}
+	}
+
+	if !slices.Equal(current.Rules, next.Rules) {
+		if err := replaceRules(enforcer, next.Rules); err != nil {
+			if rescheduled != current.Recheck {
+				// the current schedule was applied before, so it can be again
+				if restoreErr := scheduleChecks(enforcer, current.Recheck); restoreErr != nil {
+					log.Error("Error restoring the recheck schedule", "error", restoreErr)
+				}
+			}
+			return err
+		}
+		log.Info("Applied new license rules", "rules", next.Rules)
+	}
+	if rescheduled != current.Recheck {
+		log.Info("Rescheduled license checks", "schedule", next.Recheck.Schedule, "interval", interval, "adaptive", next.Recheck.Adaptive)
+	}
+
+	unchanged := *next
+	unchanged.Rules = current.Rules
+	unchanged.Recheck = current.Recheck
+	unchanged.Recheck.Timezone, unchanged.Recheck.AtExpiration = next.Recheck.Timezone, next.Recheck.AtExpiration
+	if !reflect.DeepEqual(&unchanged, current) {
+		log.Warn("Only rules and the recheck interval are applied while the enforcer is running, restart it to apply the other changes")
+	}
+	return nil
+}
+
+// compiles the rules against the license and replaces the current ones with
+// them, the current rules stay in place if any of them is invalid
+func replaceRules(enforcer *enforce.Enforcer, rules []string) error {
+	var facts enforce.Facts
+	if len(rules) > 0 {
+		var err error
+		facts, err = enforce.DefaultFacts()
+		if err != nil {
+			return err
+		}
+	}
+	return enforcer.ReplaceExpressions(facts, rules...)
+}
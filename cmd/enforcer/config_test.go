@@ -0,0 +1,207 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/crdant/replicated-license-enforcer/pkg/client"
+	"github.com/crdant/replicated-license-enforcer/pkg/config"
+	"github.com/crdant/replicated-license-enforcer/pkg/enforce"
+	"github.com/crdant/replicated-license-enforcer/pkg/events"
+)
+
+func writeConfig(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "enforcer.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("Expected to write configuration, got %v", err)
+	}
+	return path
+}
+
+func TestResolveConfigPrecedence(t *testing.T) {
+	t.Setenv("REPLICATED_SDK_ENDPOINT", "http://sdk.example.com:3000")
+	t.Setenv("POD_NAME", "")
+	path := writeConfig(t, `
+version: 1
+sdk:
+  endpoint: http://replicated:3000
+recheck:
+  interval: 4h
+gracePeriod: 7d
+events:
+  pod:
+    name: slackernews-0
+listen: :9090
+`)
+
+	flags := findCommand("monitor").flagSet()
+	if err := flags.Parse([]string{"-config=" + path, "-grace-period=24h"}); err != nil {
+		t.Fatalf("Expected monitor flags to parse, got %v", err)
+	}
+	settings := resolveConfig(flags)
+
+	if settings.GracePeriod.Duration() != 24*time.Hour {
+		t.Errorf("Expected the flag to override the grace period, got %v", settings.GracePeriod)
+	}
+	if settings.SDK.Endpoint != "http://sdk.example.com:3000" {
+		t.Errorf("Expected the environment to override the endpoint, got %v", settings.SDK.Endpoint)
+	}
+	if settings.Recheck.Interval.Duration() != 4*time.Hour {
+		t.Errorf("Expected the interval from the file over the flag default, got %v", settings.Recheck.Interval)
+	}
+	if settings.Listen != ":9090" {
+		t.Errorf("Expected the listen address from the file, got %v", settings.Listen)
+	}
+	if os.Getenv("POD_NAME") != "slackernews-0" {
+		t.Errorf("Expected the pod name from the file in the environment, got %v", os.Getenv("POD_NAME"))
+	}
+}
+
+func TestResolveConfigWithoutFile(t *testing.T) {
+	t.Setenv("ENFORCER_CONFIG", "")
+	flags := findCommand("monitor").flagSet()
+	if err := flags.Parse([]string{"-listen=:8080"}); err != nil {
+		t.Fatalf("Expected monitor flags to parse, got %v", err)
+	}
+	settings := resolveConfig(flags)
+
+	if settings.Recheck.Interval.Duration() != time.Hour {
+		t.Errorf("Expected monitor to default to checking hourly, got %v", settings.Recheck.Interval)
+	}
+	if settings.Listen != ":8080" {
+		t.Errorf("Expected the listen address from the flag, got %v", settings.Listen)
+	}
+}
+
+func TestConfigFlagFromEnvironment(t *testing.T) {
+	t.Setenv("ENFORCER_CONFIG", "/etc/enforcer/config.yaml")
+	flags := findCommand("check").flagSet()
+	if err := flags.Parse(nil); err != nil {
+		t.Fatalf("Expected check flags to parse, got %v", err)
+	}
+	if configFile != "/etc/enforcer/config.yaml" {
+		t.Errorf("Expected the configuration file from the environment, got %v", configFile)
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	sdkClient := client.NewMockAPIClient("Slackernews", "slackernews-mackerel", time.Now().Add(24*time.Hour))
+	enforcer := enforce.NewEnforcer(sdkClient, events.NewMockEventClient(), enforce.WithExpressions(nil, "license.appSlug == 'other'"))
+	if _, err := enforcer.Check(); err == nil {
+		t.Fatalf("Expected the license to fail the rule")
+	}
+
+	current := &config.Config{Version: 1, Rules: []string{"license.appSlug == 'other'"}, Recheck: config.Recheck{Interval: config.Duration(time.Hour)}}
+	next := &config.Config{Version: 1, Recheck: config.Recheck{Interval: config.Duration(4 * time.Hour)}}
+	if err := reconfigure(enforcer, current, next); err != nil {
+		t.Fatalf("Expected the new configuration to apply, got %v", err)
+	}
+	if _, err := enforcer.Check(); err != nil {
+		t.Errorf("Expected the rule to be removed, got %v", err)
+	}
+
+	next.Recheck.Interval = 0
+	if err := reconfigure(enforcer, current, next); err == nil {
+		t.Errorf("Expected a configuration without an interval to be rejected")
+	}
+}
+
+func TestReconfigureAppliesNothingWhenScheduleIsInvalid(t *testing.T) {
+	sdkClient := client.NewMockAPIClient("Slackernews", "slackernews-mackerel", time.Now().Add(24*time.Hour))
+	enforcer := enforce.NewEnforcer(sdkClient, events.NewMockEventClient(), enforce.WithExpressions(nil, "license.appSlug == 'other'"))
+	if _, err := enforcer.Check(); err == nil {
+		t.Fatalf("Expected the license to fail the rule")
+	}
+
+	current := &config.Config{Version: 1, Rules: []string{"license.appSlug == 'other'"}, Recheck: config.Recheck{Interval: config.Duration(time.Hour)}}
+	next := &config.Config{Version: 1, Recheck: config.Recheck{Schedule: "5 0 * *"}}
+	if err := reconfigure(enforcer, current, next); err == nil {
+		t.Fatalf("Expected a configuration with an invalid schedule to be rejected")
+	}
+	if _, err := enforcer.Check(); err == nil {
+		t.Errorf("Expected the current rules to stay in place")
+	}
+}
+
+func TestResolveConfigSchedule(t *testing.T) {
+	path := writeConfig(t, "version: 1\nrecheck:\n  schedule: 5 0 * * *\n  timezone: UTC\n")
+
+	flags := findCommand("monitor").flagSet()
+	if err := flags.Parse([]string{"-config=" + path}); err != nil {
+		t.Fatalf("Expected monitor flags to parse, got %v", err)
+	}
+	settings := resolveConfig(flags)
+	if settings.Recheck.Schedule != "5 0 * * *" || settings.Recheck.Interval != 0 {
+		t.Errorf("Expected the schedule from the file without the default interval, got %+v", settings.Recheck)
+	}
+
+	flags = findCommand("monitor").flagSet()
+	if err := flags.Parse([]string{"-config=" + path, "-interval=30m", "-check-at-expiration"}); err != nil {
+		t.Fatalf("Expected monitor flags to parse, got %v", err)
+	}
+	settings = resolveConfig(flags)
+	if settings.Recheck.Schedule != "" || settings.Recheck.Interval.Duration() != 30*time.Minute {
+		t.Errorf("Expected the interval flag to replace the schedule, got %+v", settings.Recheck)
+	}
+	if settings.Recheck.Timezone != "UTC" || !settings.Recheck.AtExpiration {
+		t.Errorf("Expected the timezone from the file and the expiration check from the flag, got %+v", settings.Recheck)
+	}
+}
+
+func TestResolveConfigAdaptive(t *testing.T) {
+	path := writeConfig(t, "version: 1\nrecheck:\n  interval: 4h\n")
+
+	flags := findCommand("monitor").flagSet()
+	if err := flags.Parse([]string{"-config=" + path, "-adaptive", "-max-interval=6h"}); err != nil {
+		t.Fatalf("Expected monitor flags to parse, got %v", err)
+	}
+	settings := resolveConfig(flags)
+	if !settings.Recheck.Adaptive || settings.Recheck.Interval != 0 {
+		t.Errorf("Expected the adaptive flag to replace the interval, got %+v", settings.Recheck)
+	}
+	if minInterval, maxInterval := settings.Recheck.AdaptiveBounds(); minInterval != time.Minute || maxInterval != 6*time.Hour {
+		t.Errorf("Expected adaptive checks between 1m and 6h, got %v and %v", minInterval, maxInterval)
+	}
+}
+
+func TestResolveConfigRetry(t *testing.T) {
+	path := writeConfig(t, "version: 1\nretry:\n  maxElapsedTime: 5m\n  jitter: 0.2\n")
+
+	flags := findCommand("check").flagSet()
+	if err := flags.Parse([]string{"-config=" + path, "-retry-jitter=0", "-retry-max-attempts=3"}); err != nil {
+		t.Fatalf("Expected check flags to parse, got %v", err)
+	}
+	policy := resolveConfig(flags).Retry.Policy()
+	expected := enforce.RetryPolicy{MaxElapsedTime: 5 * time.Minute, Jitter: enforce.NoJitter, MaxAttempts: 3}
+	if policy != expected {
+		t.Errorf("Expected retry policy %+v, got %+v", expected, policy)
+	}
+}
+
+func TestResolveConfigOutage(t *testing.T) {
+	path := writeConfig(t, "version: 1\noutage:\n  policy: fail-open\n  snapshot: /var/lib/enforcer/license.json\n")
+
+	flags := findCommand("check").flagSet()
+	if err := flags.Parse([]string{"-config=" + path, "-outage-max-age=2h"}); err != nil {
+		t.Fatalf("Expected check flags to parse, got %v", err)
+	}
+	outage := resolveConfig(flags).Outage
+	expected := config.Outage{Policy: "fail-open", MaxAge: config.Duration(2 * time.Hour), Snapshot: "/var/lib/enforcer/license.json"}
+	if outage != expected {
+		t.Errorf("Expected outage policy %+v, got %+v", expected, outage)
+	}
+}
+
+func TestOverrideConfigRejectsLegacyWithLicenseFile(t *testing.T) {
+	t.Setenv("REPLICATED_LICENSE_FILE", "")
+	flags := findCommand("check").flagSet()
+	if err := flags.Parse([]string{"-license-file=/etc/license/license.yaml", "-reject-legacy-signatures"}); err != nil {
+		t.Fatalf("Expected check flags to parse, got %v", err)
+	}
+	defer func() { rejectLegacy, licenseFile = false, "" }()
+	if err := overrideConfig(flags, config.Default()); err == nil {
+		t.Errorf("Expected a license file that rejects legacy signatures to be invalid")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/log"
+	"github.com/crdant/replicated-license-enforcer/pkg/client"
+	"github.com/crdant/replicated-license-enforcer/pkg/enforce"
+)
+
+// Exit codes for each class of failure, so pod status and alerts can tell an
+// expired license from an SDK that isn't up yet
+const (
+	exitOK            = 0
+	exitError         = 1 // anything not covered below
+	exitConfiguration = 2 // invalid flags, keys, actions, or rules
+	exitExpired       = 3 // the license is expired
+	exitPolicy        = 4 // the license doesn't satisfy a rule or can't be read
+	exitUntrusted     = 5 // bad or missing signature, or the license was tampered with
+	exitUnavailable   = 6 // the Replicated SDK couldn't be reached
+)
+
+// Kubernetes truncates termination messages longer than this
+const maxTerminationMessage = 4096
+
+// Summary of why the enforcer stopped, written to the container's
+// `terminationMessagePath` so `kubectl describe pod` shows it
+type terminationMessage struct {
+	Reason      string     `json:"reason"`
+	ExitCode    int        `json:"exitCode"`
+	Message     string     `json:"message"`
+	Application string     `json:"application,omitempty"`
+	Expiration  *time.Time `json:"expiration,omitempty"`
+	Field       string     `json:"field,omitempty"`
+	FailedRules []string   `json:"failedRules,omitempty"`
+}
+
+// the exit code for each class of error from checking the license
+var exitCodes = map[string]int{
+	enforce.ClassExpired:            exitExpired,
+	enforce.ClassInvalidRule:        exitConfiguration,
+	enforce.ClassPolicyNotSatisfied: exitPolicy,
+	enforce.ClassTampered:           exitUntrusted,
+	enforce.ClassSignatureInvalid:   exitUntrusted,
+	enforce.ClassFieldNotFound:      exitPolicy,
+	enforce.ClassInvalidExpiration:  exitPolicy,
+	enforce.ClassSDKUnavailable:     exitUnavailable,
+}
+
+// returns the exit code and reason for an error from checking the license
+func classify(err error) (int, string) {
+	class := enforce.ErrorClass(err)
+	code, ok := exitCodes[class]
+	if !ok {
+		return exitError, enforce.ClassError
+	}
+	return code, class
+}
+
+// describes an error from checking the license with whatever details it has
+func summarize(code int, reason string, err error) terminationMessage {
+	summary := terminationMessage{Reason: reason, ExitCode: code, Message: err.Error()}
+
+	var expired *enforce.ExpiredError
+	if errors.As(err, &expired) {
+		summary.Application = expired.Application
+		summary.Expiration = &expired.Expiration
+	}
+	var fieldErr *client.FieldError
+	if errors.As(err, &fieldErr) {
+		summary.Field = fieldErr.Field
+	}
+	var policyErr *enforce.PolicyError
+	if errors.As(err, &policyErr) {
+		for _, failure := range policyErr.Result.Failures() {
+			summary.FailedRules = append(summary.FailedRules, failure.Rule)
+		}
+	}
+	return summary
+}
+
+// writes the summary as JSON, shortening the message if it won't fit
+func writeTerminationMessage(path string, summary terminationMessage) error {
+	message, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	if over := len(message) - maxTerminationMessage; over > 0 && over < len(summary.Message) {
+		summary.Message = summary.Message[:len(summary.Message)-over]
+		for !utf8.ValidString(summary.Message) {
+			summary.Message = summary.Message[:len(summary.Message)-1]
+		}
+		if message, err = json.Marshal(summary); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, message, 0644)
+}
+
+// logs the error, records why the enforcer stopped, and exits with the code
+// for the class of failure
+func fail(message string, err error) {
+	code, reason := classify(err)
+	exit(message, code, reason, err)
+}
+
+// the same as fail for errors in how the enforcer was configured
+func failConfiguration(message string, err error) {
+	exit(message, exitConfiguration, "InvalidConfiguration", err)
+}
+
+func exit(message string, code int, reason string, err error) {
+	log.Error(message, "error", err, "reason", reason, "code", code)
+	if terminationMessagePath != "" {
+		if err := writeTerminationMessage(terminationMessagePath, summarize(code, reason, err)); err != nil {
+			log.Debug("Could not write termination message", "path", terminationMessagePath, "error", err)
+		}
+	}
+	os.Exit(code)
+}
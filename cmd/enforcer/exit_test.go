@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crdant/replicated-license-enforcer/pkg/client"
+	"github.com/crdant/replicated-license-enforcer/pkg/enforce"
+)
+
+func TestClassify(t *testing.T) {
+	policyErr := &enforce.PolicyError{Result: &enforce.PolicyResult{Results: []enforce.RuleResult{
+		{Rule: "is_enterprise is true", Error: &client.FieldError{Field: "is_enterprise", Err: client.ErrFieldNotFound}},
+	}}}
+	tests := []struct {
+		err    error
+		code   int
+		reason string
+	}{
+		{&enforce.ExpiredError{Application: "Slackernews"}, exitExpired, "LicenseExpired"},
+		{fmt.Errorf("Error in license check: %w", &enforce.ExpiredError{Application: "Slackernews"}), exitExpired, "LicenseExpired"},
+		{policyErr, exitPolicy, "PolicyNotSatisfied"},
+		{&enforce.ExpressionError{Expression: "license.fields.seats >", Err: errors.New("syntax error")}, exitConfiguration, "InvalidRule"},
+		{&client.TamperedError{Field: "licenseType", Reason: "does not match the signed license"}, exitUntrusted, "LicenseTampered"},
+		{&client.FieldError{Field: "expires_at", Err: client.ErrSignatureInvalid}, exitUntrusted, "SignatureInvalid"},
+		{client.ErrSignatureMissing, exitUntrusted, "SignatureInvalid"},
+		{&client.FieldError{Field: "expires_at", Err: client.ErrFieldNotFound}, exitPolicy, "FieldNotFound"},
+		{&client.FieldError{Field: "expires_at", Err: &client.ExpirationError{Value: "someday"}}, exitPolicy, "InvalidExpiration"},
+		{&client.RequestError{URL: "/api/v1/app/info", Err: errors.New("connection refused")}, exitUnavailable, "SDKUnavailable"},
+		{errors.New("something else"), exitError, "Error"},
+	}
+
+	for _, test := range tests {
+		code, reason := classify(test.err)
+		if code != test.code || reason != test.reason {
+			t.Errorf("Expected %d %s for %v, got %d %s", test.code, test.reason, test.err, code, reason)
+		}
+	}
+}
+
+func TestTerminationMessage(t *testing.T) {
+	expiration := time.Date(2025, 6, 30, 4, 0, 0, 0, time.UTC)
+	err := fmt.Errorf("Error in license check: %w", &enforce.ExpiredError{Application: "Slackernews", Expiration: expiration})
+	code, reason := classify(err)
+
+	path := filepath.Join(t.TempDir(), "termination-log")
+	if err := writeTerminationMessage(path, summarize(code, reason, err)); err != nil {
+		t.Fatalf("Expected termination message to be written, got %v", err)
+	}
+
+	contents, _ := os.ReadFile(path)
+	var summary terminationMessage
+	if err := json.Unmarshal(contents, &summary); err != nil {
+		t.Fatalf("Expected termination message to be JSON, got %v", err)
+	}
+	if summary.Reason != "LicenseExpired" || summary.ExitCode != exitExpired {
+		t.Errorf("Expected LicenseExpired with exit code %d, got %s with %d", exitExpired, summary.Reason, summary.ExitCode)
+	}
+	if summary.Application != "Slackernews" {
+		t.Errorf("Expected application Slackernews, got %q", summary.Application)
+	}
+	if summary.Expiration == nil || !summary.Expiration.Equal(expiration) {
+		t.Errorf("Expected expiration %v, got %v", expiration, summary.Expiration)
+	}
+	if summary.Message != "Error in license check: License for Slackernews is expired" {
+		t.Errorf("Expected the error as the message, got %q", summary.Message)
+	}
+}
+
+func TestTerminationMessageFailedRules(t *testing.T) {
+	err := &enforce.PolicyError{Result: &enforce.PolicyResult{Results: []enforce.RuleResult{
+		{Rule: "is_enterprise is true"},
+		{Rule: "tier is one of [enterprise]", Error: errors.New(`tier is "business"`)},
+	}}}
+	summary := summarize(exitPolicy, "PolicyNotSatisfied", err)
+	if len(summary.FailedRules) != 1 || summary.FailedRules[0] != "tier is one of [enterprise]" {
+		t.Errorf("Expected the failed rule in the summary, got %v", summary.FailedRules)
+	}
+}
+
+func TestTerminationMessageTruncated(t *testing.T) {
+	err := errors.New(strings.Repeat("é", maxTerminationMessage))
+	path := filepath.Join(t.TempDir(), "termination-log")
+	if err := writeTerminationMessage(path, summarize(exitError, "Error", err)); err != nil {
+		t.Fatalf("Expected termination message to be written, got %v", err)
+	}
+
+	contents, _ := os.ReadFile(path)
+	if len(contents) > maxTerminationMessage {
+		t.Errorf("Expected at most %d bytes, got %d", maxTerminationMessage, len(contents))
+	}
+	var summary terminationMessage
+	if err := json.Unmarshal(contents, &summary); err != nil {
+		t.Fatalf("Expected termination message to be JSON, got %v", err)
+	}
+}
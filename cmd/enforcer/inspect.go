@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/crdant/replicated-license-enforcer/pkg/client"
+	"github.com/crdant/replicated-license-enforcer/pkg/config"
+	"github.com/crdant/replicated-license-enforcer/pkg/enforce"
+)
+
+// A client that can report the whole license and verify every field in it,
+// both the SDK client and the license file client can
+type inspector interface {
+	client.ReplicatedClient
+	GetLicense() (*client.License, error)
+	GetLicenseFields() ([]client.FieldVerification, error)
+}
+
+// the SDK client also knows which release is running
+type appInfoer interface {
+	GetAppInfo() (*client.AppInfo, error)
+}
+
+// returns the client for the license file if there is one, otherwise the
+// client for the Replicated SDK
+func newInspector() inspector {
+	path := licenseFile
+	if path == "" {
+		path = os.Getenv("REPLICATED_LICENSE_FILE")
+	}
+	if path != "" {
+		return client.NewFileClient(path, clientOptions(licenseSettings())...)
+	}
+	return client.NewClient(client.DefaultEndpoint(), clientOptions(licenseSettings())...)
+}
+
+// the license settings from the flags, inspect and verify don't read the
+// configuration file
+func licenseSettings() config.License {
+	return config.License{PublicKeys: publicKeys, RejectLegacySignatures: rejectLegacy, ExpirationTimezone: expirationTimezone}
+}
+
+func runInspect(*flag.FlagSet) {
+	inspected := newInspector()
+	fields, err := inspected.GetLicenseFields()
+	if err != nil {
+		fail("Error inspecting license", err)
+	}
+	inspect(os.Stdout, inspected, fields, time.Now())
+}
+
+// prints what the client reports about the application and license, with
+// any errors in place of what couldn't be read or verified
+func inspect(out io.Writer, inspected inspector, fields []client.FieldVerification, now time.Time) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	name, err := inspected.GetAppName()
+	fmt.Fprintf(w, "Application:\t%s\n", valueOrError(name, err))
+	slug, err := inspected.GetAppSlug()
+	fmt.Fprintf(w, "Slug:\t%s\n", valueOrError(slug, err))
+	if infoer, ok := inspected.(appInfoer); ok {
+		info, err := infoer.GetAppInfo()
+		if err == nil {
+			fmt.Fprintf(w, "Version:\t%s\n", info.CurrentRelease.VersionLabel)
+		}
+	}
+
+	expiration, err := inspected.GetExpirationDate()
+	switch {
+	case errors.Is(err, client.ErrFieldNotFound), err == nil && client.IsPerpetual(expiration):
+		fmt.Fprintf(w, "Expires:\tnever\n")
+	case err != nil:
+		fmt.Fprintf(w, "Expires:\terror: %v\n", err)
+	default:
+		fmt.Fprintf(w, "Expires:\t%s (%s)\n", expiration.Format(time.RFC3339), describeExpiration(expiration, now))
+	}
+
+	license, err := inspected.GetLicense()
+	if err != nil {
+		fmt.Fprintf(w, "License:\tnot verified: %v\n", err)
+	} else {
+		fmt.Fprintf(w, "License:\t%s\n", license.LicenseID)
+		fmt.Fprintf(w, "Customer:\t%s\n", license.CustomerName)
+		fmt.Fprintf(w, "Type:\t%s\n", license.LicenseType)
+		fmt.Fprintf(w, "Channel:\t%s\n", license.ChannelName)
+		fmt.Fprintf(w, "Signed by:\t%s\n", license.KeyID)
+	}
+	w.Flush()
+
+	fmt.Fprintln(out)
+	w = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "FIELD\tTYPE\tVALUE\tSTATUS\n")
+	for _, verification := range fields {
+		field := verification.Field
+		status := fmt.Sprintf("verified by %s with %v", verification.KeyID, verification.Scheme)
+		if !verification.Verified() {
+			status = fmt.Sprintf("not verified: %v", verification.Err)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%v\t%s\n", field.Name, field.ValueType, field.Value, status)
+	}
+	w.Flush()
+}
+
+func valueOrError(value string, err error) string {
+	if err != nil {
+		return fmt.Sprintf("error: %v", err)
+	}
+	return value
+}
+
+func describeExpiration(expiration time.Time, now time.Time) string {
+	days := int(expiration.Sub(now).Hours() / 24)
+	if expiration.Before(now) {
+		return fmt.Sprintf("expired %d days ago", -days)
+	}
+	return fmt.Sprintf("in %d days", days)
+}
+
+func runVerify(*flag.FlagSet) {
+	if licenseFile == "" {
+		failConfiguration("Error verifying license", errors.New("--file is required"))
+	}
+	verified := client.NewFileClient(licenseFile, clientOptions(licenseSettings())...)
+	if err := verify(os.Stdout, verified, time.Now()); err != nil {
+		fail("License is not valid", err)
+	}
+}
+
+// verifies the license and prints a summary of it, returning an error if the
+// license can't be trusted or is expired
+func verify(out io.Writer, verified *client.FileClient, now time.Time) error {
+	license, err := verified.GetLicense()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "License %s for %s is signed by %s\n", license.LicenseID, license.CustomerName, license.KeyID)
+
+	expiration, err := verified.GetExpirationDate()
+	if errors.Is(err, client.ErrFieldNotFound) {
+		fmt.Fprintf(out, "License for %s does not expire\n", license.AppSlug)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if client.IsPerpetual(expiration) {
+		fmt.Fprintf(out, "License for %s does not expire\n", license.AppSlug)
+		return nil
+	}
+	if expiration.Before(now) {
+		return &enforce.ExpiredError{Application: license.AppSlug, Expiration: expiration}
+	}
+	fmt.Fprintf(out, "License for %s expires %s (%s)\n", license.AppSlug, expiration.Format(time.RFC3339), describeExpiration(expiration, now))
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crdant/replicated-license-enforcer/pkg/client"
+	kotsv1beta1 "github.com/replicatedhq/kotskinds/apis/kots/v1beta1"
+	license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
+	"sigs.k8s.io/yaml"
+)
+
+// an inspector that reports whatever it's given
+type fakeInspector struct {
+	expiration    time.Time
+	expirationErr error
+	license       *client.License
+	licenseErr    error
+}
+
+func (f *fakeInspector) GetAppName() (string, error) {
+	return "Slackernews", nil
+}
+
+func (f *fakeInspector) GetAppSlug() (string, error) {
+	return "slackernews-mackerel", nil
+}
+
+func (f *fakeInspector) GetExpirationDate() (time.Time, error) {
+	return f.expiration, f.expirationErr
+}
+
+func (f *fakeInspector) GetLicenseField(name string) (*license.LicenseField, error) {
+	return nil, &client.FieldError{Field: name, Err: client.ErrFieldNotFound}
+}
+
+func (f *fakeInspector) GetLicense() (*client.License, error) {
+	return f.license, f.licenseErr
+}
+
+func (f *fakeInspector) GetLicenseFields() ([]client.FieldVerification, error) {
+	return nil, nil
+}
+
+func TestInspect(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	inspected := &fakeInspector{
+		expiration: time.Date(2025, 6, 30, 4, 0, 0, 0, time.UTC),
+		licenseErr: client.ErrSignatureMissing,
+	}
+	fields := []client.FieldVerification{
+		{Field: license.LicenseField{Name: "enable_discourse", Value: true, ValueType: "Boolean"}, Scheme: client.SchemeMD5PSS, KeyID: client.ReplicatedKeyID},
+		{Field: license.LicenseField{Name: "member_count_max", Value: float64(1000), ValueType: "Integer"}, Err: &client.FieldError{Field: "member_count_max", Err: client.ErrSignatureInvalid}},
+	}
+
+	var out bytes.Buffer
+	inspect(&out, inspected, fields, now)
+	output := out.String()
+
+	for _, expected := range []string{
+		"Application:  Slackernews",
+		"Expires:      2025-06-30T04:00:00Z (in 29 days)",
+		"License:      not verified: signature is missing",
+		"enable_discourse  Boolean  true   verified by replicated with v1 (MD5 RSA-PSS)",
+		"member_count_max  Integer  1000   not verified: license field member_count_max: signature is invalid",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got\n%s", expected, output)
+		}
+	}
+}
+
+func TestInspectNoExpiration(t *testing.T) {
+	inspected := &fakeInspector{
+		expirationErr: &client.FieldError{Field: "expires_at", Err: client.ErrFieldNotFound},
+		license:       &client.License{LicenseID: "2ix2vX4Zwd0vGN4dXhDBCH5zMen", CustomerName: "Omozan", KeyID: client.ReplicatedKeyID},
+	}
+
+	var out bytes.Buffer
+	inspect(&out, inspected, nil, time.Now())
+	output := out.String()
+
+	for _, expected := range []string{"Expires:      never", "Customer:     Omozan", "Signed by:    replicated"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got\n%s", expected, output)
+		}
+	}
+}
+
+func TestInspectPerpetualLicense(t *testing.T) {
+	var out bytes.Buffer
+	inspect(&out, &fakeInspector{licenseErr: client.ErrSignatureMissing}, nil, time.Now())
+	if !strings.Contains(out.String(), "Expires:      never") {
+		t.Errorf("Expected a license that does not expire, got\n%s", out.String())
+	}
+}
+
+func TestVerifyUnsignedLicense(t *testing.T) {
+	unsigned := &kotsv1beta1.License{
+		Spec: kotsv1beta1.LicenseSpec{AppSlug: "slackernews-mackerel", LicenseID: "2ix2vX4Zwd0vGN4dXhDBCH5zMen"},
+	}
+	unsigned.APIVersion = "kots.io/v1beta1"
+	unsigned.Kind = "License"
+	contents, err := yaml.Marshal(unsigned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "license.yaml")
+	if err := os.WriteFile(path, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err = verify(&out, client.NewFileClient(path), time.Now())
+	if !errors.Is(err, client.ErrSignatureMissing) {
+		t.Errorf("Expected a missing signature, got %v", err)
+	}
+	if code, _ := classify(err); code != exitUntrusted {
+		t.Errorf("Expected exit code %d, got %d", exitUntrusted, code)
+	}
+}
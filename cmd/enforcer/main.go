@@ -1,21 +1,91 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
   "os/signal"
+	"net/http"
+	"syscall"
+	"strings"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/charmbracelet/log"
+	"github.com/crdant/replicated-license-enforcer/pkg/client"
+	"github.com/crdant/replicated-license-enforcer/pkg/config"
 	"github.com/crdant/replicated-license-enforcer/pkg/enforce"
+	"github.com/crdant/replicated-license-enforcer/pkg/server"
 	"github.com/crdant/replicated-license-enforcer/pkg/version"
 )
 
 var (
 	logLevel       string
 	recheckInterval time.Duration
+	gracePeriod    time.Duration
+	rules          repeatedFlags
+	onInvalid      repeatedFlags
+	warnBefore     thresholdFlags
+	listenAddress  string
+	licenseFile    string
+	publicKeys     string
+	rejectLegacy   bool
+	expirationTimezone string
+	schedule       string
+	timezone       string
+	checkAtExpiration bool
+	adaptive       bool
+	minInterval    time.Duration
+	maxInterval    time.Duration
+	retryInitialInterval time.Duration
+	retryMaxInterval     time.Duration
+	retryMaxElapsedTime  time.Duration
+	retryJitter          float64
+	retryMaxAttempts     int
+	outagePolicy         string
+	outageMaxAge         time.Duration
+	outageSnapshot       string
+	terminationMessagePath string
+	output         = outputText
 )
 
+// collects every value for flags like `--rule` that can be repeated
+type repeatedFlags []string
+
+func (r *repeatedFlags) String() string {
+	return strings.Join(*r, ", ")
+}
+
+func (r *repeatedFlags) Set(value string) error {
+	*r = append(*r, value)
+	return nil
+}
+
+// parses a comma-separated list of thresholds like `30d,14d,7d,1d`, any valid
+// Go duration works too since Go durations don't have days
+type thresholdFlags []time.Duration
+
+func (t *thresholdFlags) String() string {
+	thresholds := []string{}
+	for _, threshold := range *t {
+		thresholds = append(thresholds, threshold.String())
+	}
+	return strings.Join(thresholds, ",")
+}
+
+func (t *thresholdFlags) Set(value string) error {
+	for _, threshold := range strings.Split(value, ",") {
+		duration, err := config.ParseDuration(threshold)
+		if err != nil {
+			return err
+		}
+		*t = append(*t, duration)
+	}
+	return nil
+}
+
 func init() {
 	logLevel = os.Getenv("LOG_LEVEL")
 	if logLevel == "" {
@@ -24,33 +94,204 @@ func init() {
 	log.ParseLevel(logLevel)
 }
 
+// flags for where the license comes from and which keys to trust
+func licenseFlags(flags *flag.FlagSet) {
+	flags.StringVar(&licenseFile, "license-file", "", "Read the license from this signed license file instead of the Replicated SDK")
+	flags.StringVar(&publicKeys, "public-keys", "", "Also trust the PEM encoded public keys in this file to sign the license")
+	flags.BoolVar(&rejectLegacy, "reject-legacy-signatures", false, "Reject license fields that are only signed with the legacy MD5 scheme")
+	flags.StringVar(&expirationTimezone, "expiration-timezone", "", "Timezone for expiration dates without a time, e.g. America/New_York, defaults to UTC")
+}
+
+// flags for how the license is enforced, shared by every command that checks it
+func enforcementFlags(flags *flag.FlagSet) {
+	flags.DurationVar(&gracePeriod, "grace-period", 0, "Keep treating the license as valid for this long after it expires")
+	flags.Var(&warnBefore, "warn-before", "Warn with an event when the license expires within these thresholds, e.g. 30d,14d,7d,1d")
+	flags.Var(&rules, "rule", "CEL expression the license must satisfy, can be repeated")
+	flags.Var(&onInvalid, "on-invalid", "Action to take when the license becomes invalid (exit:<code>, scale:deployment/<name>, file:<path>, or a URL), can be repeated")
+	flags.StringVar(&terminationMessagePath, "termination-message-path", "/dev/termination-log", "Write a JSON summary of why the enforcer exited to this file, empty to disable")
+	flags.Var(&output, "output", "Print the result of checking the license as text, json, or yaml")
+	configFlags(flags)
+	licenseFlags(flags)
+	retryFlags(flags)
+	outageFlags(flags)
+}
+
+// flags for what to do once retries give up because the Replicated SDK is
+// unavailable
+func outageFlags(flags *flag.FlagSet) {
+	flags.StringVar(&outagePolicy, "outage-policy", string(enforce.FailClosed), "When the Replicated SDK is unavailable, fail-closed or fail-open with the last known good license")
+	flags.DurationVar(&outageMaxAge, "outage-max-age", enforce.DefaultOutageMaxAge, "The oldest last known good license to fail open with")
+	flags.StringVar(&outageSnapshot, "outage-snapshot", "", "Save the last known good license to this file, on a volume that survives restarts")
+}
+
+// flags for how a check that fails for a transient reason, like the
+// Replicated SDK not being up yet, is retried
+func retryFlags(flags *flag.FlagSet) {
+	defaults := enforce.DefaultRetryPolicy()
+	flags.DurationVar(&retryInitialInterval, "retry-initial-interval", defaults.InitialInterval, "How long to wait before retrying a check the first time")
+	flags.DurationVar(&retryMaxInterval, "retry-max-interval", defaults.MaxInterval, "The longest time to wait between retries")
+	flags.DurationVar(&retryMaxElapsedTime, "retry-max-elapsed-time", defaults.MaxElapsedTime, "Stop retrying after this long")
+	flags.Float64Var(&retryJitter, "retry-jitter", defaults.Jitter, "Randomize each wait between retries by this fraction, from 0 to 1")
+	flags.IntVar(&retryMaxAttempts, "retry-max-attempts", defaults.MaxAttempts, "Stop retrying after this many attempts, 0 for no limit")
+}
+
+// flags for running without a command, which is how the enforcer worked
+// before it had commands
+func legacyFlags(flags *flag.FlagSet) {
+	flags.DurationVar(&recheckInterval, "recheck", 0, "Recheck license periodically to assure it's still valid (deprecated, use the monitor command)")
+	flags.StringVar(&listenAddress, "listen", "", "Serve /healthz, /readyz, /license and /metrics on this address, e.g. :8080")
+	enforcementFlags(flags)
+}
+
 func parseFlags() {
-	flag.DurationVar(&recheckInterval, "recheck", 0, "Recheck license periodically to assure it's still valid")
+	legacyFlags(flag.CommandLine)
+	flag.Usage = usage
 	flag.Parse()
 }
 
 func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		command := findCommand(os.Args[1])
+		if command == nil {
+			fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", os.Args[1])
+			legacyFlags(flag.CommandLine)
+			usage()
+			os.Exit(exitConfiguration)
+		}
+		flags := command.parse(os.Args[2:])
+		command.run(flags)
+		return
+	}
+
 	parseFlags()
+	settings := resolveConfig(flag.CommandLine)
+	logVersion()
+	ctx, stop := signalContext()
+	defer stop()
+	enforcer := enforceLicense(ctx, settings)
+	if settings.Recheck.Interval > 0 || settings.Recheck.Schedule != "" || settings.Recheck.Adaptive {
+		if err := scheduleChecks(enforcer, settings.Recheck); err != nil {
+			failConfiguration("Error scheduling license checks", err)
+		}
+	}
+	runEnforcer(ctx, enforcer)
+}
 
+func logVersion() {
 	log.Infof("Version: %s, Build Time: %s, GitCommit: %s\n", version.Version, version.BuildTime, version.GitSHA)
+}
+
+// options for the client that verifies the license
+func clientOptions(license config.License) []client.Option {
+	opts := []client.Option{}
+	if license.PublicKeys != "" {
+		keys, err := client.LoadKeySet(license.PublicKeys)
+		if err != nil {
+			failConfiguration("Error loading public keys", err)
+		}
+		opts = append(opts, client.WithKeySet(client.DefaultKeySet().With(keys)))
+	}
+	if license.RejectLegacySignatures {
+		opts = append(opts, client.RejectLegacySignatures())
+	}
+	if license.ExpirationTimezone != "" {
+		location, err := time.LoadLocation(license.ExpirationTimezone)
+		if err != nil {
+			failConfiguration("Error loading expiration timezone", err)
+		}
+		opts = append(opts, client.WithExpirationLocation(location))
+	}
+	return opts
+}
+
+// creates the enforcer with the settings
+func newEnforcer(settings *config.Config) *enforce.Enforcer {
+	opts := settings.EnforcerOptions()
+	opts = append(opts, enforce.WithClientOptions(clientOptions(settings.License)...))
+	if len(settings.Rules) > 0 {
+		facts, err := enforce.DefaultFacts()
+		if err != nil {
+			failConfiguration("Error connecting to Kubernetes to observe the cluster", err)
+		}
+		opts = append(opts, enforce.WithExpressions(facts, settings.Rules...))
+	}
+
+	for _, spec := range settings.Actions {
+		action, err := enforce.ParseAction(spec)
+		if err != nil {
+			failConfiguration("Error configuring license enforcement action", err)
+		}
+		opts = append(opts, enforce.WithActions(action))
+	}
+
+	enforcer := enforce.DefaultEnforcer(opts...)
+	if enforcer == nil {
+		failConfiguration("Error creating license enforcer", errors.New("could not connect to Kubernetes to record events"))
+	}
+	return enforcer
+}
 
-  enforcer := enforce.DefaultEnforcer()
-	err := enforcer.Validate()
+// validates the license, exiting if it isn't valid
+func enforceLicense(ctx context.Context, settings *config.Config) *enforce.Enforcer {
+	enforcer := newEnforcer(settings)
+	if settings.Listen != "" {
+		go serve(ctx, settings.Listen, enforcer)
+	}
+	result, err := enforcer.ValidateContext(ctx)
+	if result != nil {
+		if err := printResult(os.Stdout, output, result); err != nil {
+			log.Error("Error printing license check result", "error", err)
+		}
+	}
 	if err != nil {
-		log.Error("Error checking license validity", "error", err)
-		os.Exit(1)
+		fail("Error checking license validity", err)
 	}
+	return enforcer
+}
 
-	if recheckInterval > 0 {
-		enforcer.Monitor(recheckInterval)
+// schedules license checks adaptively, on the cron schedule, or on the
+// interval, depending on which is set
+func scheduleChecks(enforcer *enforce.Enforcer, recheck config.Recheck) error {
+	switch {
+	case recheck.Adaptive:
+		return enforcer.RescheduleAdaptive(recheck.AdaptiveBounds())
+	case recheck.Schedule != "":
+		return enforcer.RescheduleCron(recheck.Schedule)
 	}
+	return enforcer.Reschedule(recheck.Interval.Duration())
+}
 
-	waitForSignal()
+// returns a context that's done when the enforcer is asked to stop,
+// Kubernetes sends SIGTERM when it stops the pod
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 }
 
-func waitForSignal() {
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt, os.Kill)
-	<-sig
-	os.Exit(0)
+// checks the license on its schedule until the context is done, then exits
+// with the state of the license from the last check that decided it, so a
+// check that only failed to reach the SDK doesn't fail a normal shutdown
+func runEnforcer(ctx context.Context, enforcer *enforce.Enforcer) {
+	result, err := enforcer.Run(ctx)
+	if err != nil {
+		fail("License was not valid when the enforcer stopped", err)
+	}
+	if result != nil {
+		log.Info("Stopped enforcing license", "state", result.State, "valid", result.Valid)
+	}
+	os.Exit(exitOK)
+}
+
+// serves the license status until the context is done, letting requests
+// that are in progress finish
+func serve(ctx context.Context, address string, enforcer *enforce.Enforcer) {
+	log.Info("Serving license status", "address", address)
+	statusServer := server.NewServer(address, enforcer)
+	go func() {
+		<-ctx.Done()
+		statusServer.Shutdown(context.Background())
+	}()
+	err := statusServer.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fail("Error serving license status", err)
+	}
 }
@@ -8,11 +8,51 @@ import (
 )
 
 func TestRecheckFlag(t *testing.T) {
-	os.Args = []string{"enforce", "-recheck=1m"}
+	os.Args = []string{"enforce", "-recheck=1m", "-grace-period=72h", "-license-file=/etc/replicated/license.yaml"}
 	parseFlags() // now we're actually calling the refactored function
 
 	if recheckInterval != time.Minute {
 		t.Errorf("Expected recheck interval of %v, got %v", time.Minute, recheckInterval)
 	}
+	if gracePeriod != 72*time.Hour {
+		t.Errorf("Expected grace period of %v, got %v", 72*time.Hour, gracePeriod)
+	}
+	if licenseFile != "/etc/replicated/license.yaml" {
+		t.Errorf("Expected license file /etc/replicated/license.yaml, got %v", licenseFile)
+	}
+}
+
+
+func TestRepeatedFlags(t *testing.T) {
+	var flags repeatedFlags
+	flags.Set("license.fields.is_enterprise")
+	flags.Set("license.fields.max_seats >= cluster.nodes")
+
+	if len(flags) != 2 {
+		t.Fatalf("Expected 2 rules, got %d", len(flags))
+	}
+	if flags[1] != "license.fields.max_seats >= cluster.nodes" {
+		t.Errorf("Expected rules in the order provided, got %v", flags)
+	}
 }
 
+func TestThresholdFlags(t *testing.T) {
+	var flags thresholdFlags
+	if err := flags.Set("30d, 14d,7d,12h"); err != nil {
+		t.Fatalf("Expected thresholds to parse, got %v", err)
+	}
+
+	expected := []time.Duration{30 * 24 * time.Hour, 14 * 24 * time.Hour, 7 * 24 * time.Hour, 12 * time.Hour}
+	if len(flags) != len(expected) {
+		t.Fatalf("Expected %d thresholds, got %d", len(expected), len(flags))
+	}
+	for i, threshold := range expected {
+		if flags[i] != threshold {
+			t.Errorf("Expected threshold %v, got %v", threshold, flags[i])
+		}
+	}
+
+	if err := flags.Set("soon"); err == nil {
+		t.Errorf("Expected an invalid threshold to fail")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/crdant/replicated-license-enforcer/pkg/enforce"
+	"sigs.k8s.io/yaml"
+)
+
+// How to print the result of checking the license
+type outputFormat string
+
+const (
+	outputText outputFormat = "text"
+	outputJSON outputFormat = "json"
+	outputYAML outputFormat = "yaml"
+)
+
+func (o *outputFormat) String() string {
+	return string(*o)
+}
+
+func (o *outputFormat) Set(value string) error {
+	switch format := outputFormat(value); format {
+	case outputText, outputJSON, outputYAML:
+		*o = format
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, use text, json, or yaml", value)
+}
+
+// prints the result in the format, JSON and YAML use the field names from
+// `enforce.Result` so they stay the same from release to release
+func printResult(out io.Writer, format outputFormat, result *enforce.Result) error {
+	switch format {
+	case outputJSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	case outputYAML:
+		document, err := yaml.Marshal(result)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(document)
+		return err
+	}
+
+	fmt.Fprintln(out, result.String())
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Application:\t%s (%s)\n", result.Application, result.AppSlug)
+	if result.Expiration != nil {
+		fmt.Fprintf(w, "Expires:\t%s (%d days remaining)\n", result.Expiration.Format(time.RFC3339), *result.DaysRemaining)
+	}
+	if result.State != "" {
+		fmt.Fprintf(w, "State:\t%s\n", result.State)
+	}
+	fmt.Fprintf(w, "Valid:\t%t\n", result.Valid)
+	for _, field := range result.Fields {
+		status := "verified"
+		if !field.Verified {
+			status = "not verified: " + field.Error
+		}
+		fmt.Fprintf(w, "Field %s:\t%s\n", field.Name, status)
+	}
+	for _, event := range result.Events {
+		status := "recorded"
+		if event.Error != "" {
+			status = "not recorded: " + event.Error
+		}
+		fmt.Fprintf(w, "Event %s:\t%s\n", event.Reason, status)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crdant/replicated-license-enforcer/pkg/enforce"
+	"sigs.k8s.io/yaml"
+)
+
+func testResult() *enforce.Result {
+	expiration := time.Date(2025, 6, 30, 4, 0, 0, 0, time.UTC)
+	days := 29
+	return &enforce.Result{
+		Application:   "Slackernews",
+		AppSlug:       "slackernews-mackerel",
+		Expiration:    &expiration,
+		DaysRemaining: &days,
+		State:         enforce.StateValid,
+		Valid:         true,
+		CheckedAt:     time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+		Fields: []enforce.FieldResult{
+			{Name: "expires_at", Type: "String", Value: "2025-06-30T04:00:00Z", Verified: true},
+			{Name: "max_seats", Error: "license field max_seats: signature is invalid"},
+		},
+		Events: []enforce.EventResult{{Reason: "Valid"}},
+	}
+}
+
+func TestOutputFormatFlag(t *testing.T) {
+	var format outputFormat
+	for _, value := range []string{"json", "yaml", "text"} {
+		if err := format.Set(value); err != nil || string(format) != value {
+			t.Errorf("Expected %s to be a valid output format, got %v", value, err)
+		}
+	}
+	if err := format.Set("xml"); err == nil {
+		t.Errorf("Expected xml to be rejected")
+	}
+}
+
+func TestPrintResultJSON(t *testing.T) {
+	var out bytes.Buffer
+	if err := printResult(&out, outputJSON, testResult()); err != nil {
+		t.Fatalf("Expected result to print, got %v", err)
+	}
+
+	var document map[string]any
+	if err := json.Unmarshal(out.Bytes(), &document); err != nil {
+		t.Fatalf("Expected JSON, got %v", err)
+	}
+	if document["appSlug"] != "slackernews-mackerel" || document["daysRemaining"] != float64(29) || document["valid"] != true {
+		t.Errorf("Expected the result in the document, got %v", document)
+	}
+}
+
+func TestPrintResultYAML(t *testing.T) {
+	var out bytes.Buffer
+	if err := printResult(&out, outputYAML, testResult()); err != nil {
+		t.Fatalf("Expected result to print, got %v", err)
+	}
+
+	var result enforce.Result
+	if err := yaml.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("Expected YAML, got %v", err)
+	}
+	if result.Application != "Slackernews" || len(result.Fields) != 2 || result.Fields[1].Verified {
+		t.Errorf("Expected the result to round trip, got %+v", result)
+	}
+}
+
+func TestPrintResultText(t *testing.T) {
+	var out bytes.Buffer
+	if err := printResult(&out, outputText, testResult()); err != nil {
+		t.Fatalf("Expected result to print, got %v", err)
+	}
+
+	for _, expected := range []string{
+		"License for Slackernews is valid, 29 days remaining",
+		"Expires:           2025-06-30T04:00:00Z (29 days remaining)",
+		"Field max_seats:   not verified: license field max_seats: signature is invalid",
+		"Event Valid:       recorded",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected output to contain %q, got\n%s", expected, out.String())
+		}
+	}
+}
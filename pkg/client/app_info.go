@@ -1,7 +1,9 @@
 package client
 
 import (
+    "context"
     "encoding/json"
+    "net/http"
 
     app "github.com/replicatedhq/replicated-sdk/pkg/handlers"
 )
@@ -10,7 +12,13 @@ type AppInfo = app.GetCurrentAppInfoResponse
 
 // Returns the name of for the application, as returned from the Replicated SDK
 func (c *Client) GetAppName() (string, error) {
-    info, err := c.GetAppInfo()
+    return c.GetAppNameContext(context.Background())
+}
+
+// Returns the name of the application, abandoning the request when the
+// context is done
+func (c *Client) GetAppNameContext(ctx context.Context) (string, error) {
+    info, err := c.GetAppInfoContext(ctx)
     if err != nil {
       return "", err
     }
@@ -20,7 +28,13 @@ func (c *Client) GetAppName() (string, error) {
 // Returns the application slug for the application, as returned from the
 // Replicated SDK
 func (c *Client) GetAppSlug() (string, error) {
-    info, err := c.GetAppInfo()
+    return c.GetAppSlugContext(context.Background())
+}
+
+// Returns the application slug, abandoning the request when the context is
+// done
+func (c *Client) GetAppSlugContext(ctx context.Context) (string, error) {
+    info, err := c.GetAppInfoContext(ctx)
     if err != nil {
       return "", err
     }
@@ -31,11 +45,20 @@ func (c *Client) GetAppSlug() (string, error) {
 // of the Helm chart in the Replicated OCI registry, and details about the
 // current application release that the instance is running.
 func (c *Client) GetAppInfo() (*AppInfo, error) {
-    response, err := c.makeRequest("GET", "/api/v1/app/info", nil)
+    return c.GetAppInfoContext(context.Background())
+}
+
+// Lists details about the application instance, abandoning the request when
+// the context is done
+func (c *Client) GetAppInfoContext(ctx context.Context) (*AppInfo, error) {
+    response, err := c.makeRequestContext(ctx, "GET", "/api/v1/app/info", nil)
     if err != nil {
         return nil, err
     }
     defer response.Body.Close()
+    if response.StatusCode != http.StatusOK {
+        return nil, &RequestError{URL: "/api/v1/app/info", StatusCode: response.StatusCode}
+    }
 
     var appInfo AppInfo
     if err := json.NewDecoder(response.Body).Decode(&appInfo); err != nil {
@@ -0,0 +1,88 @@
+package client
+
+import (
+    "encoding/json"
+    "fmt"
+    "math"
+    "strconv"
+
+    license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
+)
+
+// the largest integer a JSON number can hold without losing precision, since
+// the SDK's JSON is decoded into floats
+const maxExactInteger = 1 << 53
+
+// Returns the canonical form of a field's value, which is what's signed for
+// each value type:
+//
+//   - String, Text, and File values as they are
+//   - Integer values in base 10 without a fraction or exponent
+//   - Float values in the shortest form that parses back to the same float
+//   - Boolean values as `true` or `false`
+//   - Object and Array values as compact JSON with sorted keys
+//
+// A value that doesn't match its type, or a type that isn't listed, is an
+// error rather than something to verify against an empty string.
+func canonicalValue(field *license.LicenseField) (string, error) {
+    switch field.ValueType {
+    case "String", "Text", "File":
+        value, ok := field.Value.(string)
+        if !ok {
+            return "", mismatchedValue(field)
+        }
+        return value, nil
+    case "Integer":
+        value, ok := integer(field.Value)
+        if !ok {
+            return "", mismatchedValue(field)
+        }
+        return strconv.FormatInt(value, 10), nil
+    case "Float":
+        value, ok := field.Value.(float64)
+        if !ok || math.IsNaN(value) || math.IsInf(value, 0) {
+            return "", mismatchedValue(field)
+        }
+        return strconv.FormatFloat(value, 'g', -1, 64), nil
+    case "Boolean":
+        value, ok := field.Value.(bool)
+        if !ok {
+            return "", mismatchedValue(field)
+        }
+        return strconv.FormatBool(value), nil
+    case "Object", "Array":
+        _, isObject := field.Value.(map[string]any)
+        _, isArray := field.Value.([]any)
+        if (field.ValueType == "Object" && !isObject) || (field.ValueType == "Array" && !isArray) {
+            return "", mismatchedValue(field)
+        }
+        // maps are marshaled with their keys sorted
+        value, err := json.Marshal(field.Value)
+        if err != nil {
+            return "", fmt.Errorf("%s value cannot be serialized: %w", field.Name, err)
+        }
+        return string(value), nil
+    }
+    return "", fmt.Errorf("%s has unsupported value type %q", field.Name, field.ValueType)
+}
+
+// returns the value as an integer if it's a whole number that was decoded
+// without losing precision
+func integer(value any) (int64, bool) {
+    switch number := value.(type) {
+    case float64:
+        if number != math.Trunc(number) || math.Abs(number) > maxExactInteger {
+            return 0, false
+        }
+        return int64(number), true
+    case int64:
+        return number, true
+    case int:
+        return int64(number), true
+    }
+    return 0, false
+}
+
+func mismatchedValue(field *license.LicenseField) error {
+    return &TamperedError{Field: field.Name, Reason: fmt.Sprintf("value is not a valid %s", field.ValueType)}
+}
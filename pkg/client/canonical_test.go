@@ -0,0 +1,131 @@
+package client
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "math"
+    "strconv"
+    "testing"
+    "testing/quick"
+
+    license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalValue(t *testing.T) {
+    cases := []struct {
+        valueType string
+        value     any
+        canonical string
+    }{
+        {"String", "business", "business"},
+        {"Text", "line one\nline two", "line one\nline two"},
+        {"File", "aGVsbG8=", "aGVsbG8="},
+        {"Integer", float64(100), "100"},
+        {"Integer", float64(-3), "-3"},
+        {"Integer", int64(42), "42"},
+        {"Float", 2.5, "2.5"},
+        {"Float", float64(3), "3"},
+        {"Float", 0.1, "0.1"},
+        {"Boolean", true, "true"},
+        {"Boolean", false, "false"},
+        {"Object", map[string]any{"tier": "gold", "regions": []any{"us", "eu"}, "seats": float64(5)}, `{"regions":["us","eu"],"seats":5,"tier":"gold"}`},
+        {"Array", []any{"us", map[string]any{"b": true, "a": nil}}, `["us",{"a":null,"b":true}]`},
+    }
+    for _, c := range cases {
+        value, err := canonicalValue(&license.LicenseField{Name: "field", ValueType: c.valueType, Value: c.value})
+        assert.NoError(t, err, c.valueType)
+        assert.Equal(t, c.canonical, value, c.valueType)
+    }
+}
+
+func TestCanonicalValueMismatched(t *testing.T) {
+    cases := []struct {
+        valueType string
+        value     any
+    }{
+        {"String", float64(1)},
+        {"Text", nil},
+        {"Integer", "100"},
+        {"Integer", 2.5},
+        {"Integer", float64(1 << 60)},
+        {"Integer", true},
+        {"Float", "2.5"},
+        {"Float", math.NaN()},
+        {"Float", math.Inf(1)},
+        {"Boolean", "true"},
+        {"Boolean", float64(1)},
+        {"Object", []any{}},
+        {"Array", map[string]any{}},
+        {"Object", map[string]any{"unserializable": make(chan int)}},
+        {"Password", "secret"},
+        {"", "anything"},
+    }
+    for _, c := range cases {
+        _, err := canonicalValue(&license.LicenseField{Name: "field", ValueType: c.valueType, Value: c.value})
+        assert.Error(t, err, "%s %v", c.valueType, c.value)
+    }
+}
+
+func TestUnknownTypeRejected(t *testing.T) {
+    key := generateKey(t)
+    v := newVerifier(WithKeySet(KeySet{"fixtures": &key.PublicKey}))
+
+    // signed over the empty string, which unknown types used to be verified against
+    signature := base64.StdEncoding.EncodeToString(signMessage(t, key, []byte("")))
+    field := &license.LicenseField{Name: "logo", ValueType: "Image", Value: "logo.png"}
+    _, err := v.VerifyFieldSignature(field, FieldSignature{V1: signature})
+    assert.ErrorContains(t, err, `unsupported value type "Image"`)
+}
+
+// every whole number a JSON float can hold exactly has the same canonical form
+// as the integer itself
+func TestCanonicalIntegerProperty(t *testing.T) {
+    property := func(n int64) bool {
+        n = n % maxExactInteger
+        value, err := canonicalValue(&license.LicenseField{ValueType: "Integer", Value: float64(n)})
+        return err == nil && value == strconv.FormatInt(n, 10)
+    }
+    assert.NoError(t, quick.Check(property, nil))
+}
+
+// the canonical form of a float parses back to the same float
+func TestCanonicalFloatProperty(t *testing.T) {
+    property := func(f float64) bool {
+        value, err := canonicalValue(&license.LicenseField{ValueType: "Float", Value: f})
+        if err != nil {
+            return false
+        }
+        parsed, err := strconv.ParseFloat(value, 64)
+        return err == nil && parsed == f
+    }
+    assert.NoError(t, quick.Check(property, nil))
+}
+
+// Verifying whatever the SDK returns can fail, but it can never panic
+func FuzzVerifyLicenseField(f *testing.F) {
+    f.Add([]byte(memberCountMaxField))
+    f.Add([]byte(enableDiscourseField))
+    f.Add([]byte(`{"name": "seats", "valueType": "Integer", "value": "100", "signature": {"v1": "AAAA"}}`))
+    f.Add([]byte(`{"name": "seats", "valueType": "Integer", "value": 1e300, "signature": {"v2": "AAAA"}}`))
+    f.Add([]byte(`{"name": "enabled", "valueType": "Boolean", "value": 1, "signature": {"v3": "AAAA"}}`))
+    f.Add([]byte(`{"name": "enabled", "valueType": "Boolean", "signature": {}}`))
+    f.Add([]byte(`{"name": "ratio", "valueType": "Float", "value": null}`))
+    f.Add([]byte(`{"name": "limits", "valueType": "Object", "value": [1, {"a": {}}]}`))
+    f.Add([]byte(`{"name": "regions", "valueType": "Array", "value": {"us": true}}`))
+    f.Add([]byte(`{"name": "logo", "valueType": "File", "value": {"name": "logo.png"}}`))
+    f.Add([]byte(`{"valueType": 7, "value": []}`))
+    f.Add([]byte(`{"signature": "v1"}`))
+
+    v := newVerifier(WithKeySet(KeySet{}))
+    f.Fuzz(func(t *testing.T, body []byte) {
+        var response fieldResponse
+        if err := json.Unmarshal(body, &response); err != nil {
+            return
+        }
+        field := response.field()
+        canonicalValue(&field)
+        v.VerifyFieldSignature(&field, response.Signature)
+        v.VerifyLicenseField(&field)
+    })
+}
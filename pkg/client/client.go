@@ -1,10 +1,15 @@
 package client
 
 import (
+    "context"
     "io"
     "net/http"
+    "os"
+    "strconv"
     "time"
 
+    "github.com/crdant/replicated-license-enforcer/pkg/metrics"
+
     license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
 )
 
@@ -14,24 +19,54 @@ import (
 type Client struct {
     HTTPClient *http.Client
     BaseURL    string
+
+    verifier
+}
+
+// Returns the URL of the Replicated SDK from `REPLICATED_SDK_ENDPOINT`, or
+// the SDK's default if it isn't set
+func DefaultEndpoint() string {
+    endpoint := os.Getenv("REPLICATED_SDK_ENDPOINT")
+    if endpoint == "" {
+      // this is the default in the current build of the SDK
+      endpoint = "http://replicated:3000"
+    }
+    return endpoint
 }
 
 // Returns a new client with that will access the Replicated SDK at the
 // provided URL
-func NewClient(baseURL string) *Client {
+func NewClient(baseURL string, opts ...Option) *Client {
     return &Client{
         HTTPClient: &http.Client{Timeout: time.Second * 30},
         BaseURL:    baseURL,
+        verifier:   newVerifier(opts...),
     }
 }
 
 // Common method to make requests
 func (c *Client) makeRequest(method, url string, body io.Reader) (*http.Response, error) {
-    req, err := http.NewRequest(method, c.BaseURL+url, body)
+    return c.makeRequestContext(context.Background(), method, url, body)
+}
+
+// Makes a request that's abandoned when the context is done
+func (c *Client) makeRequestContext(ctx context.Context, method, url string, body io.Reader) (*http.Response, error) {
+    req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+url, body)
     if err != nil {
         return nil, err
     }
-    return c.HTTPClient.Do(req)
+
+    started := time.Now()
+    response, err := c.HTTPClient.Do(req)
+    code := "error"
+    if err == nil {
+        code = strconv.Itoa(response.StatusCode)
+    }
+    metrics.RecordSDKRequest(method, url, code, time.Since(started))
+    if err != nil {
+        return nil, &RequestError{URL: url, Err: err}
+    }
+    return response, nil
 }
 
 // A client for a subset of the Replicated SDK as required for validating
@@ -5,6 +5,9 @@ import (
     "net/http"
     "net/http/httptest"
     "testing"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/metrics"
+    "github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestNewClient(t *testing.T) {
@@ -72,3 +75,20 @@ func TestNotFoundGetRequest(t *testing.T) {
         t.Errorf("Expected response body to be empty, got '%s'", string(body))
     }
 }
+
+func TestRequestDurationRecorded(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusOK)
+    }))
+    defer server.Close()
+
+    before := testutil.CollectAndCount(metrics.SDKRequestDuration)
+    client := NewClient(server.URL)
+    client.makeRequest(http.MethodGet, "/api/v1/license/fields/metrics_test", nil)
+    client.makeRequest(http.MethodGet, "/api/v1/license/fields/another_metrics_test", nil)
+
+    // both fields are recorded under the same endpoint
+    if count := testutil.CollectAndCount(metrics.SDKRequestDuration); count > before+1 {
+        t.Errorf("Expected at most one new series, got %d", count-before)
+    }
+}
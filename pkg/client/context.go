@@ -0,0 +1,69 @@
+package client
+
+import (
+    "context"
+    "time"
+
+    license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
+)
+
+// A client that can abandon its requests when a context is done
+type ContextClient interface {
+  GetAppNameContext(context.Context) (string, error)
+  GetAppSlugContext(context.Context) (string, error)
+  GetExpirationDateContext(context.Context) (time.Time, error)
+
+  GetLicenseFieldContext(context.Context, string) (*license.LicenseField, error)
+}
+
+// Returns a client whose requests are abandoned when the context is done.
+// Clients that don't implement `ContextClient` are checked for cancellation
+// before each request instead.
+func WithContext(ctx context.Context, c ReplicatedClient) ReplicatedClient {
+    return &boundClient{ctx: ctx, client: c}
+}
+
+type boundClient struct {
+    ctx    context.Context
+    client ReplicatedClient
+}
+
+func (b *boundClient) GetAppName() (string, error) {
+    if c, ok := b.client.(ContextClient); ok {
+        return c.GetAppNameContext(b.ctx)
+    }
+    if err := b.ctx.Err(); err != nil {
+        return "", err
+    }
+    return b.client.GetAppName()
+}
+
+func (b *boundClient) GetAppSlug() (string, error) {
+    if c, ok := b.client.(ContextClient); ok {
+        return c.GetAppSlugContext(b.ctx)
+    }
+    if err := b.ctx.Err(); err != nil {
+        return "", err
+    }
+    return b.client.GetAppSlug()
+}
+
+func (b *boundClient) GetExpirationDate() (time.Time, error) {
+    if c, ok := b.client.(ContextClient); ok {
+        return c.GetExpirationDateContext(b.ctx)
+    }
+    if err := b.ctx.Err(); err != nil {
+        return time.Time{}, err
+    }
+    return b.client.GetExpirationDate()
+}
+
+func (b *boundClient) GetLicenseField(field string) (*license.LicenseField, error) {
+    if c, ok := b.client.(ContextClient); ok {
+        return c.GetLicenseFieldContext(b.ctx, field)
+    }
+    if err := b.ctx.Err(); err != nil {
+        return nil, err
+    }
+    return b.client.GetLicenseField(field)
+}
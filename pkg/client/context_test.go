@@ -0,0 +1,43 @@
+package client
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/assert"
+)
+
+func TestRequestAbandonedWhenContextDone(t *testing.T) {
+    release := make(chan struct{})
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        <-release
+    }))
+    defer server.Close()
+    defer close(release)
+
+    ctx, cancel := context.WithTimeout(t.Context(), 50 * time.Millisecond)
+    defer cancel()
+
+    client := NewClient(server.URL)
+    _, err := client.GetLicenseFieldContext(ctx, "expires_at")
+    assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestWithContextCancelled(t *testing.T) {
+    ctx, cancel := context.WithCancel(t.Context())
+    mock := DefaultMockAPIClient()
+    bound := WithContext(ctx, mock)
+
+    name, err := bound.GetAppName()
+    assert.NoError(t, err)
+    assert.Equal(t, "Slackernews", name)
+
+    cancel()
+    _, err = bound.GetExpirationDate()
+    assert.ErrorIs(t, err, context.Canceled)
+    mock.AssertNotCalled(t, "GetExpirationDate")
+}
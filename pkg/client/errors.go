@@ -0,0 +1,94 @@
+package client
+
+import (
+    "context"
+    "errors"
+    "fmt"
+
+    sdklicense "github.com/replicatedhq/replicated-sdk/pkg/license"
+)
+
+var (
+    // The license or a field in it has a signature that isn't valid for any
+    // trusted key. This is the same error the Replicated SDK returns, so
+    // `errors.Is` matches either one.
+    ErrSignatureInvalid = sdklicense.ErrSignatureInvalid
+
+    // The license or a field in it isn't signed at all
+    ErrSignatureMissing = sdklicense.ErrSignatureMissing
+
+    // The Replicated SDK couldn't be reached or failed to answer
+    ErrSDKUnavailable = errors.New("Replicated SDK is unavailable")
+
+    // The license doesn't have the requested field
+    ErrFieldNotFound = errors.New("license field not found")
+
+    // The license reported doesn't match the license that was signed
+    ErrLicenseTampered = errors.New("license may have been tampered with")
+
+    // The expiration date in the license can't be read
+    ErrInvalidExpiration = errors.New("license expiration date is not valid")
+)
+
+// An error that occurred for a specific license field, use `errors.As` to
+// find out which field
+type FieldError struct {
+    Field string
+    Err   error
+}
+
+func (e *FieldError) Error() string {
+    if errors.Is(e.Err, ErrFieldNotFound) {
+        return fmt.Sprintf("license field %s not found", e.Field)
+    }
+    return fmt.Sprintf("license field %s: %v", e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+    return e.Err
+}
+
+// A request to the Replicated SDK that failed, either because the SDK
+// couldn't be reached (StatusCode is zero) or because it answered with an
+// error. Network failures and server errors match `ErrSDKUnavailable`.
+type RequestError struct {
+    URL        string
+    StatusCode int
+    Err        error
+}
+
+func (e *RequestError) Error() string {
+    if e.StatusCode == 0 {
+        return fmt.Sprintf("request to %s failed: %v", e.URL, e.Err)
+    }
+    return fmt.Sprintf("%s returned %d", e.URL, e.StatusCode)
+}
+
+func (e *RequestError) Unwrap() error {
+    return e.Err
+}
+
+func (e *RequestError) Is(target error) bool {
+    if target != ErrSDKUnavailable {
+        return false
+    }
+    // the caller giving up isn't the SDK's fault
+    if errors.Is(e.Err, context.Canceled) {
+        return false
+    }
+    return e.StatusCode == 0 || e.StatusCode >= 500
+}
+
+// A value in the license that doesn't match what was signed
+type TamperedError struct {
+    Field  string
+    Reason string
+}
+
+func (e *TamperedError) Error() string {
+    return fmt.Sprintf("%s %s, %v", e.Field, e.Reason, ErrLicenseTampered)
+}
+
+func (e *TamperedError) Unwrap() error {
+    return ErrLicenseTampered
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+    sdklicense "github.com/replicatedhq/replicated-sdk/pkg/license"
+)
+
+func TestFieldNotFound(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusNotFound)
+    }))
+    defer server.Close()
+
+    c := NewClient(server.URL)
+    _, err := c.GetLicenseField("max_member_count")
+    assert.ErrorIs(t, err, ErrFieldNotFound)
+    assert.NotErrorIs(t, err, ErrSDKUnavailable)
+
+    var fieldErr *FieldError
+    require.ErrorAs(t, err, &fieldErr)
+    assert.Equal(t, "max_member_count", fieldErr.Field)
+    assert.EqualError(t, err, "license field max_member_count not found")
+}
+
+func TestSDKServerError(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusServiceUnavailable)
+    }))
+    defer server.Close()
+
+    c := NewClient(server.URL)
+    _, err := c.GetLicenseField("expires_at")
+    assert.ErrorIs(t, err, ErrSDKUnavailable)
+
+    var requestErr *RequestError
+    require.ErrorAs(t, err, &requestErr)
+    assert.Equal(t, http.StatusServiceUnavailable, requestErr.StatusCode)
+
+    _, err = c.GetAppName()
+    assert.ErrorIs(t, err, ErrSDKUnavailable)
+}
+
+func TestSDKClientErrorIsNotUnavailable(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusForbidden)
+    }))
+    defer server.Close()
+
+    _, err := NewClient(server.URL).GetLicense()
+    assert.Error(t, err)
+    assert.NotErrorIs(t, err, ErrSDKUnavailable)
+}
+
+func TestSDKUnreachable(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+    url := server.URL
+    server.Close()
+
+    _, err := NewClient(url).GetExpirationDate()
+    assert.ErrorIs(t, err, ErrSDKUnavailable)
+}
+
+func TestCancelledIsNotUnavailable(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+    defer server.Close()
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+    _, err := NewClient(server.URL).GetAppNameContext(ctx)
+    assert.ErrorIs(t, err, context.Canceled)
+    assert.NotErrorIs(t, err, ErrSDKUnavailable)
+}
+
+func TestSignatureErrorsMatchSDK(t *testing.T) {
+    assert.True(t, errors.Is(ErrSignatureInvalid, sdklicense.ErrSignatureInvalid))
+    assert.True(t, errors.Is(ErrSignatureMissing, sdklicense.ErrSignatureMissing))
+}
+
+func TestInvalidFieldSignature(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte(`{"name": "member_count_max", "value": 1000, "valueType": "Integer", "signature": {"v1": "c2lnbmF0dXJl"}}`))
+    }))
+    defer server.Close()
+
+    _, err := NewClient(server.URL).GetLicenseField("member_count_max")
+    assert.ErrorIs(t, err, ErrSignatureInvalid)
+
+    var fieldErr *FieldError
+    require.ErrorAs(t, err, &fieldErr)
+    assert.Equal(t, "member_count_max", fieldErr.Field)
+}
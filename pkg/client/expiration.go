@@ -0,0 +1,138 @@
+package client
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+
+    license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
+)
+
+// Reads dates without a time in the location instead of UTC, for licenses
+// whose expiration dates are written in the vendor's timezone
+func WithExpirationLocation(location *time.Location) Option {
+    return func(v *verifier) {
+        if location != nil {
+            v.expirationLocation = location
+        }
+    }
+}
+
+// A client that returns the signed `expires_at` field, so the expiration
+// date can be verified again without the SDK
+type SignedExpirationClient interface {
+    GetSignedExpirationContext(context.Context) (*license.LicenseField, FieldSignature, error)
+}
+
+// Verifies an `expires_at` field saved from `GetSignedExpirationContext`
+// against the keys the options trust, and returns its expiration date the
+// way a client with the same options reads it
+func VerifyExpiration(field *license.LicenseField, signature FieldSignature, opts ...Option) (time.Time, error) {
+    v := newVerifier(opts...)
+    if _, err := v.VerifyFieldSignature(field, signature); err != nil {
+        return time.Time{}, &FieldError{Field: field.Name, Err: err}
+    }
+    return v.expiration(field)
+}
+
+// Reports whether an expiration date from `GetExpirationDate` means the
+// license never expires
+func IsPerpetual(expiration time.Time) bool {
+    return expiration.IsZero()
+}
+
+// Parses the value of the `expires_at` field in a license. A license that
+// doesn't expire has an empty value, which is returned as the zero time (see
+// `IsPerpetual`). Dates can be RFC 3339 timestamps, dates without a time,
+// which are read as midnight in the location, or seconds since the Unix
+// epoch. Any other value returns an `ExpirationError`.
+func ParseExpiration(value any, location *time.Location) (time.Time, error) {
+    switch value := value.(type) {
+    case nil:
+        return time.Time{}, nil
+    case string:
+        return parseExpirationString(value, location)
+    case float64:
+        if value == float64(int64(value)) {
+            return time.Unix(int64(value), 0).UTC(), nil
+        }
+    case int64:
+        return time.Unix(value, 0).UTC(), nil
+    case int:
+        return time.Unix(int64(value), 0).UTC(), nil
+    case json.Number:
+        return parseExpirationString(value.String(), location)
+    }
+    return time.Time{}, &ExpirationError{Value: value}
+}
+
+func parseExpirationString(value string, location *time.Location) (time.Time, error) {
+    value = strings.TrimSpace(value)
+    if value == "" {
+        return time.Time{}, nil
+    }
+    if location == nil {
+        location = time.UTC
+    }
+
+    if expiration, err := time.Parse(time.RFC3339, value); err == nil {
+        return expiration, nil
+    }
+    if expiration, err := time.ParseInLocation(time.DateOnly, value, location); err == nil {
+        return expiration, nil
+    }
+    if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+        return time.Unix(seconds, 0).UTC(), nil
+    }
+    return time.Time{}, &ExpirationError{Value: value}
+}
+
+// returns the `expires_at` field with the value as it was signed. The SDK
+// reports a license that doesn't expire with a null value, and can report a
+// Unix timestamp as a number, but both are signed as strings.
+func signedExpiration(field license.LicenseField) license.LicenseField {
+    if field.ValueType != "String" && field.ValueType != "Text" {
+        return field
+    }
+    if field.Value == nil {
+        field.Value = ""
+    } else if seconds, ok := integer(field.Value); ok {
+        field.Value = strconv.FormatInt(seconds, 10)
+    }
+    return field
+}
+
+// returns a field the SDK reported with its value as it was signed, which
+// only differs for `expires_at`
+func signedField(name string, field license.LicenseField) license.LicenseField {
+    if name != "expires_at" {
+        return field
+    }
+    return signedExpiration(field)
+}
+
+// parses the `expires_at` field, reading dates in the configured location
+func (v *verifier) expiration(field *license.LicenseField) (time.Time, error) {
+    expiration, err := ParseExpiration(field.Value, v.expirationLocation)
+    if err != nil {
+        return time.Time{}, &FieldError{Field: field.Name, Err: err}
+    }
+    return expiration, nil
+}
+
+// The expiration date in the license isn't in a format the enforcer can
+// read, it matches `ErrInvalidExpiration`
+type ExpirationError struct {
+    Value any
+}
+
+func (e *ExpirationError) Error() string {
+    return fmt.Sprintf("%v: %q is not an RFC 3339 timestamp, a date like 2006-01-02, or a Unix timestamp", ErrInvalidExpiration, fmt.Sprint(e.Value))
+}
+
+func (e *ExpirationError) Unwrap() error {
+    return ErrInvalidExpiration
+}
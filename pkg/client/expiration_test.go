@@ -0,0 +1,193 @@
+package client
+
+import (
+    "crypto/ed25519"
+    "crypto/rand"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    kotsv1beta1 "github.com/replicatedhq/kotskinds/apis/kots/v1beta1"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func TestParseExpiration(t *testing.T) {
+    newYork, err := time.LoadLocation("America/New_York")
+    require.NoError(t, err)
+
+    tests := []struct {
+        name     string
+        value    any
+        location *time.Location
+        expected time.Time
+    }{
+        {"RFC 3339", "2025-06-30T04:00:00Z", nil, time.Date(2025, 6, 30, 4, 0, 0, 0, time.UTC)},
+        {"RFC 3339 with an offset", "2025-06-30T00:00:00-04:00", nil, time.Date(2025, 6, 30, 4, 0, 0, 0, time.UTC)},
+        {"date", "2025-06-30", nil, time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)},
+        {"date in a timezone", "2025-06-30", newYork, time.Date(2025, 6, 30, 4, 0, 0, 0, time.UTC)},
+        {"epoch string", "1751256000", nil, time.Date(2025, 6, 30, 4, 0, 0, 0, time.UTC)},
+        {"epoch number", float64(1751256000), nil, time.Date(2025, 6, 30, 4, 0, 0, 0, time.UTC)},
+        {"epoch integer", int64(1751256000), nil, time.Date(2025, 6, 30, 4, 0, 0, 0, time.UTC)},
+        {"epoch JSON number", json.Number("1751256000"), nil, time.Date(2025, 6, 30, 4, 0, 0, 0, time.UTC)},
+    }
+    for _, test := range tests {
+        expiration, err := ParseExpiration(test.value, test.location)
+        require.NoError(t, err, test.name)
+        assert.True(t, test.expected.Equal(expiration), "%s: expected %v, got %v", test.name, test.expected, expiration)
+        assert.False(t, IsPerpetual(expiration), test.name)
+    }
+}
+
+func TestParsePerpetualExpiration(t *testing.T) {
+    for _, value := range []any{nil, "", "  "} {
+        expiration, err := ParseExpiration(value, nil)
+        require.NoError(t, err, "%q", value)
+        assert.True(t, IsPerpetual(expiration), "%q", value)
+    }
+}
+
+func TestParseInvalidExpiration(t *testing.T) {
+    for _, value := range []any{"June 30, 2025", "2025-06-31", "2025-06-30T04:00", float64(1.5), true} {
+        _, err := ParseExpiration(value, nil)
+        assert.ErrorIs(t, err, ErrInvalidExpiration, "%v", value)
+
+        var expirationErr *ExpirationError
+        require.ErrorAs(t, err, &expirationErr, "%v", value)
+        assert.Equal(t, value, expirationErr.Value)
+    }
+
+    _, err := ParseExpiration("next tuesday", nil)
+    assert.EqualError(t, err, `license expiration date is not valid: "next tuesday" is not an RFC 3339 timestamp, a date like 2006-01-02, or a Unix timestamp`)
+}
+
+func TestFileClientExpiration(t *testing.T) {
+    signer := newTestSigner(t)
+    newYork, err := time.LoadLocation("America/New_York")
+    require.NoError(t, err)
+
+    expiringOn := func(value string) string {
+        license := testLicense()
+        license.Spec.Entitlements["expires_at"] = kotsv1beta1.EntitlementField{
+            Title:     "Expiration",
+            Value:     kotsv1beta1.EntitlementValue{Type: kotsv1beta1.String, StrVal: value},
+            ValueType: "String",
+        }
+        license.Spec.Signature = signer.signLicense(t, license)
+        return writeLicenseFile(t, license)
+    }
+
+    expiration, err := NewFileClient(expiringOn(""), WithKeySet(signer.keys())).GetExpirationDate()
+    require.NoError(t, err)
+    assert.True(t, IsPerpetual(expiration))
+
+    expiration, err = NewFileClient(expiringOn("2030-06-30"), WithKeySet(signer.keys()), WithExpirationLocation(newYork)).GetExpirationDate()
+    require.NoError(t, err)
+    assert.True(t, time.Date(2030, 6, 30, 4, 0, 0, 0, time.UTC).Equal(expiration))
+
+    withoutExpiration := testLicense()
+    withoutExpiration.Spec.Signature = signer.signLicense(t, withoutExpiration)
+    expiration, err = NewFileClient(writeLicenseFile(t, withoutExpiration), WithKeySet(signer.keys())).GetExpirationDate()
+    require.NoError(t, err)
+    assert.True(t, IsPerpetual(expiration))
+
+    _, err = NewFileClient(expiringOn("someday"), WithKeySet(signer.keys())).GetExpirationDate()
+    assert.ErrorIs(t, err, ErrInvalidExpiration)
+    var fieldErr *FieldError
+    require.ErrorAs(t, err, &fieldErr)
+    assert.Equal(t, "expires_at", fieldErr.Field)
+}
+
+func TestClientExpiration(t *testing.T) {
+    public, private, err := ed25519.GenerateKey(rand.Reader)
+    require.NoError(t, err)
+    sign := func(value string) string {
+        return base64.StdEncoding.EncodeToString(ed25519.Sign(private, []byte(value)))
+    }
+    responses := map[string]string{
+        "/epoch":     fmt.Sprintf(`{"name": "expires_at", "value": 1751256000, "valueType": "String", "signature": {"v3": %q}}`, sign("1751256000")),
+        "/perpetual": fmt.Sprintf(`{"name": "expires_at", "value": null, "valueType": "String", "signature": {"v3": %q}}`, sign("")),
+        "/tampered":  fmt.Sprintf(`{"name": "expires_at", "value": 1751256001, "valueType": "String", "signature": {"v3": %q}}`, sign("1751256000")),
+    }
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        response, ok := responses[strings.TrimSuffix(r.URL.Path, "/api/v1/license/fields/expires_at")]
+        if !ok {
+            w.WriteHeader(http.StatusNotFound)
+            return
+        }
+        w.Write([]byte(response))
+    }))
+    defer server.Close()
+    keys := WithKeySet(KeySet{"fixtures-ed25519": public})
+
+    expiration, err := NewClient(server.URL+"/epoch", keys).GetExpirationDate()
+    require.NoError(t, err)
+    assert.True(t, time.Date(2025, 6, 30, 4, 0, 0, 0, time.UTC).Equal(expiration))
+
+    expiration, err = NewClient(server.URL+"/perpetual", keys).GetExpirationDate()
+    require.NoError(t, err)
+    assert.True(t, IsPerpetual(expiration))
+
+    // the SDK not reporting the field isn't signed, so it isn't perpetual
+    _, err = NewClient(server.URL+"/missing", keys).GetExpirationDate()
+    assert.ErrorIs(t, err, ErrFieldNotFound)
+
+    _, err = NewClient(server.URL+"/tampered", keys).GetExpirationDate()
+    assert.ErrorIs(t, err, ErrSignatureInvalid)
+
+    // a signed expiration can be verified again without the SDK
+    expiresAt, signature, err := NewClient(server.URL+"/epoch", keys).GetSignedExpirationContext(t.Context())
+    require.NoError(t, err)
+    assert.Equal(t, "1751256000", expiresAt.Value)
+    expiration, err = VerifyExpiration(expiresAt, signature, keys)
+    require.NoError(t, err)
+    assert.True(t, time.Date(2025, 6, 30, 4, 0, 0, 0, time.UTC).Equal(expiration))
+
+    _, err = VerifyExpiration(expiresAt, signature)
+    assert.Error(t, err)
+    expiresAt.Value = "1751256001"
+    _, err = VerifyExpiration(expiresAt, signature, keys)
+    assert.ErrorIs(t, err, ErrSignatureInvalid)
+}
+
+func TestGetPerpetualLicense(t *testing.T) {
+    signer := newTestSigner(t)
+    public, private, err := ed25519.GenerateKey(rand.Reader)
+    require.NoError(t, err)
+    signature := base64.StdEncoding.EncodeToString(ed25519.Sign(private, []byte("")))
+
+    license := testLicense()
+    license.Spec.Entitlements["expires_at"] = kotsv1beta1.EntitlementField{
+        Title:     "Expiration",
+        Value:     kotsv1beta1.EntitlementValue{Type: kotsv1beta1.String, StrVal: ""},
+        ValueType: "String",
+    }
+    info := licenseInfoFor(license, signer.signLicense(t, license))
+    mux := http.NewServeMux()
+    mux.HandleFunc("GET /api/v1/license/info", func(w http.ResponseWriter, r *http.Request) {
+        json.NewEncoder(w).Encode(info)
+    })
+    mux.HandleFunc("GET /api/v1/license/fields", func(w http.ResponseWriter, r *http.Request) {
+        fmt.Fprintf(w, `{"member_count_max": %s, "enable_discourse": %s, "expires_at": {"name": "expires_at", "value": null, "valueType": "String", "signature": {"v3": %q}}}`,
+            memberCountMaxField, enableDiscourseField, signature)
+    })
+    server := httptest.NewServer(mux)
+    defer server.Close()
+    client := NewClient(server.URL, WithKeySet(signer.keys().With(KeySet{"fixtures-ed25519": public})))
+
+    verified, err := client.GetLicense()
+    require.NoError(t, err)
+    assert.Equal(t, "", verified.Entitlements["expires_at"].Value)
+
+    verifications, err := client.GetLicenseFields()
+    require.NoError(t, err)
+    require.Len(t, verifications, 3)
+    assert.Equal(t, "expires_at", verifications[1].Field.Name)
+    assert.True(t, verifications[1].Verified())
+    assert.Equal(t, "", verifications[1].Field.Value)
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+    "errors"
+    "fmt"
+    "time"
+
+    log "github.com/charmbracelet/log"
+    kotsv1beta1 "github.com/replicatedhq/kotskinds/apis/kots/v1beta1"
+    sdklicense "github.com/replicatedhq/replicated-sdk/pkg/license"
+    license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
+)
+
+// A client that reads a signed license file instead of calling the Replicated
+// SDK, for deployments that don't run the SDK. The file is read and verified
+// on every call, so a license mounted from a Secret is picked up when the
+// Secret changes. Everything in a license file is signed with the legacy MD5
+// scheme, so a client that rejects legacy signatures rejects the file.
+type FileClient struct {
+    Path string
+
+    verifier
+}
+
+// Returns a new client for the license file at the provided path
+func NewFileClient(path string, opts ...Option) *FileClient {
+    return &FileClient{Path: path, verifier: newVerifier(opts...)}
+}
+
+// Returns the complete license from the file after verifying its signature
+func (c *FileClient) GetLicense() (*License, error) {
+    signed, keyID, err := c.load()
+    if err != nil {
+        return nil, err
+    }
+    verified := newLicense(signed, nil)
+    verified.KeyID = keyID
+    return verified, nil
+}
+
+// The license file doesn't include the name of the application, so this is
+// the application slug
+func (c *FileClient) GetAppName() (string, error) {
+    return c.GetAppSlug()
+}
+
+// Returns the application slug from the license
+func (c *FileClient) GetAppSlug() (string, error) {
+    signed, _, err := c.load()
+    if err != nil {
+        return "", err
+    }
+    return signed.Spec.AppSlug, nil
+}
+
+// Returns the expiration date from the `expires_at` field in the license, or
+// the zero time if it doesn't expire. A license without the field doesn't
+// expire.
+func (c *FileClient) GetExpirationDate() (time.Time, error) {
+    field, err := c.GetLicenseField("expires_at")
+    if errors.Is(err, ErrFieldNotFound) {
+        return time.Time{}, nil
+    }
+    if err != nil {
+        return time.Time{}, err
+    }
+    return c.expiration(field)
+}
+
+// Returns a field from the license, or a `FieldError` matching
+// `ErrFieldNotFound` if the license doesn't have it
+func (c *FileClient) GetLicenseField(field string) (*license.LicenseField, error) {
+    signed, _, err := c.load()
+    if err != nil {
+        return nil, err
+    }
+    entitlement, ok := newLicense(signed, nil).Entitlements[field]
+    if !ok {
+        return nil, &FieldError{Field: field, Err: ErrFieldNotFound}
+    }
+    return &entitlement, nil
+}
+
+// Returns every field in the license. The fields in a license file are
+// covered by the signature over the whole license, so they're all verified
+// with the key that signed it or the license isn't loaded at all.
+func (c *FileClient) GetLicenseFields() ([]FieldVerification, error) {
+    signed, keyID, err := c.load()
+    if err != nil {
+        return nil, err
+    }
+    verifications := []FieldVerification{}
+    for _, field := range newLicense(signed, nil).Entitlements {
+        verifications = append(verifications, FieldVerification{Field: field, Scheme: SchemeMD5PSS, KeyID: keyID})
+    }
+    sortVerifications(verifications)
+    return verifications, nil
+}
+
+// returns the signed license and the ID of the key that signed it
+func (c *FileClient) load() (*kotsv1beta1.License, string, error) {
+    file, err := sdklicense.LoadLicenseFromPath(c.Path)
+    if err != nil {
+        log.Debug("Error loading license file", "path", c.Path, "error", err)
+        return nil, "", err
+    }
+    signed, keyID, err := c.verifyLicenseSignature(file)
+    if err != nil {
+        log.Debug("Error verifying license signature", "path", c.Path, "error", err)
+        return nil, "", err
+    }
+    if err := compareLicenseFile(file, signed); err != nil {
+        return nil, "", err
+    }
+    // the fields are covered by the signature over the whole license, which
+    // only has the V1 scheme
+    if c.rejectLegacy {
+        return nil, "", fmt.Errorf("%s is only signed with %v: %w", c.Path, SchemeMD5PSS, ErrLegacySignature)
+    }
+    return signed, keyID, nil
+}
+
+// checks the license in the file against the signed license, the same way
+// the license reported by the SDK is checked
+func compareLicenseFile(file *kotsv1beta1.License, signed *kotsv1beta1.License) error {
+    spec := file.Spec
+    info := &licenseInfo{
+        LicenseID:       spec.LicenseID,
+        AppSlug:         spec.AppSlug,
+        ChannelID:       spec.ChannelID,
+        ChannelName:     spec.ChannelName,
+        CustomerName:    spec.CustomerName,
+        CustomerEmail:   spec.CustomerEmail,
+        LicenseType:     spec.LicenseType,
+        LicenseSequence: spec.LicenseSequence,
+
+        IsAirgapSupported:              &spec.IsAirgapSupported,
+        IsGitOpsSupported:              &spec.IsGitOpsSupported,
+        IsIdentityServiceSupported:     &spec.IsIdentityServiceSupported,
+        IsGeoaxisSupported:             &spec.IsGeoaxisSupported,
+        IsSnapshotSupported:            &spec.IsSnapshotSupported,
+        IsSupportBundleUploadSupported: &spec.IsSupportBundleUploadSupported,
+        IsSemverRequired:               &spec.IsSemverRequired,
+    }
+    if err := compareLicense(info, newLicense(file, nil).Entitlements, signed); err != nil {
+        return err
+    }
+    if len(spec.Entitlements) != len(signed.Spec.Entitlements) {
+        return tampered("entitlements")
+    }
+    return nil
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    kotsv1beta1 "github.com/replicatedhq/kotskinds/apis/kots/v1beta1"
+    sdklicense "github.com/replicatedhq/replicated-sdk/pkg/license"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+    "sigs.k8s.io/yaml"
+)
+
+func writeLicenseFile(t *testing.T, license *kotsv1beta1.License) string {
+    content, err := yaml.Marshal(license)
+    require.NoError(t, err)
+    path := filepath.Join(t.TempDir(), "license.yaml")
+    require.NoError(t, os.WriteFile(path, content, 0644))
+    return path
+}
+
+func signedLicenseFile(t *testing.T, signer *testSigner) (*kotsv1beta1.License, string) {
+    license := testLicense()
+    license.Spec.Entitlements["expires_at"] = kotsv1beta1.EntitlementField{
+        Title:     "Expiration",
+        Value:     kotsv1beta1.EntitlementValue{Type: kotsv1beta1.String, StrVal: "2030-06-30T04:00:00Z"},
+        ValueType: "String",
+    }
+    license.Spec.Signature = signer.signLicense(t, license)
+    return license, writeLicenseFile(t, license)
+}
+
+func TestFileClient(t *testing.T) {
+    signer := newTestSigner(t)
+    _, path := signedLicenseFile(t, signer)
+    c := NewFileClient(path, WithKeySet(signer.keys()))
+
+    slug, err := c.GetAppSlug()
+    assert.NoError(t, err)
+    assert.Equal(t, "slackernews-mackerel", slug)
+
+    name, err := c.GetAppName()
+    assert.NoError(t, err)
+    assert.Equal(t, "slackernews-mackerel", name)
+
+    expiration, err := c.GetExpirationDate()
+    assert.NoError(t, err)
+    assert.Equal(t, time.Date(2030, 6, 30, 4, 0, 0, 0, time.UTC), expiration)
+
+    field, err := c.GetLicenseField("member_count_max")
+    assert.NoError(t, err)
+    require.NotNil(t, field)
+    assert.Equal(t, float64(100), field.Value)
+    assert.Equal(t, "Integer", field.ValueType)
+
+    field, err = c.GetLicenseField("max_member_count")
+    assert.ErrorIs(t, err, ErrFieldNotFound)
+    assert.Nil(t, field)
+
+    license, err := c.GetLicense()
+    assert.NoError(t, err)
+    assert.Equal(t, "Omozan", license.CustomerName)
+    assert.Len(t, license.Entitlements, 3)
+    assert.Equal(t, testKeyID, license.KeyID)
+
+    verifications, err := c.GetLicenseFields()
+    assert.NoError(t, err)
+    require.Len(t, verifications, 3)
+    assert.Equal(t, "enable_discourse", verifications[0].Field.Name)
+    for _, verification := range verifications {
+        assert.True(t, verification.Verified())
+        assert.Equal(t, testKeyID, verification.KeyID)
+    }
+}
+
+func TestFileClientTampered(t *testing.T) {
+    signer := newTestSigner(t)
+    license, _ := signedLicenseFile(t, signer)
+    license.Spec.LicenseType = "prod-but-better"
+    license.Spec.Entitlements["member_count_max"] = kotsv1beta1.EntitlementField{
+        Value:     kotsv1beta1.EntitlementValue{Type: kotsv1beta1.Int, IntVal: 1000},
+        ValueType: "Integer",
+    }
+    c := NewFileClient(writeLicenseFile(t, license), WithKeySet(signer.keys()))
+
+    _, err := c.GetLicenseField("member_count_max")
+    assert.ErrorIs(t, err, ErrLicenseTampered)
+}
+
+func TestFileClientRejectsLegacySignatures(t *testing.T) {
+    signer := newTestSigner(t)
+    _, path := signedLicenseFile(t, signer)
+    c := NewFileClient(path, WithKeySet(signer.keys()), RejectLegacySignatures())
+
+    _, err := c.GetLicense()
+    assert.ErrorIs(t, err, ErrLegacySignature)
+    _, err = c.GetExpirationDate()
+    assert.ErrorIs(t, err, ErrLegacySignature)
+    _, err = c.GetLicenseFields()
+    assert.ErrorIs(t, err, ErrLegacySignature)
+}
+
+func TestFileClientUnsigned(t *testing.T) {
+    license := testLicense()
+    c := NewFileClient(writeLicenseFile(t, license))
+
+    _, err := c.GetExpirationDate()
+    assert.ErrorIs(t, err, sdklicense.ErrSignatureMissing)
+}
+
+func TestFileClientMissingFile(t *testing.T) {
+    c := NewFileClient(filepath.Join(t.TempDir(), "license.yaml"))
+
+    _, err := c.GetAppSlug()
+    assert.Error(t, err)
+}
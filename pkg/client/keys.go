@@ -0,0 +1,231 @@
+package client
+
+import (
+    "crypto"
+    "crypto/ed25519"
+    _ "crypto/md5"
+    "crypto/rsa"
+    "crypto/sha256"
+    "crypto/x509"
+    "encoding/hex"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "os"
+    "sort"
+    "time"
+
+    log "github.com/charmbracelet/log"
+    sdklicense "github.com/replicatedhq/replicated-sdk/pkg/license"
+)
+
+// The ID of the Replicated key that signs license fields, compiled into the
+// enforcer
+const ReplicatedKeyID = "replicated"
+
+// The PEM header that names the key, keys without it are identified by their
+// fingerprint
+const KeyIDHeader = "Key-Id"
+
+// Public keys trusted to sign licenses and license fields, by key ID
+type KeySet map[string]crypto.PublicKey
+
+// Configures how a client verifies licenses
+type Option func(*verifier)
+
+// Rejects fields that are only signed with the legacy MD5 scheme, for once a
+// vendor's licenses have all been re-signed with a stronger scheme
+func RejectLegacySignatures() Option {
+    return func(v *verifier) {
+        v.rejectLegacy = true
+    }
+}
+
+// Trusts only the keys in the key set to sign licenses, instead of the
+// default keys
+func WithKeySet(keys KeySet) Option {
+    return func(v *verifier) {
+        if keys != nil {
+            v.keys = keys
+        }
+    }
+}
+
+// Returns the keys trusted by default: the Replicated key that signs license
+// fields, the keys the SDK trusts to sign application keys, and any keys in
+// PEM format in the `REPLICATED_PUBLIC_KEYS` environment variable, so a
+// rotated key can be trusted without rebuilding the enforcer
+func DefaultKeySet() KeySet {
+    keys := KeySet{}
+    key, err := parsePublicKey([]byte(publicKeyPEM))
+    if err != nil {
+        // the compiled-in key is always valid
+        panic(err)
+    }
+    keys[ReplicatedKeyID] = key
+
+    for id, pemBytes := range sdklicense.PublicKeys {
+        key, err := parsePublicKey(pemBytes)
+        if err != nil {
+            log.Warn("Skipping invalid SDK public key", "key", id, "error", err)
+            continue
+        }
+        keys[id] = key
+    }
+
+    if extra := os.Getenv("REPLICATED_PUBLIC_KEYS"); extra != "" {
+        configured, err := ParseKeySet([]byte(extra))
+        if err != nil {
+            log.Error("Ignoring invalid keys in REPLICATED_PUBLIC_KEYS", "error", err)
+            return keys
+        }
+        keys = keys.With(configured)
+    }
+    return keys
+}
+
+// Parses every public key in the PEM data. Each key is identified by its
+// `Key-Id` header, or by its fingerprint if it doesn't have one.
+func ParseKeySet(data []byte) (KeySet, error) {
+    keys := KeySet{}
+    for {
+        var block *pem.Block
+        block, data = pem.Decode(data)
+        if block == nil {
+            break
+        }
+        if block.Type != "PUBLIC KEY" {
+            return nil, fmt.Errorf("unexpected %s in key set, expected PUBLIC KEY", block.Type)
+        }
+        key, err := x509.ParsePKIXPublicKey(block.Bytes)
+        if err != nil {
+            return nil, fmt.Errorf("parse public key: %w", err)
+        }
+        id, ok := block.Headers[KeyIDHeader]
+        if !ok {
+            id = fingerprint(block.Bytes)
+        }
+        if _, exists := keys[id]; exists {
+            return nil, fmt.Errorf("duplicate key ID %s in key set", id)
+        }
+        keys[id] = key
+    }
+    if len(keys) == 0 {
+        return nil, errors.New("no public keys found")
+    }
+    return keys, nil
+}
+
+// Reads a key set from a file of PEM encoded public keys
+func LoadKeySet(path string) (KeySet, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    keys, err := ParseKeySet(data)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    return keys, nil
+}
+
+// Returns a new key set with the keys from both sets, keys in the other set
+// replace keys with the same ID
+func (k KeySet) With(other KeySet) KeySet {
+    keys := KeySet{}
+    for id, key := range k {
+        keys[id] = key
+    }
+    for id, key := range other {
+        keys[id] = key
+    }
+    return keys
+}
+
+// Returns the ID of the first key, in key ID order, that verifies the
+// signature over the message with the scheme
+func (k KeySet) verify(scheme Scheme, message []byte, signature []byte) (string, error) {
+    ids := make([]string, 0, len(k))
+    for id := range k {
+        ids = append(ids, id)
+    }
+    sort.Strings(ids)
+
+    for _, id := range ids {
+        if err := verifyWithKey(k[id], scheme, message, signature); err == nil {
+            return id, nil
+        }
+    }
+    return "", ErrSignatureInvalid
+}
+
+func verifyWithKey(key crypto.PublicKey, scheme Scheme, message []byte, signature []byte) error {
+    if scheme == SchemeEd25519 {
+        publicKey, ok := key.(ed25519.PublicKey)
+        if !ok {
+            return fmt.Errorf("%v signature needs an Ed25519 key, not %T", scheme, key)
+        }
+        if !ed25519.Verify(publicKey, message, signature) {
+            return ErrSignatureInvalid
+        }
+        return nil
+    }
+
+    publicKey, ok := key.(*rsa.PublicKey)
+    if !ok {
+        return fmt.Errorf("%v signature needs an RSA key, not %T", scheme, key)
+    }
+    var newHash crypto.Hash
+    switch scheme {
+    case SchemeMD5PSS:
+        newHash = crypto.MD5
+    case SchemeSHA256PSS:
+        newHash = crypto.SHA256
+    default:
+        return fmt.Errorf("unsupported signature scheme %v", scheme)
+    }
+    pssh := newHash.New()
+    pssh.Write(message)
+    hashed := pssh.Sum(nil)
+
+    return rsa.VerifyPSS(publicKey, newHash, hashed, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+}
+
+func parsePublicKey(pemBytes []byte) (crypto.PublicKey, error) {
+    block, _ := pem.Decode(pemBytes)
+    if block == nil {
+        return nil, errors.New("no PEM data found")
+    }
+    return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func fingerprint(der []byte) string {
+    sum := sha256.Sum256(der)
+    return hex.EncodeToString(sum[:8])
+}
+
+// verifies licenses and fields against the trusted keys and reads what
+// they say, shared by the clients
+type verifier struct {
+    keys               KeySet
+    rejectLegacy       bool
+    expirationLocation *time.Location
+}
+
+func newVerifier(opts ...Option) verifier {
+    v := verifier{}
+    for _, opt := range opts {
+        opt(&v)
+    }
+    if v.keys == nil {
+        v.keys = DefaultKeySet()
+    }
+    return v
+}
+
+func (v *verifier) trusted() KeySet {
+    if v.keys == nil {
+        return DefaultKeySet()
+    }
+    return v.keys
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+    "crypto/ed25519"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/pem"
+    "os"
+    "path/filepath"
+    "testing"
+
+    license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func encodeKey(t *testing.T, key *rsa.PrivateKey, id string) []byte {
+    der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+    require.NoError(t, err)
+    block := &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+    if id != "" {
+        block.Headers = map[string]string{KeyIDHeader: id}
+    }
+    return pem.EncodeToMemory(block)
+}
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    require.NoError(t, err)
+    return key
+}
+
+func TestParseKeySet(t *testing.T) {
+    named := generateKey(t)
+    unnamed := generateKey(t)
+    data := append(encodeKey(t, named, "fixtures-2026"), encodeKey(t, unnamed, "")...)
+
+    keys, err := ParseKeySet(data)
+    require.NoError(t, err)
+    require.Len(t, keys, 2)
+    assert.Equal(t, &named.PublicKey, keys["fixtures-2026"])
+
+    der, _ := x509.MarshalPKIXPublicKey(&unnamed.PublicKey)
+    assert.Equal(t, &unnamed.PublicKey, keys[fingerprint(der)])
+}
+
+func TestParseEd25519Key(t *testing.T) {
+    public, _, err := ed25519.GenerateKey(rand.Reader)
+    require.NoError(t, err)
+    der, err := x509.MarshalPKIXPublicKey(public)
+    require.NoError(t, err)
+    data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Headers: map[string]string{KeyIDHeader: "fixtures-ed25519"}, Bytes: der})
+
+    keys, err := ParseKeySet(data)
+    require.NoError(t, err)
+    assert.Equal(t, public, keys["fixtures-ed25519"])
+}
+
+func TestParseInvalidKeySets(t *testing.T) {
+    key := generateKey(t)
+    duplicate := append(encodeKey(t, key, "fixtures"), encodeKey(t, generateKey(t), "fixtures")...)
+    private := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+    for _, data := range [][]byte{nil, []byte("not a key"), duplicate, private} {
+        _, err := ParseKeySet(data)
+        assert.Error(t, err)
+    }
+}
+
+func TestLoadKeySet(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "keys.pem")
+    require.NoError(t, os.WriteFile(path, encodeKey(t, generateKey(t), "fixtures"), 0644))
+
+    keys, err := LoadKeySet(path)
+    require.NoError(t, err)
+    assert.Contains(t, keys, "fixtures")
+
+    _, err = LoadKeySet(filepath.Join(t.TempDir(), "missing.pem"))
+    assert.Error(t, err)
+}
+
+func TestDefaultKeySet(t *testing.T) {
+    keys := DefaultKeySet()
+    assert.Contains(t, keys, ReplicatedKeyID)
+    assert.Contains(t, keys, "bdee56560cfb43c9b28bf98eacafa646")
+
+    t.Setenv("REPLICATED_PUBLIC_KEYS", string(encodeKey(t, generateKey(t), "rotated")))
+    keys = DefaultKeySet()
+    assert.Contains(t, keys, ReplicatedKeyID)
+    assert.Contains(t, keys, "rotated")
+
+    t.Setenv("REPLICATED_PUBLIC_KEYS", "not a key")
+    keys = DefaultKeySet()
+    assert.Contains(t, keys, ReplicatedKeyID)
+}
+
+func TestFieldSignedWithOwnKey(t *testing.T) {
+    key := generateKey(t)
+    field := &license.LicenseField{
+        Name:      "seats",
+        Value:     float64(25),
+        ValueType: "Integer",
+        Signature: license.LicenseFieldSignature{
+            V1: base64.StdEncoding.EncodeToString(signMessage(t, key, []byte("25"))),
+        },
+    }
+
+    c := NewClient("http://replicated:3000", WithKeySet(DefaultKeySet().With(KeySet{"fixtures": &key.PublicKey})))
+    keyID, err := c.VerifyLicenseField(field)
+    assert.NoError(t, err)
+    assert.Equal(t, "fixtures", keyID)
+
+    _, err = NewClient("http://replicated:3000").VerifyLicenseField(field)
+    assert.Error(t, err)
+}
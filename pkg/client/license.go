@@ -1,95 +1,395 @@
 package client
 
 import (
+    "context"
     "fmt"
     "time"
     "encoding/json"
-    "crypto"
-    "crypto/rsa"
-    "crypto/x509"
     "encoding/base64"
-    "encoding/pem"
+    "net/http"
+    "sort"
 
     log "github.com/charmbracelet/log"
+    kotsv1beta1 "github.com/replicatedhq/kotskinds/apis/kots/v1beta1"
     license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
 )
 
+// A complete license, as it was signed by the vendor
+type License struct {
+    LicenseID       string `json:"licenseID"`
+    AppSlug         string `json:"appSlug"`
+    ChannelID       string `json:"channelID,omitempty"`
+    ChannelName     string `json:"channelName"`
+    CustomerName    string `json:"customerName"`
+    CustomerEmail   string `json:"customerEmail,omitempty"`
+    LicenseType     string `json:"licenseType"`
+    LicenseSequence int64  `json:"licenseSequence,omitempty"`
+
+    IsAirgapSupported              bool `json:"isAirgapSupported"`
+    IsGitOpsSupported              bool `json:"isGitOpsSupported"`
+    IsIdentityServiceSupported     bool `json:"isIdentityServiceSupported"`
+    IsGeoaxisSupported             bool `json:"isGeoaxisSupported"`
+    IsSnapshotSupported            bool `json:"isSnapshotSupported"`
+    IsSupportBundleUploadSupported bool `json:"isSupportBundleUploadSupported"`
+    IsSemverRequired               bool `json:"isSemverRequired"`
+
+    Entitlements map[string]license.LicenseField `json:"entitlements"`
+
+    // The trusted key that signed the license
+    KeyID string `json:"keyID,omitempty"`
+}
+
+// The license as reported by the SDK, fields the SDK doesn't report are left
+// empty and aren't compared to the signed license
+type licenseInfo struct {
+    LicenseID       string `json:"licenseID"`
+    AppSlug         string `json:"appSlug"`
+    ChannelID       string `json:"channelID"`
+    ChannelName     string `json:"channelName"`
+    CustomerName    string `json:"customerName"`
+    CustomerEmail   string `json:"customerEmail"`
+    LicenseType     string `json:"licenseType"`
+    LicenseSequence int64  `json:"licenseSequence"`
+
+    IsAirgapSupported              *bool `json:"isAirgapSupported"`
+    IsGitOpsSupported              *bool `json:"isGitOpsSupported"`
+    IsIdentityServiceSupported     *bool `json:"isIdentityServiceSupported"`
+    IsGeoaxisSupported             *bool `json:"isGeoaxisSupported"`
+    IsSnapshotSupported            *bool `json:"isSnapshotSupported"`
+    IsSupportBundleUploadSupported *bool `json:"isSupportBundleUploadSupported"`
+    IsSemverRequired               *bool `json:"isSemverRequired"`
+
+    Signature []byte `json:"signature"`
+}
+
+// Returns the complete license with all of its entitlements. The signature
+// over the whole license is verified, as is each entitlement, and the license
+// is only returned if what the SDK reports matches what was signed.
+func (c *Client) GetLicense() (*License, error) {
+    return c.GetLicenseContext(context.Background())
+}
+
+// Returns the complete, verified license, abandoning the requests when the
+// context is done
+func (c *Client) GetLicenseContext(ctx context.Context) (*License, error) {
+    var info licenseInfo
+    if err := c.getJSON(ctx, "/api/v1/license/info", &info); err != nil {
+        return nil, err
+    }
+    reported := map[string]fieldResponse{}
+    if err := c.getJSON(ctx, "/api/v1/license/fields", &reported); err != nil {
+        return nil, err
+    }
+    fields := license.LicenseFields{}
+    for name, response := range reported {
+        field := signedField(name, response.field())
+        if _, err := c.VerifyFieldSignature(&field, response.Signature); err != nil {
+            return nil, &FieldError{Field: name, Err: err}
+        }
+        fields[name] = field
+    }
+
+    signed, keyID, err := c.verifyLicenseSignature(&kotsv1beta1.License{Spec: kotsv1beta1.LicenseSpec{Signature: info.Signature}})
+    if err != nil {
+        log.Debug("Error verifying license signature", "error", err)
+        return nil, err
+    }
+    if err := compareLicense(&info, fields, signed); err != nil {
+        return nil, err
+    }
+    verified := newLicense(signed, fields)
+    verified.KeyID = keyID
+    return verified, nil
+}
+
+// The outcome of verifying a single license field
+type FieldVerification struct {
+    Field  license.LicenseField
+    Scheme Scheme
+    KeyID  string
+    Err    error
+}
+
+// Returns true when the field's signature was verified
+func (v FieldVerification) Verified() bool {
+    return v.Err == nil
+}
+
+// Returns every field in the license with the outcome of verifying it. Fields
+// that fail verification are included with the error, so the license can be
+// inspected even when part of it can't be trusted.
+func (c *Client) GetLicenseFields() ([]FieldVerification, error) {
+    return c.GetLicenseFieldsContext(context.Background())
+}
+
+// Returns every field in the license with the outcome of verifying it,
+// abandoning the request when the context is done
+func (c *Client) GetLicenseFieldsContext(ctx context.Context) ([]FieldVerification, error) {
+    reported := map[string]fieldResponse{}
+    if err := c.getJSON(ctx, "/api/v1/license/fields", &reported); err != nil {
+        return nil, err
+    }
+    verifications := []FieldVerification{}
+    for name, response := range reported {
+        field := signedField(name, response.field())
+        if field.Name == "" {
+            field.Name = name
+        }
+        scheme, _ := response.Signature.strongest()
+        keyID, err := c.VerifyFieldSignature(&field, response.Signature)
+        if err != nil {
+            err = &FieldError{Field: name, Err: err}
+        }
+        verifications = append(verifications, FieldVerification{Field: field, Scheme: scheme, KeyID: keyID, Err: err})
+    }
+    sortVerifications(verifications)
+    return verifications, nil
+}
+
+func sortVerifications(verifications []FieldVerification) {
+    sort.Slice(verifications, func(i, j int) bool {
+        return verifications[i].Field.Name < verifications[j].Field.Name
+    })
+}
+
+func (c *Client) getJSON(ctx context.Context, url string, value any) error {
+    response, err := c.makeRequestContext(ctx, "GET", url, nil)
+    if err != nil {
+        log.Debug("Error calling Replicated SDK", "error", err)
+        return err
+    }
+    defer response.Body.Close()
+    if response.StatusCode != http.StatusOK {
+        return &RequestError{URL: url, StatusCode: response.StatusCode}
+    }
+    if err := json.NewDecoder(response.Body).Decode(value); err != nil {
+        log.Debug("Error decoding API response", "error", err)
+        return err
+    }
+    return nil
+}
+
+// checks that the license reported by the SDK is the license that was signed
+func compareLicense(info *licenseInfo, fields license.LicenseFields, signed *kotsv1beta1.License) error {
+    values := []struct{ name, reported, signed string }{
+        {"licenseID", info.LicenseID, signed.Spec.LicenseID},
+        {"appSlug", info.AppSlug, signed.Spec.AppSlug},
+        {"channelID", info.ChannelID, signed.Spec.ChannelID},
+        {"channelName", info.ChannelName, signed.Spec.ChannelName},
+        {"customerName", info.CustomerName, signed.Spec.CustomerName},
+        {"customerEmail", info.CustomerEmail, signed.Spec.CustomerEmail},
+        {"licenseType", info.LicenseType, signed.Spec.LicenseType},
+    }
+    for _, field := range values {
+        if field.reported != "" && field.reported != field.signed {
+            return tampered(field.name)
+        }
+    }
+    if info.LicenseSequence != 0 && info.LicenseSequence != signed.Spec.LicenseSequence {
+        return tampered("licenseSequence")
+    }
+
+    flags := []struct{ name string; reported *bool; signed bool }{
+        {"isAirgapSupported", info.IsAirgapSupported, signed.Spec.IsAirgapSupported},
+        {"isGitOpsSupported", info.IsGitOpsSupported, signed.Spec.IsGitOpsSupported},
+        {"isIdentityServiceSupported", info.IsIdentityServiceSupported, signed.Spec.IsIdentityServiceSupported},
+        {"isGeoaxisSupported", info.IsGeoaxisSupported, signed.Spec.IsGeoaxisSupported},
+        {"isSnapshotSupported", info.IsSnapshotSupported, signed.Spec.IsSnapshotSupported},
+        {"isSupportBundleUploadSupported", info.IsSupportBundleUploadSupported, signed.Spec.IsSupportBundleUploadSupported},
+        {"isSemverRequired", info.IsSemverRequired, signed.Spec.IsSemverRequired},
+    }
+    for _, flag := range flags {
+        if flag.reported != nil && *flag.reported != flag.signed {
+            return tampered(flag.name)
+        }
+    }
+
+    for name, field := range fields {
+        entitlement, ok := signed.Spec.Entitlements[name]
+        if !ok {
+            return &TamperedError{Field: "entitlement " + name, Reason: "is not in the signed license"}
+        }
+        if field.ValueType != entitlement.ValueType || fmt.Sprint(field.Value) != fmt.Sprint(entitlementValue(entitlement)) {
+            return tampered("entitlements." + name)
+        }
+    }
+    return nil
+}
+
+func tampered(field string) error {
+    return &TamperedError{Field: field, Reason: "does not match the signed license"}
+}
+
+// returns the value of an entitlement the way the SDK reports it, with
+// integers as floats since they're decoded from JSON
+func entitlementValue(entitlement kotsv1beta1.EntitlementField) any {
+    value := entitlement.Value.Value()
+    if integer, ok := value.(int64); ok {
+        return float64(integer)
+    }
+    return value
+}
+
+func newLicense(signed *kotsv1beta1.License, fields license.LicenseFields) *License {
+    spec := signed.Spec
+    entitlements := map[string]license.LicenseField{}
+    for name, entitlement := range spec.Entitlements {
+        entitlements[name] = license.LicenseField{
+            Name:        name,
+            Title:       entitlement.Title,
+            Description: entitlement.Description,
+            Value:       entitlementValue(entitlement),
+            ValueType:   entitlement.ValueType,
+            IsHidden:    entitlement.IsHidden,
+            Signature:   fields[name].Signature,
+        }
+    }
+
+    return &License{
+        LicenseID:       spec.LicenseID,
+        AppSlug:         spec.AppSlug,
+        ChannelID:       spec.ChannelID,
+        ChannelName:     spec.ChannelName,
+        CustomerName:    spec.CustomerName,
+        CustomerEmail:   spec.CustomerEmail,
+        LicenseType:     spec.LicenseType,
+        LicenseSequence: spec.LicenseSequence,
+
+        IsAirgapSupported:              spec.IsAirgapSupported,
+        IsGitOpsSupported:              spec.IsGitOpsSupported,
+        IsIdentityServiceSupported:     spec.IsIdentityServiceSupported,
+        IsGeoaxisSupported:             spec.IsGeoaxisSupported,
+        IsSnapshotSupported:            spec.IsSnapshotSupported,
+        IsSupportBundleUploadSupported: spec.IsSupportBundleUploadSupported,
+        IsSemverRequired:               spec.IsSemverRequired,
+
+        Entitlements: entitlements,
+    }
+}
+
 // Return the expiration date for the license as a date field since it's
 // a special case of the fields in the license
 func (c *Client) GetExpirationDate() (time.Time, error) {
-    expiresAt, err := c.GetLicenseField("expires_at")
+    return c.GetExpirationDateContext(context.Background())
+}
+
+// Returns the expiration date for the license, or the zero time if it doesn't
+// expire, abandoning the request when the context is done. A license with an
+// empty `expires_at` field doesn't expire, but one the SDK reports without the
+// field at all fails with `ErrFieldNotFound` since that answer isn't signed.
+func (c *Client) GetExpirationDateContext(ctx context.Context) (time.Time, error) {
+    expiresAt, _, err := c.GetSignedExpirationContext(ctx)
     if err != nil {
       return time.Time{}, err
     }
-    value := expiresAt.Value.(string)
-    expirationDate, err := time.Parse(time.RFC3339, value)
+    return c.expiration(expiresAt)
+}
 
-    return expirationDate, nil 
+// Returns the verified `expires_at` field with the value as it was signed and
+// every version of its signature, so it can be saved and verified again
+// later with `VerifyExpiration`
+func (c *Client) GetSignedExpirationContext(ctx context.Context) (*license.LicenseField, FieldSignature, error) {
+    response, err := c.fetchField(ctx, "expires_at")
+    if err != nil {
+      return nil, FieldSignature{}, err
+    }
+    expiresAt := signedExpiration(response.field())
+    if _, err := c.VerifyFieldSignature(&expiresAt, response.Signature); err != nil {
+      log.Debug("Error verifying license field", "error", err)
+      return nil, FieldSignature{}, &FieldError{Field: expiresAt.Name, Err: err}
+    }
+    return &expiresAt, response.Signature, nil
 }
 
 // GetLicenseField fetches a field from the license by name, and returns it only
 // if it's valid
 func (c *Client) GetLicenseField(field string) (*license.LicenseField, error) {
-    response, err := c.makeRequest("GET", fmt.Sprintf("/api/v1/license/fields/%s", field) , nil)
+    return c.GetLicenseFieldContext(context.Background(), field)
+}
+
+// Fetches and verifies a field from the license, abandoning the request when
+// the context is done
+func (c *Client) GetLicenseFieldContext(ctx context.Context, field string) (*license.LicenseField, error) {
+    response, err := c.fetchField(ctx, field)
+    if err != nil {
+        return nil, err
+    }
+    licenseField := signedField(field, response.field())
+    if _, err := c.VerifyFieldSignature(&licenseField, response.Signature); err != nil {
+        log.Debug("Error verifying license field", "error", err)
+        return nil, &FieldError{Field: field, Err: err}
+    }
+    return &licenseField, nil
+}
+
+// fetches a field from the SDK without verifying it
+func (c *Client) fetchField(ctx context.Context, field string) (*fieldResponse, error) {
+    url := fmt.Sprintf("/api/v1/license/fields/%s", field)
+    response, err := c.makeRequestContext(ctx, "GET", url, nil)
     if err != nil {
         log.Debug("Error calling Replicated SDK", "error", err)
         return nil, err
     }
     defer response.Body.Close()
+    if response.StatusCode == http.StatusNotFound {
+        return nil, &FieldError{Field: field, Err: ErrFieldNotFound}
+    }
+    if response.StatusCode != http.StatusOK {
+        return nil, &RequestError{URL: url, StatusCode: response.StatusCode}
+    }
 
-    var licenseField license.LicenseField
-    if err := json.NewDecoder(response.Body).Decode(&licenseField); err != nil {
+    fieldResponse := &fieldResponse{}
+    if err := json.NewDecoder(response.Body).Decode(fieldResponse); err != nil {
         log.Debug("Error decoding API response", "error", err)
         return nil, err
     }
-    if err := c.verifyLicenseField(&licenseField); err != nil {
-        log.Debug("Error verifying license field", "error", err)
-        return nil, err
-    }
-    return &licenseField, nil
+    return fieldResponse, nil
 }
 
-func (c *Client) verifyLicenseField(field *license.LicenseField) (error) {
-    log.Debug("Verifying license field", "field", field.Name, "type", field.ValueType, "value", field.Value)
-    value := ""
-    ok := true
-
-    switch(field.ValueType) {
-    case "String", "Text":
-      value, ok = field.Value.(string)
-      if !ok {
-        return fmt.Errorf("%s value is not a valid int, license may have been tampered with", field.ValueType)
-      }
-    case "Integer":
-      value = fmt.Sprintf("%d", int(field.Value.(float64)))
-      log.Debug("String value", "value", value)
-    case "Boolean":
-      value = fmt.Sprintf("%t", field.Value.(bool))
-    }
-    signature := field.Signature.V1
-
-    pubBlock, _ := pem.Decode([]byte(publicKeyPEM))
-    publicKey, err := x509.ParsePKIXPublicKey(pubBlock.Bytes)
-    if err != nil {
-        return fmt.Errorf("parse public key PEM: %w", err)
-    }
+// a license field as the SDK returns it, with every version of its signature
+// since the SDK's type only has the first
+type fieldResponse struct {
+    license.LicenseField
+    Signature FieldSignature `json:"signature"`
+}
 
-    var opts rsa.PSSOptions
-    opts.SaltLength = rsa.PSSSaltLengthAuto
+func (r fieldResponse) field() license.LicenseField {
+    field := r.LicenseField
+    field.Signature = license.LicenseFieldSignature{V1: r.Signature.V1}
+    return field
+}
 
-    newHash := crypto.MD5
-    pssh := newHash.New()
-    pssh.Write([]byte(value))
-    hashed := pssh.Sum(nil)
+// Verifies the V1 signature on a license field against the trusted keys and
+// returns the ID of the key that signed it
+func (v *verifier) VerifyLicenseField(field *license.LicenseField) (string, error) {
+    return v.VerifyFieldSignature(field, FieldSignature{V1: field.Signature.V1})
+}
 
-    decodedSignature, err := base64.StdEncoding.DecodeString(signature)
+// Verifies the strongest signature in the envelope against the trusted keys
+// and returns the ID of the key that signed the field
+func (v *verifier) VerifyFieldSignature(field *license.LicenseField, signature FieldSignature) (string, error) {
+    log.Debug("Verifying license field", "field", field.Name, "type", field.ValueType, "value", field.Value)
+    value, err := canonicalValue(field)
     if err != nil {
-        return fmt.Errorf("decode signature: %w", err)
+        return "", err
     }
 
-    if err := rsa.VerifyPSS(publicKey.(*rsa.PublicKey), newHash, hashed, decodedSignature, &opts); err != nil {
-        return fmt.Errorf("verify PSS: %w", err)
+    scheme, encoded := signature.strongest()
+    if scheme == 0 {
+        return "", fmt.Errorf("%s: %w", field.Name, ErrSignatureMissing)
+    }
+    if scheme == SchemeMD5PSS && v.rejectLegacy {
+        return "", fmt.Errorf("%s: %w", field.Name, ErrLegacySignature)
+    }
+    decodedSignature, err := base64.StdEncoding.DecodeString(encoded)
+    if err != nil {
+        return "", fmt.Errorf("decode signature: %w", err)
     }
 
-    return nil
+    keyID, err := v.trusted().verify(scheme, []byte(value), decodedSignature)
+    if err != nil {
+        return "", fmt.Errorf("verify %v: %w", scheme, err)
+    }
+    log.Debug("License field verified", "field", field.Name, "scheme", scheme, "key", keyID)
+    return keyID, nil
 }
@@ -1,6 +1,9 @@
 package client
 
 import (
+    "encoding/json"
+    "fmt"
+    "strings"
     "time"
     "net/http"
     "net/http/httptest"
@@ -8,6 +11,9 @@ import (
 
     "github.com/stretchr/testify/assert"
     "github.com/stretchr/testify/require"
+    kotsv1beta1 "github.com/replicatedhq/kotskinds/apis/kots/v1beta1"
+    sdklicense "github.com/replicatedhq/replicated-sdk/pkg/license"
+    license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
 
 )
 
@@ -121,6 +127,25 @@ func TestValidExpiresAt(t *testing.T) {
     assert.Equal(t, "UaixeEq1y4C8bVy5xa3dAmGrNS0IdVAWlbJR+p/gsVv3XyeFhEVrHufJxUSKu7hiO/GewtsP8Bv8Cj5mlOnGye/OG4SVhSxSP6gp8yRDiHT0uFnng6eWDqoai3MI9E/GqiUnSgN5ezhN5SdR11KoXm1oGN+YOoPC12rviR8I4jWv9A5Hxv6RSrQUeTUgemw8KweNcT5zXQdmv6xL24dQnnHN9DhiXFxy4nc6ib6qyR8wI7doU2D/xujQIzIcbA7rE1UkUsXSvdRII4EqSiyfz1UDMjerHj3SvG7XSRPLIgr2sXzuXKBP3CgTVBUlKoZ6sPcMSAlutnxEBlNMWHzpfQ==", expiresAt.Signature.V1)
 }
 
+func TestFieldVerifiedKey(t *testing.T) {
+    c := NewClient("http://replicated:3000")
+    field := &license.LicenseField{
+        Name:      "member_count_max",
+        Value:     float64(100),
+        ValueType: "Integer",
+        Signature: license.LicenseFieldSignature{V1: "yMGjD6CcXwnSpqKbWkTdypp319TDkyZJYtr1SOsMDfGN3FAu0XsK+jPgqvuWQcWeDhI31zhjp3305bSgouxLlYCku398/vYLJ5dlZBlfBmzbWMc7yxKE5lyW+PWu6f9KZpw+0uYnQn47t3/5pMvcpk9SVYKjRkmRGKV5kdkPq0SByjcAZFSfO4hLd+Y2zFJB1rLb1z9xKtjPikrwOC2uGEI7pKhkLNmUcgvSyGAPa11xCYbXDIDF3AEMBD5uEwvI9XdfIWmwUvpH7XMPq1SkenMPsSRat4aBx7x+fqqUA7pU5MncoH0ATfd6sC9fv/vj7ZqIvNdZjA3AL1fn+qBdBQ=="},
+    }
+
+    keyID, err := c.VerifyLicenseField(field)
+    assert.NoError(t, err)
+    assert.Equal(t, ReplicatedKeyID, keyID)
+
+    // a client that doesn't trust the Replicated key rejects the field
+    c = NewClient("http://replicated:3000", WithKeySet(KeySet{}))
+    _, err = c.VerifyLicenseField(field)
+    assert.Error(t, err)
+}
+
 func TestTamperedExpiresAt(t *testing.T) {
     mockExpiresAtField := `{
         "name": "expires_at",
@@ -175,3 +200,135 @@ func TestValidExpirationDate(t *testing.T) {
     assert.NoError(t, err)
     assert.Equal(t, time.Date(2025, 6, 30, 4, 0, 0, 0, time.UTC), expirationDate) 
 }
+
+const (
+    memberCountMaxField = `{
+      "name": "member_count_max",
+      "title": "Max Member Count",
+      "value": 100,
+      "valueType": "Integer",
+      "signature": {
+        "v1": "yMGjD6CcXwnSpqKbWkTdypp319TDkyZJYtr1SOsMDfGN3FAu0XsK+jPgqvuWQcWeDhI31zhjp3305bSgouxLlYCku398/vYLJ5dlZBlfBmzbWMc7yxKE5lyW+PWu6f9KZpw+0uYnQn47t3/5pMvcpk9SVYKjRkmRGKV5kdkPq0SByjcAZFSfO4hLd+Y2zFJB1rLb1z9xKtjPikrwOC2uGEI7pKhkLNmUcgvSyGAPa11xCYbXDIDF3AEMBD5uEwvI9XdfIWmwUvpH7XMPq1SkenMPsSRat4aBx7x+fqqUA7pU5MncoH0ATfd6sC9fv/vj7ZqIvNdZjA3AL1fn+qBdBQ=="
+      }
+    }`
+    enableDiscourseField = `{
+      "name": "enable_discourse",
+      "title": "Enable Discourse (alpha)",
+      "value": true,
+      "valueType": "Boolean",
+      "signature": {
+        "v1": "n0BkylfyJ6TYngkJIDMUqh51nw9hDHkA/HKoNd8uE6ADM3E5hW+HdxRHQJaHRbtoYwdwAiF+IrSGdzHuIy1E7KXFvebmNd/5WIdUrWGHjFnzjO3aAoeMZhZC0hyLiBuD4Wfg21p/pf0y5OJav9rGc0G+gablBQ539Okl2jGdOLBSSZrhqYyweaLCsXHkNn7o1Zagl0B9nW7s25juZmNOybAhj6/Yf/8+Lc9CfvE+WM/Q9nE7aT53v65ogkyjenhhJ1+rt2pmrtwMKAgNQQn0U+jGe1nxVv36prLWO5Ncy0Zb3LWtr9va+pgKP0GBUHvC2xqpR7JWBndkrDd72LjZjw=="
+      }
+    }`
+)
+
+// serves the license info and fields the way the SDK does
+func licenseServer(t *testing.T, info map[string]any) *httptest.Server {
+    mux := http.NewServeMux()
+    mux.HandleFunc("GET /api/v1/license/info", func(w http.ResponseWriter, r *http.Request) {
+        json.NewEncoder(w).Encode(info)
+    })
+    mux.HandleFunc("GET /api/v1/license/fields", func(w http.ResponseWriter, r *http.Request) {
+        fmt.Fprintf(w, `{"member_count_max": %s, "enable_discourse": %s}`, memberCountMaxField, enableDiscourseField)
+    })
+    server := httptest.NewServer(mux)
+    t.Cleanup(server.Close)
+    return server
+}
+
+func licenseInfoFor(license *kotsv1beta1.License, signature []byte) map[string]any {
+    return map[string]any{
+        "licenseID":         license.Spec.LicenseID,
+        "channelName":       license.Spec.ChannelName,
+        "customerName":      license.Spec.CustomerName,
+        "customerEmail":     license.Spec.CustomerEmail,
+        "licenseType":       license.Spec.LicenseType,
+        "isAirgapSupported": license.Spec.IsAirgapSupported,
+        "signature":         signature,
+    }
+}
+
+func TestGetLicense(t *testing.T) {
+    signer := newTestSigner(t)
+    license := testLicense()
+    server := licenseServer(t, licenseInfoFor(license, signer.signLicense(t, license)))
+
+    verified, err := NewClient(server.URL, WithKeySet(signer.keys())).GetLicense()
+    require.NoError(t, err)
+    assert.Equal(t, "2ZgCQ4d6aUJMbGCvbMKoYVk7Yxn", verified.LicenseID)
+    assert.Equal(t, "slackernews-mackerel", verified.AppSlug)
+    assert.Equal(t, "Stable", verified.ChannelName)
+    assert.Equal(t, "2ZgCRFWKnQEBNsuAHlq7RXBLZqT", verified.ChannelID)
+    assert.Equal(t, "Omozan", verified.CustomerName)
+    assert.Equal(t, "prod", verified.LicenseType)
+    assert.Equal(t, int64(3), verified.LicenseSequence)
+    assert.True(t, verified.IsAirgapSupported)
+    assert.False(t, verified.IsGitOpsSupported)
+
+    require.Len(t, verified.Entitlements, 2)
+    assert.Equal(t, float64(100), verified.Entitlements["member_count_max"].Value)
+    assert.Equal(t, true, verified.Entitlements["enable_discourse"].Value)
+    assert.NotEmpty(t, verified.Entitlements["enable_discourse"].Signature.V1)
+    assert.Equal(t, testKeyID, verified.KeyID)
+}
+
+func TestGetLicenseTampered(t *testing.T) {
+    signer := newTestSigner(t)
+    license := testLicense()
+    signature := signer.signLicense(t, license)
+
+    for field, value := range map[string]any{
+        "customerName": "Someone Else",
+        "licenseType": "trial",
+        "channelName": "Beta",
+        "isAirgapSupported": false,
+    } {
+        info := licenseInfoFor(license, signature)
+        info[field] = value
+        server := licenseServer(t, info)
+
+        _, err := NewClient(server.URL, WithKeySet(signer.keys())).GetLicense()
+        assert.ErrorContains(t, err, field)
+    }
+}
+
+func TestGetLicenseTamperedEntitlement(t *testing.T) {
+    license := testLicense()
+    license.Spec.Entitlements["member_count_max"] = kotsv1beta1.EntitlementField{
+        Value:     kotsv1beta1.EntitlementValue{Type: kotsv1beta1.Int, IntVal: 10},
+        ValueType: "Integer",
+    }
+    signer := newTestSigner(t)
+    server := licenseServer(t, licenseInfoFor(license, signer.signLicense(t, license)))
+
+    _, err := NewClient(server.URL, WithKeySet(signer.keys())).GetLicense()
+    assert.ErrorContains(t, err, "member_count_max")
+}
+
+func TestGetLicenseMissingSignature(t *testing.T) {
+    server := licenseServer(t, licenseInfoFor(testLicense(), nil))
+
+    _, err := NewClient(server.URL).GetLicense()
+    assert.ErrorIs(t, err, sdklicense.ErrSignatureMissing)
+}
+
+func TestGetLicenseFields(t *testing.T) {
+    tamperedField := strings.Replace(memberCountMaxField, `"value": 100`, `"value": 1000`, 1)
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        fmt.Fprintf(w, `{"member_count_max": %s, "enable_discourse": %s}`, tamperedField, enableDiscourseField)
+    }))
+    defer server.Close()
+
+    verifications, err := NewClient(server.URL).GetLicenseFields()
+    require.NoError(t, err)
+    require.Len(t, verifications, 2)
+
+    assert.Equal(t, "enable_discourse", verifications[0].Field.Name)
+    assert.True(t, verifications[0].Verified())
+    assert.Equal(t, SchemeMD5PSS, verifications[0].Scheme)
+    assert.Equal(t, ReplicatedKeyID, verifications[0].KeyID)
+
+    assert.Equal(t, "member_count_max", verifications[1].Field.Name)
+    assert.False(t, verifications[1].Verified())
+    assert.ErrorIs(t, verifications[1].Err, ErrSignatureInvalid)
+}
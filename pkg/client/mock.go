@@ -54,6 +54,7 @@ func (m *MockAPIClient) GetAppSlug() (string, error) {
 }
 
 func (m *MockAPIClient) GetLicenseField(field string) (*license.LicenseField, error) {
-    args := m.Called()
-    return args.Get(0).(*license.LicenseField), args.Error(1)
+    args := m.Called(field)
+    licenseField, _ := args.Get(0).(*license.LicenseField)
+    return licenseField, args.Error(1)
 }
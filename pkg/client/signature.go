@@ -0,0 +1,129 @@
+package client
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+
+    kotsv1beta1 "github.com/replicatedhq/kotskinds/apis/kots/v1beta1"
+    sdklicense "github.com/replicatedhq/replicated-sdk/pkg/license"
+)
+
+// A signature scheme, numbered by its version in the signature envelope
+type Scheme int
+
+const (
+    // RSA-PSS over an MD5 hash, the original scheme
+    SchemeMD5PSS Scheme = 1
+    // RSA-PSS over a SHA-256 hash
+    SchemeSHA256PSS Scheme = 2
+    // Ed25519
+    SchemeEd25519 Scheme = 3
+)
+
+func (s Scheme) String() string {
+    switch s {
+    case SchemeMD5PSS:
+      return "v1 (MD5 RSA-PSS)"
+    case SchemeSHA256PSS:
+      return "v2 (SHA-256 RSA-PSS)"
+    case SchemeEd25519:
+      return "v3 (Ed25519)"
+    }
+    return fmt.Sprintf("unknown scheme %d", int(s))
+}
+
+// Returned when a field only has an MD5 signature and the client rejects
+// legacy signatures
+var ErrLegacySignature = errors.New("legacy MD5 signature rejected")
+
+// The signatures on a license field, each base64 encoded and keyed by the
+// version of its scheme. A field can be signed with more than one scheme
+// while licenses are re-signed, and the strongest is the one verified.
+type FieldSignature struct {
+    V1 string `json:"v1,omitempty" yaml:"v1,omitempty"`
+    V2 string `json:"v2,omitempty" yaml:"v2,omitempty"`
+    V3 string `json:"v3,omitempty" yaml:"v3,omitempty"`
+}
+
+// returns the strongest signature in the envelope and its scheme, or a zero
+// scheme when the envelope is empty
+func (s FieldSignature) strongest() (Scheme, string) {
+    switch {
+    case s.V3 != "":
+      return SchemeEd25519, s.V3
+    case s.V2 != "":
+      return SchemeSHA256PSS, s.V2
+    case s.V1 != "":
+      return SchemeMD5PSS, s.V1
+    }
+    return 0, ""
+}
+
+// Verifies the signature over the whole license and returns the license as it
+// was signed, along with the ID of the trusted key that signed the app key.
+// Whole license signatures are always in the Replicated format, which uses
+// the V1 scheme.
+// Licenses signed in the older format, without the signed license data, are
+// verified by the SDK against the license itself using the keys the SDK
+// trusts.
+func (v *verifier) verifyLicenseSignature(license *kotsv1beta1.License) (*kotsv1beta1.License, string, error) {
+    // old licenses have a single space as their signature
+    if len(license.Spec.Signature) <= 1 {
+        return nil, "", ErrSignatureMissing
+    }
+
+    outer := &sdklicense.OuterSignature{}
+    if err := json.Unmarshal(license.Spec.Signature, outer); err != nil {
+        return nil, "", fmt.Errorf("unmarshal license signature: %w", err)
+    }
+    if len(outer.InnerSignature) == 0 {
+        return verifyOldLicenseSignature(license)
+    }
+
+    inner := &sdklicense.InnerSignature{}
+    if err := json.Unmarshal(outer.InnerSignature, inner); err != nil {
+        return nil, "", fmt.Errorf("unmarshal inner license signature: %w", err)
+    }
+    keySignature := &sdklicense.KeySignature{}
+    if err := json.Unmarshal(inner.KeySignature, keySignature); err != nil {
+        return nil, "", fmt.Errorf("unmarshal key signature: %w", err)
+    }
+
+    globalKey, ok := v.trusted()[keySignature.GlobalKeyId]
+    if !ok {
+        return nil, "", fmt.Errorf("license signed with unknown key %q: %w", keySignature.GlobalKeyId, ErrSignatureInvalid)
+    }
+    if err := verifyWithKey(globalKey, SchemeMD5PSS, []byte(inner.PublicKey), keySignature.Signature); err != nil {
+        return nil, "", fmt.Errorf("verify app key: %w: %w", ErrSignatureInvalid, err)
+    }
+    appKey, err := parsePublicKey([]byte(inner.PublicKey))
+    if err != nil {
+        return nil, "", fmt.Errorf("parse app key: %w", err)
+    }
+    if err := verifyWithKey(appKey, SchemeMD5PSS, outer.LicenseData, inner.LicenseSignature); err != nil {
+        return nil, "", fmt.Errorf("verify license: %w: %w", ErrSignatureInvalid, err)
+    }
+
+    signed := &kotsv1beta1.License{}
+    if err := json.Unmarshal(outer.LicenseData, signed); err != nil {
+        return nil, "", fmt.Errorf("unmarshal signed license: %w", err)
+    }
+    signed.Spec.Signature = license.Spec.Signature
+    return signed, keySignature.GlobalKeyId, nil
+}
+
+func verifyOldLicenseSignature(license *kotsv1beta1.License) (*kotsv1beta1.License, string, error) {
+    verified, err := sdklicense.VerifySignature(license)
+    if err != nil {
+        return nil, "", err
+    }
+
+    // the signature has already been verified, this is only to report the key
+    inner := &sdklicense.InnerSignature{}
+    keySignature := &sdklicense.KeySignature{}
+    if err := json.Unmarshal(license.Spec.Signature, inner); err == nil {
+        json.Unmarshal(inner.KeySignature, keySignature)
+    }
+    return verified, keySignature.GlobalKeyId, nil
+}
@@ -0,0 +1,248 @@
+package client
+
+import (
+    "crypto"
+    "crypto/ed25519"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/md5"
+    "crypto/sha256"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/json"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    kotsv1beta1 "github.com/replicatedhq/kotskinds/apis/kots/v1beta1"
+    sdklicense "github.com/replicatedhq/replicated-sdk/pkg/license"
+    license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testKeyID = "test-global-key"
+
+// signs messages the way the vendor portal signs licenses
+func signMessage(t *testing.T, key *rsa.PrivateKey, message []byte) []byte {
+    hashed := md5.Sum(message)
+    signature, err := rsa.SignPSS(rand.Reader, key, crypto.MD5, hashed[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+    require.NoError(t, err)
+    return signature
+}
+
+func publicKeyPEMFor(t *testing.T, key *rsa.PrivateKey) []byte {
+    der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+    require.NoError(t, err)
+    return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// signs licenses and fields with keys generated for the test, the way the
+// vendor portal signs them with the Replicated keys
+type testSigner struct {
+    globalKey *rsa.PrivateKey
+    appKey    *rsa.PrivateKey
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+    globalKey, err := rsa.GenerateKey(rand.Reader, 2048)
+    require.NoError(t, err)
+    appKey, err := rsa.GenerateKey(rand.Reader, 2048)
+    require.NoError(t, err)
+    return &testSigner{globalKey: globalKey, appKey: appKey}
+}
+
+// the default keys, plus the key the signer signs with
+func (s *testSigner) keys() KeySet {
+    return DefaultKeySet().With(KeySet{testKeyID: &s.globalKey.PublicKey})
+}
+
+// Returns a signature for the license, signed by an app key that's signed by
+// the signer's global key
+func (s *testSigner) signLicense(t *testing.T, license *kotsv1beta1.License) []byte {
+    appPublicKey := publicKeyPEMFor(t, s.appKey)
+    keySignature, err := json.Marshal(sdklicense.KeySignature{
+        Signature:   signMessage(t, s.globalKey, appPublicKey),
+        GlobalKeyId: testKeyID,
+    })
+    require.NoError(t, err)
+
+    licenseData, err := json.Marshal(license)
+    require.NoError(t, err)
+    inner, err := json.Marshal(sdklicense.InnerSignature{
+        LicenseSignature: signMessage(t, s.appKey, licenseData),
+        PublicKey:        string(appPublicKey),
+        KeySignature:     keySignature,
+    })
+    require.NoError(t, err)
+
+    outer, err := json.Marshal(sdklicense.OuterSignature{LicenseData: licenseData, InnerSignature: inner})
+    require.NoError(t, err)
+    return outer
+}
+
+func testLicense() *kotsv1beta1.License {
+    return &kotsv1beta1.License{
+        TypeMeta: metav1.TypeMeta{APIVersion: "kots.io/v1beta1", Kind: "License"},
+        Spec: kotsv1beta1.LicenseSpec{
+            AppSlug:           "slackernews-mackerel",
+            LicenseID:         "2ZgCQ4d6aUJMbGCvbMKoYVk7Yxn",
+            CustomerName:      "Omozan",
+            CustomerEmail:     "ops@omozan.example.com",
+            ChannelID:         "2ZgCRFWKnQEBNsuAHlq7RXBLZqT",
+            ChannelName:       "Stable",
+            LicenseType:       "prod",
+            LicenseSequence:   3,
+            IsAirgapSupported: true,
+            Entitlements: map[string]kotsv1beta1.EntitlementField{
+                "member_count_max": {
+                    Title:     "Max Member Count",
+                    Value:     kotsv1beta1.EntitlementValue{Type: kotsv1beta1.Int, IntVal: 100},
+                    ValueType: "Integer",
+                },
+                "enable_discourse": {
+                    Title:     "Enable Discourse (alpha)",
+                    Value:     kotsv1beta1.EntitlementValue{Type: kotsv1beta1.Bool, BoolVal: true},
+                    ValueType: "Boolean",
+                },
+            },
+        },
+    }
+}
+
+func TestVerifyLicenseSignature(t *testing.T) {
+    signer := newTestSigner(t)
+    license := testLicense()
+    signature := signer.signLicense(t, license)
+
+    v := newVerifier(WithKeySet(signer.keys()))
+    signed, keyID, err := v.verifyLicenseSignature(&kotsv1beta1.License{Spec: kotsv1beta1.LicenseSpec{Signature: signature}})
+    require.NoError(t, err)
+    assert.Equal(t, testKeyID, keyID)
+    assert.Equal(t, "Omozan", signed.Spec.CustomerName)
+    assert.Equal(t, "prod", signed.Spec.LicenseType)
+    assert.Equal(t, int64(100), signed.Spec.Entitlements["member_count_max"].Value.IntVal)
+    assert.Equal(t, signature, signed.Spec.Signature)
+}
+
+func TestVerifyTamperedLicenseData(t *testing.T) {
+    signer := newTestSigner(t)
+    signature := signer.signLicense(t, testLicense())
+
+    outer := sdklicense.OuterSignature{}
+    require.NoError(t, json.Unmarshal(signature, &outer))
+    tampered := testLicense()
+    tampered.Spec.LicenseType = "trial"
+    tampered.Spec.CustomerName = "Someone Else"
+    outer.LicenseData, _ = json.Marshal(tampered)
+    signature, _ = json.Marshal(outer)
+
+    v := newVerifier(WithKeySet(signer.keys()))
+    _, _, err := v.verifyLicenseSignature(&kotsv1beta1.License{Spec: kotsv1beta1.LicenseSpec{Signature: signature}})
+    assert.True(t, errors.Is(err, sdklicense.ErrSignatureInvalid))
+}
+
+func TestVerifyUntrustedKey(t *testing.T) {
+    signature := newTestSigner(t).signLicense(t, testLicense())
+
+    v := newVerifier()
+    _, _, err := v.verifyLicenseSignature(&kotsv1beta1.License{Spec: kotsv1beta1.LicenseSpec{Signature: signature}})
+    assert.ErrorContains(t, err, testKeyID)
+    assert.ErrorIs(t, err, sdklicense.ErrSignatureInvalid)
+}
+
+func TestVerifyMissingSignature(t *testing.T) {
+    v := newVerifier()
+    for _, signature := range [][]byte{nil, []byte(" ")} {
+        _, _, err := v.verifyLicenseSignature(&kotsv1beta1.License{Spec: kotsv1beta1.LicenseSpec{Signature: signature}})
+        assert.ErrorIs(t, err, sdklicense.ErrSignatureMissing)
+    }
+}
+
+func signSHA256(t *testing.T, key *rsa.PrivateKey, message []byte) string {
+    hashed := sha256.Sum256(message)
+    signature, err := rsa.SignPSS(rand.Reader, key, crypto.SHA256, hashed[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+    require.NoError(t, err)
+    return base64.StdEncoding.EncodeToString(signature)
+}
+
+func seatsField() *license.LicenseField {
+    return &license.LicenseField{Name: "seats", Value: float64(25), ValueType: "Integer"}
+}
+
+func TestVerifySHA256Signature(t *testing.T) {
+    key := generateKey(t)
+    v := newVerifier(WithKeySet(KeySet{"fixtures-rsa": &key.PublicKey}))
+
+    keyID, err := v.VerifyFieldSignature(seatsField(), FieldSignature{V2: signSHA256(t, key, []byte("25"))})
+    assert.NoError(t, err)
+    assert.Equal(t, "fixtures-rsa", keyID)
+
+    _, err = v.VerifyFieldSignature(seatsField(), FieldSignature{V2: signSHA256(t, key, []byte("250"))})
+    assert.ErrorIs(t, err, sdklicense.ErrSignatureInvalid)
+}
+
+func TestVerifyEd25519Signature(t *testing.T) {
+    public, private, err := ed25519.GenerateKey(rand.Reader)
+    require.NoError(t, err)
+    rsaKey := generateKey(t)
+    v := newVerifier(WithKeySet(KeySet{"fixtures-ed25519": public, "fixtures-rsa": &rsaKey.PublicKey}))
+
+    signature := base64.StdEncoding.EncodeToString(ed25519.Sign(private, []byte("25")))
+    keyID, err := v.VerifyFieldSignature(seatsField(), FieldSignature{V3: signature})
+    assert.NoError(t, err)
+    assert.Equal(t, "fixtures-ed25519", keyID)
+}
+
+func TestVerifyStrongestSignature(t *testing.T) {
+    key := generateKey(t)
+    v := newVerifier(WithKeySet(KeySet{"fixtures-rsa": &key.PublicKey}))
+    legacy := base64.StdEncoding.EncodeToString(signMessage(t, key, []byte("25")))
+    strong := signSHA256(t, key, []byte("25"))
+
+    _, err := v.VerifyFieldSignature(seatsField(), FieldSignature{V1: "bm90IGEgc2lnbmF0dXJl", V2: strong})
+    assert.NoError(t, err)
+
+    // a valid legacy signature doesn't make up for an invalid stronger one
+    _, err = v.VerifyFieldSignature(seatsField(), FieldSignature{V1: legacy, V2: "bm90IGEgc2lnbmF0dXJl"})
+    assert.Error(t, err)
+
+    _, err = v.VerifyFieldSignature(seatsField(), FieldSignature{})
+    assert.ErrorIs(t, err, sdklicense.ErrSignatureMissing)
+}
+
+func TestRejectLegacySignatures(t *testing.T) {
+    key := generateKey(t)
+    legacy := base64.StdEncoding.EncodeToString(signMessage(t, key, []byte("25")))
+    strong := signSHA256(t, key, []byte("25"))
+
+    v := newVerifier(WithKeySet(KeySet{"fixtures-rsa": &key.PublicKey}))
+    _, err := v.VerifyFieldSignature(seatsField(), FieldSignature{V1: legacy})
+    assert.NoError(t, err)
+
+    v = newVerifier(WithKeySet(KeySet{"fixtures-rsa": &key.PublicKey}), RejectLegacySignatures())
+    _, err = v.VerifyFieldSignature(seatsField(), FieldSignature{V1: legacy})
+    assert.ErrorIs(t, err, ErrLegacySignature)
+    _, err = v.VerifyFieldSignature(seatsField(), FieldSignature{V1: legacy, V2: strong})
+    assert.NoError(t, err)
+}
+
+func TestGetLicenseFieldSignatureEnvelope(t *testing.T) {
+    public, private, err := ed25519.GenerateKey(rand.Reader)
+    require.NoError(t, err)
+    signature := base64.StdEncoding.EncodeToString(ed25519.Sign(private, []byte("true")))
+
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        fmt.Fprintf(w, `{"name": "is_enterprise", "value": true, "valueType": "Boolean", "signature": {"v3": %q}}`, signature)
+    }))
+    defer server.Close()
+
+    c := NewClient(server.URL, WithKeySet(KeySet{"fixtures-ed25519": public}), RejectLegacySignatures())
+    field, err := c.GetLicenseField("is_enterprise")
+    require.NoError(t, err)
+    assert.Equal(t, true, field.Value)
+}
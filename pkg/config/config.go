@@ -0,0 +1,345 @@
+package config
+
+import (
+    "errors"
+    "fmt"
+    "net"
+    "net/url"
+    "os"
+    "time"
+
+    "github.com/charmbracelet/log"
+    "github.com/crdant/replicated-license-enforcer/pkg/enforce"
+    "sigs.k8s.io/yaml"
+)
+
+// The version of the configuration file this build understands
+const Version = 1
+
+// Configuration for the enforcer, usually read from a YAML file mounted from
+// a ConfigMap. Environment variables and flags override what's in the file.
+type Config struct {
+    Version     int      `json:"version"`
+    LogLevel    string   `json:"logLevel,omitempty"`
+    SDK         SDK      `json:"sdk,omitempty"`
+    License     License  `json:"license,omitempty"`
+    Retry       Retry    `json:"retry,omitempty"`
+    Outage      Outage   `json:"outage,omitempty"`
+    Recheck     Recheck  `json:"recheck,omitempty"`
+    GracePeriod Duration `json:"gracePeriod,omitempty"`
+    Rules       []string `json:"rules,omitempty"`
+    Events      Events   `json:"events,omitempty"`
+    Actions     []string `json:"actions,omitempty"`
+    Listen      string   `json:"listen,omitempty"`
+}
+
+// Where to find the Replicated SDK and how long to wait for it
+type SDK struct {
+    Endpoint string   `json:"endpoint,omitempty"`
+    Timeout  Duration `json:"timeout,omitempty"`
+}
+
+// Where the license comes from when there's no SDK, which keys to trust, and
+// the timezone for expiration dates that don't have a time
+type License struct {
+    File                   string `json:"file,omitempty"`
+    PublicKeys             string `json:"publicKeys,omitempty"`
+    RejectLegacySignatures bool   `json:"rejectLegacySignatures,omitempty"`
+    ExpirationTimezone     string `json:"expirationTimezone,omitempty"`
+}
+
+// How a check that fails for a transient reason is retried. Jitter is the
+// fraction each wait is randomized by, from 0 to 1.
+type Retry struct {
+    InitialInterval Duration `json:"initialInterval,omitempty"`
+    MaxInterval     Duration `json:"maxInterval,omitempty"`
+    MaxElapsedTime  Duration `json:"maxElapsedTime,omitempty"`
+    Jitter          *float64 `json:"jitter,omitempty"`
+    MaxAttempts     int      `json:"maxAttempts,omitempty"`
+}
+
+// Returns the retry policy for an enforcer, using the enforcer's defaults
+// for anything that isn't set
+func (r Retry) Policy() enforce.RetryPolicy {
+    policy := enforce.RetryPolicy{
+        InitialInterval: r.InitialInterval.Duration(),
+        MaxInterval:     r.MaxInterval.Duration(),
+        MaxElapsedTime:  r.MaxElapsedTime.Duration(),
+        MaxAttempts:     r.MaxAttempts,
+    }
+    if r.Jitter != nil {
+        policy.Jitter = *r.Jitter
+        if policy.Jitter == 0 {
+            policy.Jitter = enforce.NoJitter
+        }
+    }
+    return policy
+}
+
+// What the enforcer does once it gives up retrying because the Replicated
+// SDK is unavailable, `fail-closed` or `fail-open` with the last known good
+// license from the snapshot if it's no older than the maximum age
+type Outage struct {
+    Policy   string   `json:"policy,omitempty"`
+    MaxAge   Duration `json:"maxAge,omitempty"`
+    Snapshot string   `json:"snapshot,omitempty"`
+}
+
+// When the license is checked after the first check, either on an interval,
+// a cron schedule like `5 0 * * *`, or adaptively based on how long the
+// license has left
+type Recheck struct {
+    Interval     Duration `json:"interval,omitempty"`
+    Schedule     string   `json:"schedule,omitempty"`
+    Timezone     string   `json:"timezone,omitempty"`
+    AtExpiration bool     `json:"atExpiration,omitempty"`
+    Adaptive     bool     `json:"adaptive,omitempty"`
+    MinInterval  Duration `json:"minInterval,omitempty"`
+    MaxInterval  Duration `json:"maxInterval,omitempty"`
+}
+
+// Returns the bounds for adaptive rechecks, using the enforcer's defaults for
+// any that aren't set
+func (r Recheck) AdaptiveBounds() (time.Duration, time.Duration) {
+    minInterval, maxInterval := enforce.DefaultAdaptiveMin, enforce.DefaultAdaptiveMax
+    if r.MinInterval > 0 {
+        minInterval = r.MinInterval.Duration()
+    }
+    if r.MaxInterval > 0 {
+        maxInterval = r.MaxInterval.Duration()
+    }
+    return minInterval, maxInterval
+}
+
+// Which events are recorded and which pod they're recorded against
+type Events struct {
+    WarnBefore []Duration `json:"warnBefore,omitempty"`
+    Pod        Pod        `json:"pod,omitempty"`
+}
+
+// The pod events are recorded against, usually set from the downward API
+type Pod struct {
+    Name      string `json:"name,omitempty"`
+    Namespace string `json:"namespace,omitempty"`
+    UID       string `json:"uid,omitempty"`
+}
+
+// A problem with one setting in the configuration
+type FieldError struct {
+    Field   string
+    Message string
+}
+
+func (e *FieldError) Error() string {
+    return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// Returns the configuration used when there's no configuration file
+func Default() *Config {
+    return &Config{Version: Version}
+}
+
+// Reads and validates the configuration file at the path
+func Load(path string) (*Config, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    config, err := Parse(data)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    return config, nil
+}
+
+// Parses and validates a configuration, settings the enforcer doesn't know
+// about are an error so a typo doesn't go unnoticed
+func Parse(data []byte) (*Config, error) {
+    config := &Config{}
+    if err := yaml.UnmarshalStrict(data, config); err != nil {
+        return nil, err
+    }
+    if err := config.Validate(); err != nil {
+        return nil, err
+    }
+    return config, nil
+}
+
+// Overrides the configuration with the environment variables the enforcer
+// has always read, so they keep working alongside a configuration file
+func (c *Config) ApplyEnvironment() {
+    override := func(setting *string, name string) {
+        if value := os.Getenv(name); value != "" {
+            *setting = value
+        }
+    }
+    override(&c.LogLevel, "LOG_LEVEL")
+    override(&c.SDK.Endpoint, "REPLICATED_SDK_ENDPOINT")
+    override(&c.License.File, "REPLICATED_LICENSE_FILE")
+    override(&c.Events.Pod.Name, "POD_NAME")
+    override(&c.Events.Pod.Namespace, "POD_NAMESPACE")
+    override(&c.Events.Pod.UID, "POD_UID")
+}
+
+// Checks every setting and returns all of the problems at once, each a
+// `FieldError` naming the setting
+func (c *Config) Validate() error {
+    problems := []error{}
+    problem := func(field string, format string, args ...any) {
+        problems = append(problems, &FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+    }
+    negative := func(field string, duration Duration) {
+        if duration < 0 {
+            problem(field, "must not be negative, got %v", duration)
+        }
+    }
+
+    switch c.Version {
+    case Version:
+    case 0:
+        problem("version", "is required, use %d", Version)
+    default:
+        problem("version", "%d is not supported, use %d", c.Version, Version)
+    }
+
+    if c.LogLevel != "" {
+        if _, err := log.ParseLevel(c.LogLevel); err != nil {
+            problem("logLevel", "%q is not a log level, use debug, info, warn, or error", c.LogLevel)
+        }
+    }
+
+    if c.SDK.Endpoint != "" {
+        endpoint, err := url.Parse(c.SDK.Endpoint)
+        if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+            problem("sdk.endpoint", "%q is not an http or https URL", c.SDK.Endpoint)
+        }
+    }
+    negative("sdk.timeout", c.SDK.Timeout)
+
+    if c.License.File != "" && c.License.RejectLegacySignatures {
+        problem("license.rejectLegacySignatures", "can't be used with license.file, license files are only signed with the legacy MD5 scheme")
+    }
+    if c.License.ExpirationTimezone != "" {
+        if _, err := time.LoadLocation(c.License.ExpirationTimezone); err != nil {
+            problem("license.expirationTimezone", "%q is not a timezone like UTC or America/New_York", c.License.ExpirationTimezone)
+        }
+    }
+
+    negative("retry.initialInterval", c.Retry.InitialInterval)
+    negative("retry.maxInterval", c.Retry.MaxInterval)
+    negative("retry.maxElapsedTime", c.Retry.MaxElapsedTime)
+    if c.Retry.InitialInterval > 0 && c.Retry.MaxInterval > 0 && c.Retry.MaxInterval < c.Retry.InitialInterval {
+        problem("retry.maxInterval", "%v is shorter than the initial interval %v", c.Retry.MaxInterval, c.Retry.InitialInterval)
+    }
+    if c.Retry.Jitter != nil && (*c.Retry.Jitter < 0 || *c.Retry.Jitter > 1) {
+        problem("retry.jitter", "must be between 0 and 1, got %v", *c.Retry.Jitter)
+    }
+    if c.Retry.MaxAttempts < 0 {
+        problem("retry.maxAttempts", "must not be negative, got %d", c.Retry.MaxAttempts)
+    }
+
+    if c.Outage.Policy != "" {
+        mode, err := enforce.ParseOutageMode(c.Outage.Policy)
+        if err != nil {
+            problem("outage.policy", "%q is not an outage policy, use %s or %s", c.Outage.Policy, enforce.FailClosed, enforce.FailOpen)
+        }
+        if mode == enforce.FailOpen && c.Outage.Snapshot == "" {
+            problem("outage.snapshot", "is required to fail open, so the last known good license survives a restart")
+        }
+    }
+    negative("outage.maxAge", c.Outage.MaxAge)
+
+    negative("recheck.interval", c.Recheck.Interval)
+    modes := 0
+    for _, set := range []bool{c.Recheck.Interval != 0, c.Recheck.Schedule != "", c.Recheck.Adaptive} {
+        if set {
+            modes++
+        }
+    }
+    if modes > 1 {
+        problem("recheck", "set only one of interval, schedule, or adaptive")
+    }
+    if c.Recheck.Schedule != "" {
+        if _, err := enforce.ParseSchedule(c.Recheck.Schedule); err != nil {
+            problem("recheck.schedule", "%v", err)
+        }
+    }
+    if c.Recheck.Timezone != "" {
+        if _, err := time.LoadLocation(c.Recheck.Timezone); err != nil {
+            problem("recheck.timezone", "%q is not a timezone like UTC or America/New_York", c.Recheck.Timezone)
+        }
+    }
+    negative("recheck.minInterval", c.Recheck.MinInterval)
+    negative("recheck.maxInterval", c.Recheck.MaxInterval)
+    if minInterval, maxInterval := c.Recheck.AdaptiveBounds(); c.Recheck.MinInterval >= 0 && c.Recheck.MaxInterval >= 0 && maxInterval < minInterval {
+        problem("recheck.maxInterval", "%v is shorter than the minimum interval %v", maxInterval, minInterval)
+    }
+    negative("gracePeriod", c.GracePeriod)
+    for i, threshold := range c.Events.WarnBefore {
+        if threshold <= 0 {
+            problem(fmt.Sprintf("events.warnBefore[%d]", i), "must be positive, got %v", threshold)
+        }
+    }
+
+    for i, rule := range c.Rules {
+        if err := enforce.ValidateExpression(rule); err != nil {
+            var expressionErr *enforce.ExpressionError
+            if errors.As(err, &expressionErr) {
+                err = expressionErr.Err
+            }
+            problem(fmt.Sprintf("rules[%d]", i), "%v", err)
+        }
+    }
+    for i, action := range c.Actions {
+        if err := enforce.ValidateAction(action); err != nil {
+            problem(fmt.Sprintf("actions[%d]", i), "%v", err)
+        }
+    }
+
+    if c.Listen != "" {
+        if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+            problem("listen", "%q is not an address like :8080", c.Listen)
+        }
+    }
+
+    return errors.Join(problems...)
+}
+
+// Returns the options for an enforcer with this configuration. Rules and
+// actions aren't included since they need a connection to Kubernetes.
+func (c *Config) EnforcerOptions() []enforce.Option {
+    warnings := []time.Duration{}
+    for _, threshold := range c.Events.WarnBefore {
+        warnings = append(warnings, threshold.Duration())
+    }
+
+    opts := []enforce.Option{
+        enforce.WithGracePeriod(c.GracePeriod.Duration()),
+        enforce.WithExpiryWarnings(warnings...),
+        enforce.WithRetryPolicy(c.Retry.Policy()),
+    }
+    if c.SDK.Endpoint != "" {
+        opts = append(opts, enforce.WithSDKEndpoint(c.SDK.Endpoint))
+    }
+    if c.SDK.Timeout > 0 {
+        opts = append(opts, enforce.WithSDKTimeout(c.SDK.Timeout.Duration()))
+    }
+    if c.License.File != "" {
+        opts = append(opts, enforce.WithLicenseFile(c.License.File))
+    }
+    if c.Recheck.Timezone != "" {
+        location, _ := time.LoadLocation(c.Recheck.Timezone)
+        opts = append(opts, enforce.WithTimezone(location))
+    }
+    if c.Recheck.AtExpiration {
+        opts = append(opts, enforce.WithExpirationCheck())
+    }
+    if c.Outage.Policy != "" {
+        opts = append(opts, enforce.WithOutagePolicy(enforce.OutagePolicy{
+            Mode:         enforce.OutageMode(c.Outage.Policy),
+            MaxAge:       c.Outage.MaxAge.Duration(),
+            SnapshotPath: c.Outage.Snapshot,
+        }))
+    }
+    return opts
+}
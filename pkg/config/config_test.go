@@ -0,0 +1,195 @@
+package config
+
+import (
+    "errors"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/enforce"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+const example = `
+version: 1
+logLevel: debug
+sdk:
+  endpoint: http://replicated:3000
+  timeout: 10s
+license:
+  publicKeys: /etc/enforcer/keys.pem
+  rejectLegacySignatures: true
+retry:
+  initialInterval: 1s
+  maxInterval: 30s
+  maxElapsedTime: 5m
+recheck:
+  interval: 4h
+gracePeriod: 7d
+rules:
+  - license.fields.is_enterprise
+  - license.fields.max_nodes >= cluster.nodes
+events:
+  warnBefore: [30d, 7d, 1d]
+actions:
+  - exit:3
+  - scale:deployment/slackernews
+listen: :8080
+`
+
+func TestParse(t *testing.T) {
+    config, err := Parse([]byte(example))
+    require.NoError(t, err)
+
+    assert.Equal(t, Version, config.Version)
+    assert.Equal(t, "debug", config.LogLevel)
+    assert.Equal(t, "http://replicated:3000", config.SDK.Endpoint)
+    assert.Equal(t, 10*time.Second, config.SDK.Timeout.Duration())
+    assert.True(t, config.License.RejectLegacySignatures)
+    assert.Equal(t, 5*time.Minute, config.Retry.MaxElapsedTime.Duration())
+    assert.Equal(t, 4*time.Hour, config.Recheck.Interval.Duration())
+    assert.Equal(t, 7*24*time.Hour, config.GracePeriod.Duration())
+    assert.Len(t, config.Rules, 2)
+    assert.Equal(t, []Duration{Duration(30 * 24 * time.Hour), Duration(7 * 24 * time.Hour), Duration(24 * time.Hour)}, config.Events.WarnBefore)
+    assert.Equal(t, []string{"exit:3", "scale:deployment/slackernews"}, config.Actions)
+    assert.Equal(t, ":8080", config.Listen)
+}
+
+func TestParseRejectsUnknownSettings(t *testing.T) {
+    _, err := Parse([]byte("version: 1\nrecheck:\n  intreval: 4h\n"))
+    require.Error(t, err)
+    assert.Contains(t, err.Error(), "intreval")
+}
+
+func TestValidate(t *testing.T) {
+    _, err := Parse([]byte(`
+version: 2
+logLevel: loud
+sdk:
+  endpoint: replicated:3000
+retry:
+  initialInterval: 1m
+  maxInterval: 10s
+gracePeriod: -1h
+rules:
+  - license.fields.
+actions:
+  - scale:daemonset/slackernews
+listen: "8080"
+`))
+    require.Error(t, err)
+
+    fields := []string{}
+    for _, problem := range err.(interface{ Unwrap() []error }).Unwrap() {
+        var fieldErr *FieldError
+        require.True(t, errors.As(problem, &fieldErr))
+        fields = append(fields, fieldErr.Field)
+    }
+    assert.Equal(t, []string{"version", "logLevel", "sdk.endpoint", "retry.maxInterval", "gracePeriod", "rules[0]", "actions[0]", "listen"}, fields)
+}
+
+func TestValidateRequiresVersion(t *testing.T) {
+    _, err := Parse([]byte("gracePeriod: 1h\n"))
+    assert.EqualError(t, err, "version: is required, use 1")
+}
+
+func TestLoad(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "enforcer.yaml")
+    require.NoError(t, os.WriteFile(path, []byte(example), 0644))
+
+    config, err := Load(path)
+    require.NoError(t, err)
+    assert.Equal(t, ":8080", config.Listen)
+
+    require.NoError(t, os.WriteFile(path, []byte("version: 3\n"), 0644))
+    _, err = Load(path)
+    assert.EqualError(t, err, path+": version: 3 is not supported, use 1")
+}
+
+func TestApplyEnvironment(t *testing.T) {
+    t.Setenv("REPLICATED_SDK_ENDPOINT", "http://sdk.example.com:3000")
+    t.Setenv("POD_NAME", "slackernews-0")
+    t.Setenv("LOG_LEVEL", "")
+
+    config, err := Parse([]byte(example))
+    require.NoError(t, err)
+    config.ApplyEnvironment()
+
+    assert.Equal(t, "http://sdk.example.com:3000", config.SDK.Endpoint)
+    assert.Equal(t, "slackernews-0", config.Events.Pod.Name)
+    assert.Equal(t, "debug", config.LogLevel)
+}
+
+func TestEnforcerOptions(t *testing.T) {
+    config, err := Parse([]byte(example))
+    require.NoError(t, err)
+    assert.Len(t, config.EnforcerOptions(), 5)
+
+    assert.Len(t, Default().EnforcerOptions(), 3)
+}
+
+func TestValidateSchedule(t *testing.T) {
+    config, err := Parse([]byte("version: 1\nrecheck:\n  schedule: 5 0 * * *\n  timezone: America/New_York\n  atExpiration: true\n"))
+    require.NoError(t, err)
+    assert.Len(t, config.EnforcerOptions(), 5)
+
+    _, err = Parse([]byte("version: 1\nrecheck:\n  interval: 1h\n  schedule: 5 0 * *\n  timezone: Mars/Olympus_Mons\n"))
+    require.Error(t, err)
+    assert.ErrorContains(t, err, "recheck: set only one of interval, schedule, or adaptive")
+    assert.ErrorContains(t, err, `recheck.schedule: invalid schedule "5 0 * *"`)
+    assert.ErrorContains(t, err, `recheck.timezone: "Mars/Olympus_Mons" is not a timezone`)
+}
+
+func TestValidateAdaptive(t *testing.T) {
+    config, err := Parse([]byte("version: 1\nrecheck:\n  adaptive: true\n  maxInterval: 6h\n"))
+    require.NoError(t, err)
+    minInterval, maxInterval := config.Recheck.AdaptiveBounds()
+    assert.Equal(t, time.Minute, minInterval)
+    assert.Equal(t, 6*time.Hour, maxInterval)
+
+    _, err = Parse([]byte("version: 1\nrecheck:\n  adaptive: true\n  interval: 1h\n  minInterval: 2h\n  maxInterval: 1h\n"))
+    assert.EqualError(t, err, "recheck: set only one of interval, schedule, or adaptive\nrecheck.maxInterval: 1h0m0s is shorter than the minimum interval 2h0m0s")
+}
+
+func TestRetryPolicy(t *testing.T) {
+    config, err := Parse([]byte("version: 1\nretry:\n  maxElapsedTime: 2m\n  jitter: 0.2\n  maxAttempts: 5\n"))
+    require.NoError(t, err)
+    assert.Equal(t, enforce.RetryPolicy{MaxElapsedTime: 2 * time.Minute, Jitter: 0.2, MaxAttempts: 5}, config.Retry.Policy())
+
+    // no jitter is different from the default jitter
+    config, err = Parse([]byte("version: 1\nretry:\n  jitter: 0\n"))
+    require.NoError(t, err)
+    assert.Equal(t, float64(enforce.NoJitter), config.Retry.Policy().Jitter)
+    assert.Zero(t, Default().Retry.Policy().Jitter)
+
+    _, err = Parse([]byte("version: 1\nretry:\n  jitter: 1.5\n  maxAttempts: -1\n"))
+    assert.EqualError(t, err, "retry.jitter: must be between 0 and 1, got 1.5\nretry.maxAttempts: must not be negative, got -1")
+}
+
+func TestValidateExpirationTimezone(t *testing.T) {
+    _, err := Parse([]byte("version: 1\nlicense:\n  expirationTimezone: America/New_York\n"))
+    require.NoError(t, err)
+
+    _, err = Parse([]byte("version: 1\nlicense:\n  expirationTimezone: Eastern\n"))
+    assert.EqualError(t, err, `license.expirationTimezone: "Eastern" is not a timezone like UTC or America/New_York`)
+}
+
+func TestOutage(t *testing.T) {
+    config, err := Parse([]byte("version: 1\noutage:\n  policy: fail-open\n  maxAge: 12h\n  snapshot: /var/lib/enforcer/license.json\n"))
+    require.NoError(t, err)
+    assert.Len(t, config.EnforcerOptions(), 4)
+
+    _, err = Parse([]byte("version: 1\noutage:\n  policy: fail-open\n  maxAge: -1h\n"))
+    assert.EqualError(t, err, "outage.snapshot: is required to fail open, so the last known good license survives a restart\noutage.maxAge: must not be negative, got -1h0m0s")
+
+    _, err = Parse([]byte("version: 1\noutage:\n  policy: fail-whenever\n"))
+    assert.EqualError(t, err, `outage.policy: "fail-whenever" is not an outage policy, use fail-closed or fail-open`)
+}
+
+func TestValidateRejectsLegacyWithLicenseFile(t *testing.T) {
+    _, err := Parse([]byte("version: 1\nlicense:\n  file: /etc/license/license.yaml\n  rejectLegacySignatures: true\n"))
+    assert.EqualError(t, err, "license.rejectLegacySignatures: can't be used with license.file, license files are only signed with the legacy MD5 scheme")
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+    "encoding/json"
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// A duration written the way Go writes them, like `72h` or `90m`, or as a
+// number of days like `30d` since Go durations don't have days
+type Duration time.Duration
+
+// Parses a Go duration or a number of days like `30d`
+func ParseDuration(value string) (time.Duration, error) {
+    value = strings.TrimSpace(value)
+    if days, ok := strings.CutSuffix(value, "d"); ok {
+        count, err := strconv.Atoi(days)
+        if err != nil {
+            return 0, fmt.Errorf("invalid duration %q: %w", value, err)
+        }
+        return time.Duration(count) * 24 * time.Hour, nil
+    }
+    return time.ParseDuration(value)
+}
+
+func (d Duration) Duration() time.Duration {
+    return time.Duration(d)
+}
+
+func (d Duration) String() string {
+    return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+    return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+    var value string
+    if err := json.Unmarshal(data, &value); err != nil {
+        return fmt.Errorf("duration must be a string like \"72h\" or \"30d\", got %s", data)
+    }
+    duration, err := ParseDuration(value)
+    if err != nil {
+        return err
+    }
+    *d = Duration(duration)
+    return nil
+}
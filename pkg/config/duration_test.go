@@ -0,0 +1,44 @@
+package config
+
+import (
+    "encoding/json"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func TestParseDuration(t *testing.T) {
+    tests := []struct {
+        value    string
+        expected time.Duration
+    }{
+        {"30d", 30 * 24 * time.Hour},
+        {" 1d", 24 * time.Hour},
+        {"72h", 72 * time.Hour},
+        {"90m", 90 * time.Minute},
+    }
+    for _, test := range tests {
+        duration, err := ParseDuration(test.value)
+        require.NoError(t, err, test.value)
+        assert.Equal(t, test.expected, duration, test.value)
+    }
+
+    for _, value := range []string{"d", "1.5d", "a week"} {
+        _, err := ParseDuration(value)
+        assert.Error(t, err, value)
+    }
+}
+
+func TestDurationJSON(t *testing.T) {
+    var duration Duration
+    require.NoError(t, json.Unmarshal([]byte(`"14d"`), &duration))
+    assert.Equal(t, 14*24*time.Hour, duration.Duration())
+
+    document, err := json.Marshal(duration)
+    require.NoError(t, err)
+    assert.Equal(t, `"336h0m0s"`, string(document))
+
+    assert.Error(t, json.Unmarshal([]byte(`3600`), &duration))
+}
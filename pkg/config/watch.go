@@ -0,0 +1,67 @@
+package config
+
+import (
+    "context"
+    "crypto/sha256"
+    "fmt"
+    "os"
+    "time"
+)
+
+// Watches a configuration file for changes by reading it periodically. Reading
+// through the path catches the symlink swaps Kubernetes uses to update a
+// mounted ConfigMap, which file system notifications on the file itself miss.
+type Watcher struct {
+    path     string
+    interval time.Duration
+    last     [sha256.Size]byte
+}
+
+// Creates a watcher for the file at the path, changes are measured from what
+// the file contains now
+func NewWatcher(path string, interval time.Duration) *Watcher {
+    w := &Watcher{path: path, interval: interval}
+    w.poll()
+    return w
+}
+
+// Calls changed with the new configuration each time the file changes, or
+// with the error if the new file can't be read or isn't valid. Each failure is
+// only reported once. Returns when the context is done.
+func (w *Watcher) Watch(ctx context.Context, changed func(*Config, error)) {
+    ticker := time.NewTicker(w.interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            if config, ok, err := w.poll(); ok {
+                changed(config, err)
+            }
+        }
+    }
+}
+
+// reads the file and parses it if it changed since the last time it was read
+func (w *Watcher) poll() (*Config, bool, error) {
+    data, err := os.ReadFile(w.path)
+    sum := sha256.Sum256(data)
+    if err != nil {
+        // the same failure shouldn't be reported on every poll
+        sum = sha256.Sum256([]byte(err.Error()))
+    }
+    if sum == w.last {
+        return nil, false, nil
+    }
+    w.last = sum
+
+    if err != nil {
+        return nil, true, err
+    }
+    config, err := Parse(data)
+    if err != nil {
+        return nil, true, fmt.Errorf("%s: %w", w.path, err)
+    }
+    return config, true, nil
+}
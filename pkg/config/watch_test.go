@@ -0,0 +1,68 @@
+package config
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func TestWatcherReportsChanges(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "enforcer.yaml")
+    require.NoError(t, os.WriteFile(path, []byte("version: 1\ngracePeriod: 1h\n"), 0644))
+    watcher := NewWatcher(path, time.Millisecond)
+
+    _, ok, _ := watcher.poll()
+    assert.False(t, ok)
+
+    require.NoError(t, os.WriteFile(path, []byte("version: 1\ngracePeriod: 2h\n"), 0644))
+    config, ok, err := watcher.poll()
+    require.True(t, ok)
+    require.NoError(t, err)
+    assert.Equal(t, 2*time.Hour, config.GracePeriod.Duration())
+
+    require.NoError(t, os.WriteFile(path, []byte("version: 2\n"), 0644))
+    _, ok, err = watcher.poll()
+    require.True(t, ok)
+    assert.ErrorContains(t, err, "version: 2 is not supported")
+
+    // an invalid file is only reported once
+    _, ok, _ = watcher.poll()
+    assert.False(t, ok)
+}
+
+// Kubernetes updates a mounted ConfigMap by pointing the `..data` symlink at
+// a new directory, the file itself is a symlink through it
+func TestWatcherFollowsSymlinkSwaps(t *testing.T) {
+    dir := t.TempDir()
+    for name, contents := range map[string]string{
+        "..2025_06_01": "version: 1\nrecheck:\n  interval: 1h\n",
+        "..2025_06_02": "version: 1\nrecheck:\n  interval: 4h\n",
+    } {
+        require.NoError(t, os.Mkdir(filepath.Join(dir, name), 0755))
+        require.NoError(t, os.WriteFile(filepath.Join(dir, name, "enforcer.yaml"), []byte(contents), 0644))
+    }
+    require.NoError(t, os.Symlink("..2025_06_01", filepath.Join(dir, "..data")))
+    path := filepath.Join(dir, "enforcer.yaml")
+    require.NoError(t, os.Symlink(filepath.Join("..data", "enforcer.yaml"), path))
+
+    watcher := NewWatcher(path, time.Millisecond)
+    changes := make(chan *Config, 1)
+    go watcher.Watch(t.Context(), func(config *Config, err error) {
+        assert.NoError(t, err)
+        changes <- config
+    })
+
+    require.NoError(t, os.Symlink("..2025_06_02", filepath.Join(dir, "..data_tmp")))
+    require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+
+    select {
+    case config := <-changes:
+        assert.Equal(t, 4*time.Hour, config.Recheck.Interval.Duration())
+    case <-time.After(5 * time.Second):
+        t.Fatal("Expected the symlink swap to be noticed")
+    }
+}
@@ -0,0 +1,350 @@
+package enforce
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/events"
+
+    "github.com/charmbracelet/log"
+    autoscalingv1 "k8s.io/api/autoscaling/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    types "k8s.io/apimachinery/pkg/types"
+    "k8s.io/client-go/kubernetes"
+)
+
+// Describes the change in the license that caused an action to run
+type Transition struct {
+    Application string
+    Expiration  time.Time
+    State       LicenseState
+    Valid       bool
+    Err         error
+
+    // The license is only valid because the Replicated SDK is unavailable
+    // and the outage policy failed open with the last known good license
+    FailedOpen bool
+}
+
+// Something the enforcer does when the license becomes invalid, and undoes
+// when the license becomes valid again. The first check always runs the
+// action for the state it finds, so actions need to be idempotent. The
+// context is the one the check was run with.
+type Action interface {
+    Invalidated(ctx context.Context, transition Transition) error
+    Restored(ctx context.Context, transition Transition) error
+}
+
+// used in place of `os.Exit` so tests can observe the exit code
+var exit = os.Exit
+
+type exitAction struct {
+    code int
+}
+
+// Exits the process with the provided code when the license becomes invalid
+func ExitAction(code int) Action {
+    return &exitAction{code: code}
+}
+
+func (a *exitAction) Invalidated(ctx context.Context, transition Transition) error {
+    log.Error("License is not valid, exiting", "application", transition.Application, "code", a.code, "error", transition.Err)
+    exit(a.code)
+    return nil
+}
+
+func (a *exitAction) Restored(ctx context.Context, transition Transition) error {
+    return nil
+}
+
+type sentinelFileAction struct {
+    path string
+}
+
+// Writes a file at the provided path while the license is invalid, so other
+// containers sharing a volume can watch for it. The file is removed when the
+// license becomes valid again.
+func SentinelFileAction(path string) Action {
+    return &sentinelFileAction{path: path}
+}
+
+func (a *sentinelFileAction) Invalidated(ctx context.Context, transition Transition) error {
+    content := fmt.Sprintf("%s license is not valid: %v\n", transition.Application, transition.Err)
+    return os.WriteFile(a.path, []byte(content), 0644)
+}
+
+func (a *sentinelFileAction) Restored(ctx context.Context, transition Transition) error {
+    err := os.Remove(a.path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil
+    }
+    return err
+}
+
+type webhookAction struct {
+    url        string
+    httpClient *http.Client
+}
+
+// The body sent to a webhook when the license changes
+type WebhookPayload struct {
+    Application string    `json:"application"`
+    Valid       bool      `json:"valid"`
+    State       string    `json:"state"`
+    Expiration  time.Time `json:"expiration"`
+    Error       string    `json:"error,omitempty"`
+}
+
+// Posts the transition as JSON to the provided URL, usually an HTTP hook
+// served by the application in the same pod
+func WebhookAction(url string) Action {
+    return &webhookAction{url: url, httpClient: &http.Client{Timeout: time.Second * 30}}
+}
+
+func (a *webhookAction) Invalidated(ctx context.Context, transition Transition) error {
+    return a.post(ctx, transition)
+}
+
+func (a *webhookAction) Restored(ctx context.Context, transition Transition) error {
+    return a.post(ctx, transition)
+}
+
+func (a *webhookAction) post(ctx context.Context, transition Transition) error {
+    payload := WebhookPayload{
+        Application: transition.Application,
+        Valid:       transition.Valid,
+        State:       string(transition.State),
+        Expiration:  transition.Expiration,
+    }
+    if transition.Err != nil {
+        payload.Error = transition.Err.Error()
+    }
+    body, err := json.Marshal(payload)
+    if err != nil {
+        return err
+    }
+
+    request, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    request.Header.Set("Content-Type", "application/json")
+    response, err := a.httpClient.Do(request)
+    if err != nil {
+        return err
+    }
+    defer response.Body.Close()
+    if response.StatusCode >= 300 {
+        return fmt.Errorf("webhook %s returned %s", a.url, response.Status)
+    }
+    return nil
+}
+
+// The annotation that records the replicas a workload had before it was
+// scaled down, so it can be restored even if the enforcer restarts
+const ReplicasAnnotation = "replicated.com/replicas-before-enforcement"
+
+type scaleAction struct {
+    clientset kubernetes.Interface
+    namespace string
+    kind      string
+    name      string
+}
+
+// Scales a Deployment or StatefulSet to zero when the license becomes invalid
+// and restores its replicas when the license is valid again
+func ScaleAction(clientset kubernetes.Interface, namespace string, kind string, name string) (Action, error) {
+    kind = strings.ToLower(kind)
+    if kind != "deployment" && kind != "statefulset" {
+        return nil, fmt.Errorf("cannot scale %s, only deployments and statefulsets are supported", kind)
+    }
+    return &scaleAction{clientset: clientset, namespace: namespace, kind: kind, name: name}, nil
+}
+
+func (a *scaleAction) Invalidated(ctx context.Context, transition Transition) error {
+    scale, err := a.getScale(ctx)
+    if err != nil {
+        return err
+    }
+    if scale.Spec.Replicas == 0 {
+        return nil
+    }
+
+    err = a.annotate(ctx, strconv.Itoa(int(scale.Spec.Replicas)))
+    if err != nil {
+        return err
+    }
+    log.Info("Scaling down workload", "kind", a.kind, "name", a.name, "replicas", scale.Spec.Replicas)
+    scale.Spec.Replicas = 0
+    return a.updateScale(ctx, scale)
+}
+
+func (a *scaleAction) Restored(ctx context.Context, transition Transition) error {
+    annotations, err := a.annotations(ctx)
+    if err != nil {
+        return err
+    }
+    previous, ok := annotations[ReplicasAnnotation]
+    if !ok {
+        return nil
+    }
+    replicas, err := strconv.Atoi(previous)
+    if err != nil {
+        return fmt.Errorf("invalid %s annotation %q: %w", ReplicasAnnotation, previous, err)
+    }
+
+    scale, err := a.getScale(ctx)
+    if err != nil {
+        return err
+    }
+    log.Info("Restoring workload", "kind", a.kind, "name", a.name, "replicas", replicas)
+    scale.Spec.Replicas = int32(replicas)
+    if err := a.updateScale(ctx, scale); err != nil {
+        return err
+    }
+
+    return a.annotate(ctx, "")
+}
+
+func (a *scaleAction) getScale(ctx context.Context) (*autoscalingv1.Scale, error) {
+    if a.kind == "statefulset" {
+        return a.clientset.AppsV1().StatefulSets(a.namespace).GetScale(ctx, a.name, metav1.GetOptions{})
+    }
+    return a.clientset.AppsV1().Deployments(a.namespace).GetScale(ctx, a.name, metav1.GetOptions{})
+}
+
+func (a *scaleAction) updateScale(ctx context.Context, scale *autoscalingv1.Scale) error {
+    var err error
+    if a.kind == "statefulset" {
+        _, err = a.clientset.AppsV1().StatefulSets(a.namespace).UpdateScale(ctx, a.name, scale, metav1.UpdateOptions{})
+    } else {
+        _, err = a.clientset.AppsV1().Deployments(a.namespace).UpdateScale(ctx, a.name, scale, metav1.UpdateOptions{})
+    }
+    return err
+}
+
+func (a *scaleAction) annotations(ctx context.Context) (map[string]string, error) {
+    if a.kind == "statefulset" {
+        statefulSet, err := a.clientset.AppsV1().StatefulSets(a.namespace).Get(ctx, a.name, metav1.GetOptions{})
+        if err != nil {
+            return nil, err
+        }
+        return statefulSet.Annotations, nil
+    }
+    deployment, err := a.clientset.AppsV1().Deployments(a.namespace).Get(ctx, a.name, metav1.GetOptions{})
+    if err != nil {
+        return nil, err
+    }
+    return deployment.Annotations, nil
+}
+
+// sets the replicas annotation, or removes it when the value is empty
+func (a *scaleAction) annotate(ctx context.Context, value string) error {
+    var annotation any = value
+    if value == "" {
+        annotation = nil
+    }
+    patch, err := json.Marshal(map[string]any{
+        "metadata": map[string]any{
+            "annotations": map[string]any{ReplicasAnnotation: annotation},
+        },
+    })
+    if err != nil {
+        return err
+    }
+
+    if a.kind == "statefulset" {
+        _, err = a.clientset.AppsV1().StatefulSets(a.namespace).Patch(ctx, a.name, types.MergePatchType, patch, metav1.PatchOptions{})
+    } else {
+        _, err = a.clientset.AppsV1().Deployments(a.namespace).Patch(ctx, a.name, types.MergePatchType, patch, metav1.PatchOptions{})
+    }
+    return err
+}
+
+// Parses an action from a short description, one of `exit:<code>`,
+// `scale:<deployment|statefulset>/<name>`, `file:<path>`, or an `http://`
+// or `https://` URL for a webhook. Workloads are scaled in the pod's
+// namespace.
+func ParseAction(spec string) (Action, error) {
+    parsed, err := parseActionSpec(spec)
+    if err != nil {
+        return nil, err
+    }
+
+    switch parsed.kind {
+    case "webhook":
+        return WebhookAction(spec), nil
+    case "exit":
+        return ExitAction(parsed.code), nil
+    case "file":
+        return SentinelFileAction(parsed.argument), nil
+    }
+    config, err := events.GetKubernetesConfig()
+    if err != nil {
+        return nil, err
+    }
+    clientset, err := kubernetes.NewForConfig(config)
+    if err != nil {
+        return nil, err
+    }
+    return ScaleAction(clientset, events.GetObjectReference().Namespace, parsed.workload, parsed.name)
+}
+
+// Checks that an action is described correctly without creating it, so
+// configuration can be validated without connecting to Kubernetes
+func ValidateAction(spec string) error {
+    _, err := parseActionSpec(spec)
+    return err
+}
+
+// the parts of an action's description
+type actionSpec struct {
+    kind     string
+    argument string
+    code     int
+    workload string
+    name     string
+}
+
+func parseActionSpec(spec string) (*actionSpec, error) {
+    if strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://") {
+        return &actionSpec{kind: "webhook", argument: spec}, nil
+    }
+
+    kind, argument, ok := strings.Cut(spec, ":")
+    if !ok || argument == "" {
+        return nil, fmt.Errorf("invalid action %q", spec)
+    }
+
+    parsed := &actionSpec{kind: kind, argument: argument}
+    switch kind {
+    case "exit":
+        code, err := strconv.Atoi(argument)
+        if err != nil {
+            return nil, fmt.Errorf("invalid exit code in action %q: %w", spec, err)
+        }
+        parsed.code = code
+    case "file":
+    case "scale":
+        workload, name, ok := strings.Cut(argument, "/")
+        if !ok || name == "" {
+            return nil, fmt.Errorf("invalid workload in action %q, use scale:deployment/<name>", spec)
+        }
+        if kind := strings.ToLower(workload); kind != "deployment" && kind != "statefulset" {
+            return nil, fmt.Errorf("cannot scale %s, only deployments and statefulsets are supported", workload)
+        }
+        parsed.workload = workload
+        parsed.name = name
+    default:
+        return nil, fmt.Errorf("unknown action %q", spec)
+    }
+    return parsed, nil
+}
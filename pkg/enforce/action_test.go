@@ -0,0 +1,269 @@
+package enforce
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "time"
+    "testing"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/client"
+    "github.com/crdant/replicated-license-enforcer/pkg/events"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+
+    appsv1 "k8s.io/api/apps/v1"
+    autoscalingv1 "k8s.io/api/autoscaling/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/client-go/kubernetes/fake"
+    k8stesting "k8s.io/client-go/testing"
+)
+
+type recordingAction struct {
+    transitions []Transition
+}
+
+func (a *recordingAction) Invalidated(ctx context.Context, transition Transition) error {
+    a.transitions = append(a.transitions, transition)
+    return nil
+}
+
+func (a *recordingAction) Restored(ctx context.Context, transition Transition) error {
+    a.transitions = append(a.transitions, transition)
+    return nil
+}
+
+func TestActionsRunOnTransitions(t *testing.T) {
+    slug := "slackernews-mackerel"
+    future := time.Now().Add(24 * time.Hour)
+    past := time.Now().Add(-24 * time.Hour)
+    renewed := time.Now().Add(365 * 24 * time.Hour)
+
+    sdkClient := &client.MockAPIClient{}
+    sdkClient.On("GetAppName").Return("Slackernews", nil)
+    sdkClient.On("GetAppSlug").Return(slug, nil)
+    sdkClient.On("GetExpirationDate").Return(future, nil).Twice()
+    sdkClient.On("GetExpirationDate").Return(past, nil).Twice()
+    sdkClient.On("GetExpirationDate").Return(renewed, nil)
+
+    action := &recordingAction{}
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient(), WithActions(action))
+
+    for i := 0; i < 5; i++ {
+        enforcer.Check()
+    }
+
+    require.Len(t, action.transitions, 3)
+    assert.True(t, action.transitions[0].Valid)
+    assert.False(t, action.transitions[1].Valid)
+    assert.Equal(t, StateExpired, action.transitions[1].State)
+    assert.Error(t, action.transitions[1].Err)
+    assert.True(t, action.transitions[2].Valid)
+    assert.Equal(t, renewed, action.transitions[2].Expiration)
+}
+
+func TestActionsSkipCheckErrors(t *testing.T) {
+    sdkClient := &client.MockAPIClient{}
+    sdkClient.On("GetExpirationDate").Return(time.Time{}, errors.New("connection refused"))
+
+    action := &recordingAction{}
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient(), WithActions(action))
+
+    _, err := enforcer.Check()
+    assert.Error(t, err)
+    assert.Empty(t, action.transitions)
+}
+
+// An action that holds the check until it's released, like a slow webhook
+type blockingAction struct {
+    started chan struct{}
+    release chan struct{}
+}
+
+func (a *blockingAction) Invalidated(ctx context.Context, transition Transition) error {
+    close(a.started)
+    <-a.release
+    return nil
+}
+
+func (a *blockingAction) Restored(ctx context.Context, transition Transition) error {
+    return nil
+}
+
+func TestStatusWhileActionsRun(t *testing.T) {
+    action := &blockingAction{started: make(chan struct{}), release: make(chan struct{})}
+    expired := client.NewMockAPIClient("Slackernews", "slackernews-mackerel", time.Now().Add(-24*time.Hour))
+    enforcer := NewEnforcer(expired, events.NewMockEventClient(), WithActions(action))
+
+    done := make(chan error)
+    go func() {
+        _, err := enforcer.Check()
+        done <- err
+    }()
+    <-action.started
+
+    status := make(chan Status)
+    go func() { status <- enforcer.Status() }()
+    select {
+    case current := <-status:
+        assert.False(t, current.Valid)
+        assert.Equal(t, StateExpired, current.State)
+    case <-time.After(5 * time.Second):
+        t.Fatal("Expected the status while the action is running")
+    }
+
+    close(action.release)
+    assert.ErrorIs(t, <-done, ErrLicenseExpired)
+}
+
+func TestExitAction(t *testing.T) {
+    code := -1
+    exit = func(c int) { code = c }
+    defer func() { exit = os.Exit }()
+
+    action, err := ParseAction("exit:3")
+    require.NoError(t, err)
+
+    assert.NoError(t, action.Restored(t.Context(), Transition{Valid: true}))
+    assert.Equal(t, -1, code)
+    assert.NoError(t, action.Invalidated(t.Context(), Transition{Valid: false}))
+    assert.Equal(t, 3, code)
+}
+
+func TestSentinelFileAction(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "license-invalid")
+    action, err := ParseAction("file:" + path)
+    require.NoError(t, err)
+
+    err = action.Invalidated(t.Context(), Transition{Application: "slackernews-mackerel", Err: errors.New("expired")})
+    assert.NoError(t, err)
+    content, err := os.ReadFile(path)
+    assert.NoError(t, err)
+    assert.Equal(t, "slackernews-mackerel license is not valid: expired\n", string(content))
+
+    assert.NoError(t, action.Restored(t.Context(), Transition{Valid: true}))
+    assert.NoFileExists(t, path)
+
+    // restoring again is harmless
+    assert.NoError(t, action.Restored(t.Context(), Transition{Valid: true}))
+}
+
+func TestWebhookAction(t *testing.T) {
+    payloads := []WebhookPayload{}
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var payload WebhookPayload
+        json.NewDecoder(r.Body).Decode(&payload)
+        payloads = append(payloads, payload)
+        w.WriteHeader(http.StatusNoContent)
+    }))
+    defer server.Close()
+
+    action, err := ParseAction(server.URL + "/license")
+    require.NoError(t, err)
+
+    err = action.Invalidated(t.Context(), Transition{Application: "slackernews-mackerel", State: StateExpired, Err: errors.New("expired")})
+    assert.NoError(t, err)
+    err = action.Restored(t.Context(), Transition{Application: "slackernews-mackerel", State: StateValid, Valid: true})
+    assert.NoError(t, err)
+
+    require.Len(t, payloads, 2)
+    assert.False(t, payloads[0].Valid)
+    assert.Equal(t, "Expired", payloads[0].State)
+    assert.Equal(t, "expired", payloads[0].Error)
+    assert.True(t, payloads[1].Valid)
+    assert.Empty(t, payloads[1].Error)
+}
+
+func TestWebhookActionFailure(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusInternalServerError)
+    }))
+    defer server.Close()
+
+    action := WebhookAction(server.URL)
+    assert.Error(t, action.Invalidated(t.Context(), Transition{}))
+}
+
+func fakeScaleClientset(replicas int32) *fake.Clientset {
+    deployment := &appsv1.Deployment{
+        ObjectMeta: metav1.ObjectMeta{Name: "slackernews", Namespace: "slackernews"},
+        Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+    }
+    clientset := fake.NewSimpleClientset(deployment)
+
+    // the fake clientset doesn't implement the scale subresource
+    clientset.PrependReactor("get", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+        if action.GetSubresource() != "scale" {
+            return false, nil, nil
+        }
+        return true, &autoscalingv1.Scale{
+            ObjectMeta: metav1.ObjectMeta{Name: "slackernews", Namespace: "slackernews"},
+            Spec:       autoscalingv1.ScaleSpec{Replicas: replicas},
+        }, nil
+    })
+    clientset.PrependReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+        if action.GetSubresource() != "scale" {
+            return false, nil, nil
+        }
+        scale := action.(k8stesting.UpdateAction).GetObject().(*autoscalingv1.Scale)
+        replicas = scale.Spec.Replicas
+        return true, scale, nil
+    })
+    return clientset
+}
+
+func currentReplicas(t *testing.T, clientset *fake.Clientset) int32 {
+    scale, err := clientset.AppsV1().Deployments("slackernews").GetScale(t.Context(), "slackernews", metav1.GetOptions{})
+    require.NoError(t, err)
+    return scale.Spec.Replicas
+}
+
+func TestScaleAction(t *testing.T) {
+    clientset := fakeScaleClientset(3)
+    action, err := ScaleAction(clientset, "slackernews", "Deployment", "slackernews")
+    require.NoError(t, err)
+
+    assert.NoError(t, action.Invalidated(t.Context(), Transition{}))
+    assert.Equal(t, int32(0), currentReplicas(t, clientset))
+
+    deployment, err := clientset.AppsV1().Deployments("slackernews").Get(t.Context(), "slackernews", metav1.GetOptions{})
+    require.NoError(t, err)
+    assert.Equal(t, "3", deployment.Annotations[ReplicasAnnotation])
+
+    // scaling down again keeps the original replicas
+    assert.NoError(t, action.Invalidated(t.Context(), Transition{}))
+
+    assert.NoError(t, action.Restored(t.Context(), Transition{Valid: true}))
+    assert.Equal(t, int32(3), currentReplicas(t, clientset))
+
+    deployment, err = clientset.AppsV1().Deployments("slackernews").Get(t.Context(), "slackernews", metav1.GetOptions{})
+    require.NoError(t, err)
+    assert.NotContains(t, deployment.Annotations, ReplicasAnnotation)
+}
+
+func TestScaleActionUnsupportedKind(t *testing.T) {
+    _, err := ScaleAction(fake.NewSimpleClientset(), "slackernews", "daemonset", "slackernews")
+    assert.Error(t, err)
+}
+
+func TestParseInvalidActions(t *testing.T) {
+    for _, spec := range []string{"exit", "exit:three", "scale:slackernews", "reboot:now", "file:"} {
+        _, err := ParseAction(spec)
+        assert.Error(t, err, spec)
+    }
+}
+
+func TestValidateAction(t *testing.T) {
+    for _, spec := range []string{"exit:3", "file:/tmp/license-invalid", "scale:deployment/slackernews", "scale:StatefulSet/slackernews", "https://example.com/license"} {
+        assert.NoError(t, ValidateAction(spec), spec)
+    }
+    for _, spec := range []string{"exit", "exit:three", "scale:slackernews", "scale:daemonset/slackernews", "reboot:now", "file:"} {
+        assert.Error(t, ValidateAction(spec), spec)
+    }
+}
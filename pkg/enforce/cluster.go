@@ -0,0 +1,36 @@
+package enforce
+
+import (
+    "context"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/events"
+
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes"
+)
+
+// Observes the number of nodes in the cluster, the enforcer's service account
+// needs permission to list nodes for this to work
+func NodeCount(clientset kubernetes.Interface) Observation {
+    return func(ctx context.Context) (int64, error) {
+        nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+        if err != nil {
+            return 0, err
+        }
+        return int64(len(nodes.Items)), nil
+    }
+}
+
+// Returns the facts about the cluster the enforcer is running in that license
+// rules can reference, currently `cluster.nodes`
+func DefaultFacts() (Facts, error) {
+    config, err := events.GetKubernetesConfig()
+    if err != nil {
+        return nil, err
+    }
+    clientset, err := kubernetes.NewForConfig(config)
+    if err != nil {
+        return nil, err
+    }
+    return Facts{"nodes": NodeCount(clientset)}, nil
+}
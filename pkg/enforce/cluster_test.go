@@ -0,0 +1,31 @@
+package enforce
+
+import (
+    "fmt"
+    "testing"
+
+    "github.com/stretchr/testify/assert"
+
+    v1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNodeCount(t *testing.T) {
+    clientset := fake.NewSimpleClientset()
+    observe := NodeCount(clientset)
+
+    count, err := observe(t.Context())
+    assert.NoError(t, err)
+    assert.Equal(t, int64(0), count)
+
+    for i := 0; i < 3; i++ {
+        node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("node-%d", i)}}
+        _, err := clientset.CoreV1().Nodes().Create(t.Context(), node, metav1.CreateOptions{})
+        assert.NoError(t, err)
+    }
+
+    count, err = observe(t.Context())
+    assert.NoError(t, err)
+    assert.Equal(t, int64(3), count)
+}
@@ -1,13 +1,17 @@
 package enforce
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/crdant/replicated-license-enforcer/pkg/client"
 	"github.com/crdant/replicated-license-enforcer/pkg/events"
+	"github.com/crdant/replicated-license-enforcer/pkg/metrics"
 
   "github.com/charmbracelet/log"
   cron "github.com/robfig/cron/v3"
@@ -18,26 +22,166 @@ type Enforcer struct {
     sdkClient client.ReplicatedClient ;
     eventClient events.EventClient ;
     scheduler *cron.Cron ;
+    entry cron.EntryID ;
+    location *time.Location ;
+    checkAtExpiration bool ;
+    expirationEntry cron.EntryID ;
+    expirationCheck time.Time ;
+    adaptive *adaptiveSchedule ;
+    drainTimeout time.Duration ;
+    running context.Context ;
+    last *Result ;
+    lastErr error ;
+    policy *Policy ;
+    expressions []string ;
+    facts Facts ;
+    rules []Rule ;
+    rulesMutex sync.Mutex ;
+    licenseFile string ;
+    clientOptions []client.Option ;
+    sdkEndpoint string ;
+    sdkTimeout time.Duration ;
+    retry RetryPolicy ;
+    outage OutagePolicy ;
+    snapshot *Snapshot ;
+    gracePeriod time.Duration ;
+    warnings []time.Duration ;
+    actions []Action ;
+    valid *bool ;
+    status Status ;
+    mutex sync.Mutex ;
 }
 
-func DefaultEnforcer() *Enforcer {
-    endpoint := os.Getenv("REPLICATED_SDK_ENDPOINT")
-    if endpoint == "" {
-      // this is the default in the current build of the SDK
-      endpoint = "http://replicated:3000"
-    } 
+// The state of the license as of the most recent check
+type LicenseState string
+
+const (
+    StateValid LicenseState = events.ReasonValid
+    StateExpiredInGrace LicenseState = events.ReasonExpiredInGrace
+    StateExpired LicenseState = events.ReasonExpired
+)
+
+// Configures optional behavior of an enforcer
+type Option func(*Enforcer)
+
+// Evaluates the rules in the policy on every license check, in addition to
+// checking that the license has not expired
+func WithPolicy(policy *Policy) Option {
+    return func(e *Enforcer) {
+        e.policy = policy
+    }
+}
+
+// Treats an expired license as still valid for the provided duration after it
+// expires. The license is reported as `Expired-InGrace` with warning events
+// during the grace period, and checks only fail once it has passed.
+func WithGracePeriod(gracePeriod time.Duration) Option {
+    return func(e *Enforcer) {
+        e.gracePeriod = gracePeriod
+    }
+}
+
+// Emits an `ExpiringSoon` warning event when the license is about to expire,
+// once for each threshold (for example 30, 14, 7, and 1 days) before the
+// expiration date
+func WithExpiryWarnings(thresholds ...time.Duration) Option {
+    return func(e *Enforcer) {
+        e.warnings = append(e.warnings, thresholds...)
+        sort.Slice(e.warnings, func(i, j int) bool { return e.warnings[i] < e.warnings[j] })
+    }
+}
+
+// Runs the actions when the license goes from valid to invalid, or back from
+// invalid to valid
+func WithActions(actions ...Action) Option {
+    return func(e *Enforcer) {
+        e.actions = append(e.actions, actions...)
+    }
+}
+
+// Evaluates license rules written as CEL expressions on every license check.
+// The expressions are compiled and type-checked against the license on the
+// first check, so an invalid expression stops validation right away.
+func WithExpressions(facts Facts, expressions ...string) Option {
+    return func(e *Enforcer) {
+        e.facts = facts
+        e.expressions = append(e.expressions, expressions...)
+    }
+}
+
+// Reads the license from a signed license file instead of the Replicated SDK,
+// for deployments that don't run the SDK
+func WithLicenseFile(path string) Option {
+    return func(e *Enforcer) {
+        e.licenseFile = path
+    }
+}
+
+// Trusts the keys in the key set to sign the license, instead of the default
+// keys, when the enforcer creates its client
+func WithKeySet(keys client.KeySet) Option {
+    return WithClientOptions(client.WithKeySet(keys))
+}
+
+// Configures how the client the enforcer creates verifies the license, for
+// example with `client.RejectLegacySignatures`
+func WithClientOptions(opts ...client.Option) Option {
+    return func(e *Enforcer) {
+        e.clientOptions = append(e.clientOptions, opts...)
+    }
+}
+
+// Uses the Replicated SDK at this URL instead of the one from
+// `REPLICATED_SDK_ENDPOINT` when the enforcer creates its client
+func WithSDKEndpoint(endpoint string) Option {
+    return func(e *Enforcer) {
+        e.sdkEndpoint = endpoint
+    }
+}
+
+// Sets how long each request to the Replicated SDK can take when the
+// enforcer creates its client
+func WithSDKTimeout(timeout time.Duration) Option {
+    return func(e *Enforcer) {
+        e.sdkTimeout = timeout
+    }
+}
+
+func DefaultEnforcer(opts ...Option) *Enforcer {
+    if path := os.Getenv("REPLICATED_LICENSE_FILE"); path != "" {
+      opts = append([]Option{WithLicenseFile(path)}, opts...)
+    }
 
-    sdkClient := client.NewClient(endpoint)
     eventClient, err := events.NewKubernetesEventClient()
     if err != nil {
       log.Error("Error creating Kubernetes event client", "error", err)
       return nil
     }
-    return NewEnforcer(sdkClient, eventClient)
+    enforcer := NewEnforcer(nil, eventClient, opts...)
+    if enforcer.sdkClient == nil {
+      endpoint := enforcer.sdkEndpoint
+      if endpoint == "" {
+        endpoint = client.DefaultEndpoint()
+      }
+      sdkClient := client.NewClient(endpoint, enforcer.clientOptions...)
+      if enforcer.sdkTimeout > 0 {
+        sdkClient.HTTPClient.Timeout = enforcer.sdkTimeout
+      }
+      enforcer.sdkClient = sdkClient
+    }
+    return enforcer
 }
 
-func NewEnforcer(sdkClient client.ReplicatedClient, eventClient events.EventClient) *Enforcer {
-    return &Enforcer{sdkClient: sdkClient, eventClient: eventClient, scheduler: cron.New()}
+func NewEnforcer(sdkClient client.ReplicatedClient, eventClient events.EventClient, opts ...Option) *Enforcer {
+    enforcer := &Enforcer{sdkClient: sdkClient, eventClient: eventClient, location: time.Local, drainTimeout: DefaultDrainTimeout}
+    for _, opt := range opts {
+      opt(enforcer)
+    }
+    enforcer.scheduler = cron.New(cron.WithLocation(enforcer.location))
+    if enforcer.licenseFile != "" {
+      enforcer.sdkClient = client.NewFileClient(enforcer.licenseFile, enforcer.clientOptions...)
+    }
+    return enforcer
 }
 
 func (e *Enforcer) isValid(client client.ReplicatedClient) (bool, error) {
@@ -46,66 +190,271 @@ func (e *Enforcer) isValid(client client.ReplicatedClient) (bool, error) {
 		return false, err
 	}
 
-	if expiration.Before(time.Now()) {
-    return false, nil
-	}
+	return e.licenseState(expiration) != StateExpired, nil
+}
+
+func (e *Enforcer) licenseState(expiration time.Time) LicenseState {
+    now := time.Now()
+    if client.IsPerpetual(expiration) || !expiration.Before(now) {
+      return StateValid
+    }
+    if expiration.Add(e.gracePeriod).After(now) {
+      return StateExpiredInGrace
+    }
+    return StateExpired
+}
+
+// returns the smallest warning threshold the license is within, if any
+func (e *Enforcer) expiryWarning(expiration time.Time) (time.Duration, bool) {
+    if client.IsPerpetual(expiration) {
+      return 0, false
+    }
+    remaining := time.Until(expiration)
+    for _, threshold := range e.warnings {
+      if remaining <= threshold {
+        return threshold, true
+      }
+    }
+    return 0, false
+}
+
+func (e *Enforcer) Check() (*Result, error) {
+    return e.CheckContext(context.Background())
+}
+
+// Checks the license once, abandoning requests to the SDK and Kubernetes
+// when the context is done. The result describes the check even when it
+// fails.
+func (e *Enforcer) CheckContext(ctx context.Context) (*Result, error) {
+    result := newResult()
+    err := e.check(ctx, result)
+    if err != nil {
+      result.recordError(err)
+    }
 
-	return true, nil
+    // a check that couldn't tell whether the license is valid, like one that
+    // couldn't reach the SDK, leaves the last decision in place
+    if err == nil || IsPermanent(err) {
+      e.mutex.Lock()
+      e.last, e.lastErr = result, err
+      e.mutex.Unlock()
+    }
+    return result, err
 }
 
-func (e *Enforcer) Check() error {
-    valid, err := e.isValid(e.sdkClient)
+func (e *Enforcer) check(ctx context.Context, result *Result) error {
+    sdkClient := &fieldRecorder{ReplicatedClient: client.WithContext(ctx, e.sdkClient), result: result}
+    eventClient := events.WithContext(ctx, e.eventClient)
+
+    expiration, err := sdkClient.GetExpirationDate()
     if err != nil {
       log.Error("checking license", "error", err)
+      result.recordField("expires_at", nil, err)
+      e.recordError(err)
       return err
     }
+    result.recordExpiration(expiration)
+    e.scheduleExpirationCheck(expiration)
+    e.adaptSchedule(expiration)
     log.Debug("Fetching license details and creating event")
 
-    expiration, err := e.sdkClient.GetExpirationDate()
-    if err != nil {
-      log.Error("Error finding expiration date to incldue in kubernetes event", "error", err)
+    name, _ := sdkClient.GetAppName()
+    slug, _ := sdkClient.GetAppSlug()
+    result.Application = name
+    result.AppSlug = slug
+
+    state := e.licenseState(expiration)
+    result.State = state
+    switch state {
+    case StateExpired:
+      result.recordEvent(events.ReasonExpired, eventClient.CreateLicenseEvent(slug, expiration))
+      log.Infof("License for %s is expired", name)
+      err := &ExpiredError{Application: name, Expiration: expiration}
+      e.record(ctx, Transition{Application: slug, Expiration: expiration, State: state, Valid: false, Err: err})
       return err
+    case StateExpiredInGrace:
+      graceEnds := expiration.Add(e.gracePeriod)
+      result.recordEvent(events.ReasonExpiredInGrace, eventClient.CreateGracePeriodEvent(slug, expiration, graceEnds))
+      log.Warnf("License for %s is expired, grace period ends in %v", name, time.Until(graceEnds).Round(time.Minute))
+    default:
+      result.recordEvent(events.ReasonValid, eventClient.CreateLicenseEvent(slug, expiration))
+      if threshold, ok := e.expiryWarning(expiration); ok {
+        result.recordEvent(events.ReasonExpiringSoon, eventClient.CreateExpiringSoonEvent(slug, expiration, threshold))
+        log.Warnf("License for %s expires in less than %v", name, threshold)
+      }
     }
 
-    name, _ := e.sdkClient.GetAppName()
-    slug, _ := e.sdkClient.GetAppSlug()
+    if err := e.compileExpressions(sdkClient); err != nil {
+      log.Error("Error compiling license rules", "error", err)
+      e.recordError(err)
+      return err
+    }
 
-    e.eventClient.CreateLicenseEvent(slug, expiration)
-    if !valid {
-      log.Infof("License for %s is expired", name)
-      return errors.New(fmt.Sprintf("License for %s is expired", name))
+    if policy := e.currentPolicy(); policy != nil {
+      policyResult := policy.EvaluateContext(ctx, sdkClient)
+      if err := policyResult.Err(); err != nil {
+        log.Error("Error evaluating license rules", "error", err)
+        e.recordError(err)
+        return err
+      }
+      if !policyResult.Passed() {
+        for _, failure := range policyResult.Failures() {
+          log.Warn("License does not satisfy rule", "rule", failure.Rule, "error", failure.Error)
+        }
+        err := &PolicyError{Result: policyResult}
+        e.record(ctx, Transition{Application: slug, Expiration: expiration, State: state, Valid: false, Err: err})
+        return err
+      }
     }
 
-    log.Info("License is valid")
+    if state == StateValid {
+      log.Info("License is valid")
+    }
+    result.Valid = true
+    e.recordSnapshot(ctx, result)
+    e.record(ctx, Transition{Application: slug, Expiration: expiration, State: state, Valid: true})
     return nil
 }
 
-func (e *Enforcer) Validate() error {
-    err := backoff.Retry(e.Check, backoff.NewExponentialBackOff())
+// records the outcome of a check and runs the actions when the license
+// changes between valid and invalid, or on the first check since there's no
+// previous state to compare to. Actions can take a while, like a webhook
+// that times out, so they run after the lock `Status` needs is released.
+func (e *Enforcer) record(ctx context.Context, transition Transition) {
+    e.mutex.Lock()
+    e.status = Status{
+      Application: transition.Application,
+      Expiration:  transition.Expiration,
+      Perpetual:   client.IsPerpetual(transition.Expiration),
+      State:       transition.State,
+      Valid:       transition.Valid,
+      FailedOpen:  transition.FailedOpen,
+      CheckedAt:   time.Now(),
+    }
+    if transition.Err != nil {
+      e.status.Error = transition.Err.Error()
+    }
+    metrics.RecordLicense(transition.Application, transition.Expiration, transition.Valid, checkResult(transition))
+
+    changed := e.valid == nil || *e.valid != transition.Valid
+    e.valid = &transition.Valid
+    actions := e.actions
+    e.mutex.Unlock()
+    if !changed {
+      return
+    }
+
+    for _, action := range actions {
+      var err error
+      if transition.Valid {
+        err = action.Restored(ctx, transition)
+      } else {
+        err = action.Invalidated(ctx, transition)
+      }
+      if err != nil {
+        log.Error("Error running license enforcement action", "valid", transition.Valid, "error", err)
+      }
+    }
+}
+
+func checkResult(transition Transition) string {
+    var policyErr *PolicyError
+    switch {
+    case errors.As(transition.Err, &policyErr):
+      return metrics.ResultPolicyFailed
+    case transition.State == StateExpired:
+      return metrics.ResultExpired
+    case transition.State == StateExpiredInGrace:
+      return metrics.ResultInGrace
+    }
+    return metrics.ResultValid
+}
+
+func (e *Enforcer) compileExpressions(sdkClient client.ReplicatedClient) error {
+    e.rulesMutex.Lock()
+    defer e.rulesMutex.Unlock()
+    if len(e.expressions) == 0 {
+      return nil
+    }
+
+    rules, err := CompileExpressions(sdkClient, e.facts, e.expressions...)
     if err != nil {
-        log.Error("Error in license check, skipping current check", "error", err)
-        return errors.New("Error in license check")
+      return err
     }
+    e.rules = append(e.rules, rules...)
+    e.expressions = nil
     return nil
 }
+
+// returns the rules from the policy together with the compiled expressions,
+// or nil if there aren't any
+func (e *Enforcer) currentPolicy() *Policy {
+    e.rulesMutex.Lock()
+    defer e.rulesMutex.Unlock()
+    if len(e.rules) == 0 {
+      return e.policy
+    }
+
+    rules := []Rule{}
+    if e.policy != nil {
+      rules = append(rules, e.policy.Rules()...)
+    }
+    return NewPolicy(append(rules, e.rules...)...)
+}
+
+func (e *Enforcer) Validate() (*Result, error) {
+    return e.ValidateContext(context.Background())
+}
+
+// Checks the license, retrying transient failures like an unreachable SDK
+// with an exponential backoff until the check succeeds, fails for good (see
+// `IsPermanent`), the retry policy gives up, or the context is done.
+// Returns the result of the last check, which is nil if the context was done
+// before the license was checked at all.
+func (e *Enforcer) ValidateContext(ctx context.Context) (*Result, error) {
+    var result *Result
+    err := backoff.RetryNotify(func() error {
+      var err error
+      result, err = e.CheckContext(ctx)
+      // retrying won't fix an expired license or a rule that doesn't compile
+      if IsPermanent(err) {
+        return backoff.Permanent(err)
+      }
+      return err
+    }, backoff.WithContext(e.retry.backOff(), ctx), func(err error, wait time.Duration) {
+      metrics.ValidateRetries.Inc()
+      log.Debug("Retrying license check", "error", err, "wait", wait)
+    })
+    if err != nil {
+        if e.handleOutage(ctx, result, err) {
+          return result, nil
+        }
+        log.Error("Error in license check, skipping current check", "error", err)
+        return result, fmt.Errorf("Error in license check: %w", err)
+    }
+    return result, nil
+}
   
 func (e *Enforcer) Recheck() { 
-  err := e.Validate()
+  _, err := e.ValidateContext(e.recheckContext())
   if err != nil {
       log.Error("Error in license check, skipping current check", "error", err)
   }
 }
 
+// Checks the license on the interval in the background until the enforcer is
+// stopped, use `Run` to block until a context is done instead
 func (e *Enforcer) Monitor(interval time.Duration) {
-	_, err := e.scheduler.AddFunc(fmt.Sprintf("@every %v", interval), e.Recheck)
+	err := e.Reschedule(interval)
 	if err != nil {
 		log.Error("Could not schedule periodic license check", "error", err)
 		return
 	}
-  defer e.Stop()  
-	go e.scheduler.Start()
+	e.scheduler.Start()
 }
 
+// Stops scheduling license checks, a check that's already running keeps
+// going in the background
 func (e *Enforcer) Stop() {
 	e.scheduler.Stop()
 }
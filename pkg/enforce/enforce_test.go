@@ -1,6 +1,8 @@
 package enforce
 
 import (
+    "context"
+    "errors"
     "time"
     "testing"
 
@@ -51,7 +53,7 @@ func TestCheckValidLicense(t *testing.T) {
     sdkClient := client.NewMockAPIClient(name, slug, future)
     k8sClient := events.NewMockEventClient()
     enforcer := NewEnforcer(sdkClient, k8sClient)
-    err := enforcer.Check()
+    _, err := enforcer.Check()
 
     assert.NoError(t, err)
     assert.Len(t, k8sClient.Events, 1)
@@ -72,7 +74,7 @@ func TestCheckExpiredLicense(t *testing.T) {
     sdkClient := client.NewMockAPIClient(name, slug, past)
     k8sClient := events.NewMockEventClient()
     enforcer := NewEnforcer(sdkClient, k8sClient)
-    err := enforcer.Check()
+    _, err := enforcer.Check()
 
     assert.Error(t, err)
     assert.Len(t, k8sClient.Events, 1)
@@ -85,19 +87,50 @@ func TestCheckExpiredLicense(t *testing.T) {
     assert.Equal(t, "Expired", event.Reason)
 }
 
+// An action that sends every transition on a channel, so tests can wait for a
+// scheduled check to finish
+type transitionAction chan Transition
+
+func (a transitionAction) Invalidated(ctx context.Context, transition Transition) error {
+    a <- transition
+    return nil
+}
+
+func (a transitionAction) Restored(ctx context.Context, transition Transition) error {
+    a <- transition
+    return nil
+}
+
+// runs one scheduled check and stops the enforcer once it's finished
+func runScheduledCheck(t *testing.T, enforcer *Enforcer, checked transitionAction) {
+    require.NoError(t, enforcer.reschedule(&immediateSchedule{}))
+    ctx, cancel := context.WithCancel(t.Context())
+    done := make(chan struct{})
+    go func() {
+        enforcer.Run(ctx)
+        close(done)
+    }()
+
+    select {
+    case <-checked:
+    case <-time.After(time.Minute):
+        t.Fatal("Expected the scheduled check to run")
+    }
+    cancel()
+    <-done
+}
+
 func TestCheckMonitorValid(t *testing.T) {
     future := time.Now().Add(24 * time.Hour)
     name := "Slackernews"
     slug := "slackernews-mackerel"
-    interval := 3 * time.Second
 
     sdkClient := client.NewMockAPIClient(name, slug, future)
     k8sClient := events.NewMockEventClient()
-    enforcer := NewEnforcer(sdkClient, k8sClient)
+    checked := make(transitionAction, 1)
+    enforcer := NewEnforcer(sdkClient, k8sClient, WithActions(checked))
 
-    enforcer.Monitor(interval);
-    time.Sleep(interval)
-    enforcer.Stop()
+    runScheduledCheck(t, enforcer, checked)
 
     assert.Len(t, k8sClient.Events, 1)
 
@@ -114,16 +147,59 @@ func TestCheckMonitorExpired(t *testing.T) {
     past := time.Now().Add(-24 * time.Hour)
     name := "Slackernews"
     slug := "slackernews-mackerel"
-    interval := 1 * time.Second
 
     sdkClient := client.NewMockAPIClient(name, slug, past)
     k8sClient := events.NewMockEventClient()
-    enforcer := NewEnforcer(sdkClient, k8sClient)
+    checked := make(transitionAction, 1)
+    enforcer := NewEnforcer(sdkClient, k8sClient, WithActions(checked))
+
+    runScheduledCheck(t, enforcer, checked)
+
+    assert.Len(t, k8sClient.Events, 1)
+
+    event, err := k8sClient.GetLicenseEvent(slug, past)
+    require.NoError(t, err)
+    require.NotNil(t, event)
+
+    assert.Equal(t, "Warning", event.Type)
+    assert.Equal(t, "Expired", event.Reason)
+    // an expired license isn't retried
+    assert.Equal(t, int32(1), event.Count)
+}
 
-    enforcer.Monitor(interval);
-    time.Sleep(3 * interval)
-    enforcer.Stop()
+func TestCheckExpiredLicenseInGracePeriod(t *testing.T) {
+    past := time.Now().Add(-24 * time.Hour)
+    name := "Slackernews"
+    slug := "slackernews-mackerel"
+
+    sdkClient := client.NewMockAPIClient(name, slug, past)
+    k8sClient := events.NewMockEventClient()
+    enforcer := NewEnforcer(sdkClient, k8sClient, WithGracePeriod(72 * time.Hour))
+    _, err := enforcer.Check()
+
+    assert.NoError(t, err)
+    assert.Len(t, k8sClient.Events, 1)
+
+    event, err := k8sClient.FindLicenseEvent(events.ReasonExpiredInGrace, events.LicenseLabels(slug, past))
+    require.NoError(t, err)
+    require.NotNil(t, event)
+
+    assert.Equal(t, "Warning", event.Type)
+    assert.Equal(t, "Expired-InGrace", event.Reason)
+    assert.Contains(t, event.Message, "grace period ends in 48h0m0s")
+}
+
+func TestCheckExpiredLicenseAfterGracePeriod(t *testing.T) {
+    past := time.Now().Add(-96 * time.Hour)
+    name := "Slackernews"
+    slug := "slackernews-mackerel"
+
+    sdkClient := client.NewMockAPIClient(name, slug, past)
+    k8sClient := events.NewMockEventClient()
+    enforcer := NewEnforcer(sdkClient, k8sClient, WithGracePeriod(72 * time.Hour))
+    _, err := enforcer.Check()
 
+    assert.Error(t, err)
     assert.Len(t, k8sClient.Events, 1)
 
     event, err := k8sClient.GetLicenseEvent(slug, past)
@@ -132,7 +208,97 @@ func TestCheckMonitorExpired(t *testing.T) {
 
     assert.Equal(t, "Warning", event.Type)
     assert.Equal(t, "Expired", event.Reason)
-    // there should be at least one check per second in our interval, but
-    // it is non-deterministic with exponential backoff
-    assert.GreaterOrEqual(t, event.Count, int32(interval.Seconds()))
+}
+
+func TestValidateInGracePeriod(t *testing.T) {
+    past := time.Now().Add(-time.Hour)
+    sdkClient := client.NewMockAPIClient("Slackernews", "slackernews-mackerel", past)
+    k8sClient := events.NewMockEventClient()
+    enforcer := NewEnforcer(sdkClient, k8sClient, WithGracePeriod(2 * time.Hour))
+
+    valid, err := enforcer.isValid(sdkClient)
+    assert.NoError(t, err)
+    assert.True(t, valid)
+    _, err = enforcer.Validate()
+    assert.NoError(t, err)
+}
+
+func TestValidateStopsWhenContextDone(t *testing.T) {
+    sdkClient := &client.MockAPIClient{}
+    sdkClient.On("GetExpirationDate").Return(time.Time{}, errors.New("connection refused"))
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient())
+
+    ctx, cancel := context.WithTimeout(t.Context(), 200 * time.Millisecond)
+    defer cancel()
+
+    started := time.Now()
+    _, err := enforcer.ValidateContext(ctx)
+    assert.ErrorIs(t, err, context.DeadlineExceeded)
+    assert.Less(t, time.Since(started), 2 * time.Second)
+}
+
+func TestCheckContextCancelled(t *testing.T) {
+    sdkClient := client.DefaultMockAPIClient()
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient())
+
+    ctx, cancel := context.WithCancel(t.Context())
+    cancel()
+
+    _, err := enforcer.CheckContext(ctx)
+    assert.ErrorIs(t, err, context.Canceled)
+    sdkClient.AssertNotCalled(t, "GetExpirationDate")
+}
+
+func TestCheckExpiringSoon(t *testing.T) {
+    day := 24 * time.Hour
+    future := time.Now().Add(10 * day)
+    slug := "slackernews-mackerel"
+
+    sdkClient := client.NewMockAPIClient("Slackernews", slug, future)
+    k8sClient := events.NewMockEventClient()
+    enforcer := NewEnforcer(sdkClient, k8sClient, WithExpiryWarnings(30 * day, 1 * day, 14 * day, 7 * day))
+
+    _, err := enforcer.Check()
+    assert.NoError(t, err)
+    _, err = enforcer.Check()
+    assert.NoError(t, err)
+
+    // the valid event plus a single warning for the closest threshold
+    assert.Len(t, k8sClient.Events, 2)
+
+    event, err := k8sClient.FindLicenseEvent(events.ReasonExpiringSoon, events.ExpiringSoonLabels(slug, future, 14 * day))
+    require.NoError(t, err)
+    require.NotNil(t, event)
+    assert.Equal(t, "Warning", event.Type)
+    assert.Equal(t, int32(1), event.Count)
+
+    event, err = k8sClient.GetLicenseEvent(slug, future)
+    require.NoError(t, err)
+    require.NotNil(t, event)
+    assert.Equal(t, "Valid", event.Reason)
+}
+
+func TestCheckNotExpiringSoon(t *testing.T) {
+    day := 24 * time.Hour
+    future := time.Now().Add(300 * day)
+
+    sdkClient := client.NewMockAPIClient("Slackernews", "slackernews-mackerel", future)
+    k8sClient := events.NewMockEventClient()
+    enforcer := NewEnforcer(sdkClient, k8sClient, WithExpiryWarnings(30 * day, 14 * day))
+
+    _, err := enforcer.Check()
+    assert.NoError(t, err)
+    assert.Len(t, k8sClient.Events, 1)
+}
+
+func TestWithLicenseFile(t *testing.T) {
+    keys := client.KeySet{}
+    enforcer := NewEnforcer(client.DefaultMockAPIClient(), events.NewMockEventClient(),
+        WithKeySet(keys),
+        WithLicenseFile("/etc/replicated/license.yaml"),
+    )
+
+    fileClient, ok := enforcer.sdkClient.(*client.FileClient)
+    require.True(t, ok)
+    assert.Equal(t, "/etc/replicated/license.yaml", fileClient.Path)
 }
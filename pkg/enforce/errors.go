@@ -0,0 +1,110 @@
+package enforce
+
+import (
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/client"
+)
+
+var (
+    // The license is past its expiration date and any grace period
+    ErrLicenseExpired = errors.New("license is expired")
+
+    // The license doesn't satisfy one or more rules in the policy
+    ErrPolicyNotSatisfied = errors.New("license does not satisfy policy")
+
+    // A license rule expression doesn't compile or doesn't evaluate to a
+    // boolean
+    ErrInvalidExpression = errors.New("invalid license rule")
+
+    // The errors from the client, repeated here so callers only need this
+    // package to tell what went wrong
+    ErrSignatureInvalid = client.ErrSignatureInvalid
+    ErrSignatureMissing = client.ErrSignatureMissing
+    ErrSDKUnavailable   = client.ErrSDKUnavailable
+    ErrFieldNotFound    = client.ErrFieldNotFound
+    ErrLicenseTampered  = client.ErrLicenseTampered
+    ErrInvalidExpiration = client.ErrInvalidExpiration
+)
+
+// The license for an application has expired, use `errors.As` to get the
+// expiration date
+type ExpiredError struct {
+    Application string
+    Expiration  time.Time
+}
+
+func (e *ExpiredError) Error() string {
+    return fmt.Sprintf("License for %s is expired", e.Application)
+}
+
+func (e *ExpiredError) Is(target error) bool {
+    return target == ErrLicenseExpired
+}
+
+func (e *PolicyError) Is(target error) bool {
+    return target == ErrPolicyNotSatisfied
+}
+
+func (e *ExpressionError) Is(target error) bool {
+    return target == ErrInvalidExpression
+}
+
+// returned when a license field a rule depends on isn't in the license
+func fieldNotFound(name string) error {
+    return &client.FieldError{Field: name, Err: client.ErrFieldNotFound}
+}
+
+// Names for each class of error, stable enough for scripts and alerts to
+// match on
+const (
+    ClassExpired            = "LicenseExpired"
+    ClassInvalidRule        = "InvalidRule"
+    ClassPolicyNotSatisfied = "PolicyNotSatisfied"
+    ClassTampered           = "LicenseTampered"
+    ClassSignatureInvalid   = "SignatureInvalid"
+    ClassFieldNotFound      = "FieldNotFound"
+    ClassInvalidExpiration  = "InvalidExpiration"
+    ClassSDKUnavailable     = "SDKUnavailable"
+    ClassError              = "Error"
+)
+
+// Returns the class of an error from checking the license, or an empty
+// string if there's no error
+func ErrorClass(err error) string {
+    switch {
+    case err == nil:
+        return ""
+    case errors.Is(err, ErrLicenseExpired):
+        return ClassExpired
+    case errors.Is(err, ErrInvalidExpression):
+        return ClassInvalidRule
+    case errors.Is(err, ErrPolicyNotSatisfied):
+        return ClassPolicyNotSatisfied
+    case errors.Is(err, ErrLicenseTampered):
+        return ClassTampered
+    case errors.Is(err, ErrSignatureMissing), errors.Is(err, ErrSignatureInvalid), errors.Is(err, client.ErrLegacySignature):
+        return ClassSignatureInvalid
+    case errors.Is(err, ErrFieldNotFound):
+        return ClassFieldNotFound
+    case errors.Is(err, ErrInvalidExpiration):
+        return ClassInvalidExpiration
+    case errors.Is(err, ErrSDKUnavailable):
+        return ClassSDKUnavailable
+    }
+    return ClassError
+}
+
+// Reports whether checking the license again won't change the outcome of a
+// check that failed with the error, like an expired or tampered license.
+// Errors reaching the Replicated SDK, and errors that aren't classified, are
+// transient and worth retrying.
+func IsPermanent(err error) bool {
+    switch ErrorClass(err) {
+    case ClassExpired, ClassInvalidRule, ClassPolicyNotSatisfied, ClassTampered, ClassSignatureInvalid, ClassFieldNotFound, ClassInvalidExpiration:
+        return true
+    }
+    return false
+}
@@ -0,0 +1,114 @@
+package enforce
+
+import (
+    "errors"
+    "testing"
+    "time"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/client"
+    "github.com/crdant/replicated-license-enforcer/pkg/events"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func TestCheckExpiredError(t *testing.T) {
+    past := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+    sdkClient := client.NewMockAPIClient("Slackernews", "slackernews-mackerel", past)
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient())
+
+    _, err := enforcer.Check()
+    assert.ErrorIs(t, err, ErrLicenseExpired)
+    assert.EqualError(t, err, "License for Slackernews is expired")
+
+    var expiredErr *ExpiredError
+    require.True(t, errors.As(err, &expiredErr))
+    assert.Equal(t, "Slackernews", expiredErr.Application)
+    assert.True(t, past.Equal(expiredErr.Expiration))
+}
+
+func TestCheckPolicyErrors(t *testing.T) {
+    sdkClient := entitlementClient(time.Now().Add(24 * time.Hour))
+    sdkClient.On("GetLicenseField", "feature_y_enabled").Return(nil, nil)
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient(),
+        WithPolicy(NewPolicy(RequireTrue("feature_x_enabled"), RequireTrue("feature_y_enabled"))))
+
+    _, err := enforcer.Check()
+    assert.ErrorIs(t, err, ErrPolicyNotSatisfied)
+    assert.NotErrorIs(t, err, ErrLicenseExpired)
+
+    var policyErr *PolicyError
+    require.True(t, errors.As(err, &policyErr))
+    failures := policyErr.Result.Failures()
+    require.Len(t, failures, 2)
+    assert.NotErrorIs(t, failures[0].Error, ErrFieldNotFound)
+    assert.ErrorIs(t, failures[1].Error, ErrFieldNotFound)
+
+    var fieldErr *client.FieldError
+    require.True(t, errors.As(failures[1].Error, &fieldErr))
+    assert.Equal(t, "feature_y_enabled", fieldErr.Field)
+}
+
+func TestInvalidExpressionError(t *testing.T) {
+    sdkClient := seatsClient(time.Now().Add(24 * time.Hour))
+    sdkClient.On("GetLicenseField", "max_seets").Return(nil, nil)
+
+    _, err := DiscoverSchema(sdkClient, "license.fields.max_seets > 1")
+    assert.ErrorIs(t, err, ErrInvalidExpression)
+    assert.ErrorIs(t, err, ErrFieldNotFound)
+}
+
+func TestClientErrorsPassThrough(t *testing.T) {
+    sdkClient := &client.MockAPIClient{}
+    sdkClient.On("GetExpirationDate").Return(time.Time{}, &client.RequestError{URL: "/api/v1/license/fields/expires_at", StatusCode: 503})
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient())
+
+    _, err := enforcer.Check()
+    assert.ErrorIs(t, err, ErrSDKUnavailable)
+    assert.NotErrorIs(t, err, ErrLicenseExpired)
+}
+
+func TestErrorClass(t *testing.T) {
+    tests := []struct {
+        err   error
+        class string
+    }{
+        {nil, ""},
+        {&ExpiredError{Application: "Slackernews"}, ClassExpired},
+        {&ExpressionError{Expression: "license.fields.seats >", Err: errors.New("syntax error")}, ClassInvalidRule},
+        {&PolicyError{Result: &PolicyResult{}}, ClassPolicyNotSatisfied},
+        {&client.TamperedError{Field: "licenseType", Reason: "does not match the signed license"}, ClassTampered},
+        {&client.FieldError{Field: "seats", Err: client.ErrSignatureInvalid}, ClassSignatureInvalid},
+        {client.ErrLegacySignature, ClassSignatureInvalid},
+        {fieldNotFound("seats"), ClassFieldNotFound},
+        {&client.FieldError{Field: "expires_at", Err: &client.ExpirationError{Value: "someday"}}, ClassInvalidExpiration},
+        {&client.RequestError{URL: "/api/v1/app/info", StatusCode: 502}, ClassSDKUnavailable},
+        {errors.New("something else"), ClassError},
+    }
+    for _, test := range tests {
+        assert.Equal(t, test.class, ErrorClass(test.err), "%v", test.err)
+    }
+}
+
+func TestIsPermanent(t *testing.T) {
+    permanent := []error{
+        &ExpiredError{Application: "Slackernews"},
+        &client.TamperedError{Field: "expires_at", Reason: "does not match its signature"},
+        &PolicyError{Result: &PolicyResult{}},
+        &ExpressionError{Expression: "license.fields.", Err: errors.New("syntax error")},
+        client.ErrSignatureMissing,
+        &client.FieldError{Field: "expires_at", Err: &client.ExpirationError{Value: "someday"}},
+    }
+    for _, err := range permanent {
+        assert.True(t, IsPermanent(err), err.Error())
+    }
+
+    transient := []error{
+        nil,
+        &client.RequestError{URL: "http://replicated:3000/api/v1/license/info", StatusCode: 503},
+        errors.New("connection refused"),
+    }
+    for _, err := range transient {
+        assert.False(t, IsPermanent(err), "%v", err)
+    }
+}
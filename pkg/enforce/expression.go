@@ -0,0 +1,330 @@
+package enforce
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/client"
+
+    "github.com/google/cel-go/cel"
+    celast "github.com/google/cel-go/common/ast"
+    license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
+)
+
+// The value type of each license field an expression can reference, keyed by
+// field name and using the value types reported by the Replicated SDK
+// (`String`, `Text`, `Integer`, or `Boolean`)
+type Schema map[string]string
+
+// Values observed in the cluster that expressions can reference as
+// `cluster.<name>`, for example `cluster.nodes`
+type Facts map[string]Observation
+
+// Returned when an expression fails to parse or type-check, this happens
+// when the rules are compiled so it never depends on the current license
+type ExpressionError struct {
+    Expression string
+    Err        error
+}
+
+func (e *ExpressionError) Error() string {
+    return fmt.Sprintf("invalid license rule %q: %v", e.Expression, e.Err)
+}
+
+func (e *ExpressionError) Unwrap() error {
+    return e.Err
+}
+
+// A rule written in the Common Expression Language (CEL) and evaluated
+// against the license. Expressions can reference `license.fields.<name>`,
+// `license.expiresAt`, `license.perpetual`, `license.appSlug`,
+// `license.appName`, `now`, and any `cluster.<name>` facts, and have to
+// evaluate to a boolean. Only the facts an expression references are
+// observed when it's evaluated. A license that doesn't expire has a zero
+// `license.expiresAt`, so check `license.perpetual` before comparing it.
+type ExpressionRule struct {
+    name       string
+    expression string
+    fields     []string
+    facts      Facts
+    program    cel.Program
+}
+
+// Compiles and type-checks an expression against the schema, any reference to
+// a field or fact that isn't declared is an error
+func NewExpressionRule(name string, expression string, schema Schema, facts Facts) (*ExpressionRule, error) {
+    env, err := expressionEnv(schema, facts)
+    if err != nil {
+        return nil, &ExpressionError{Expression: expression, Err: err}
+    }
+
+    parsed, issues := env.Parse(expression)
+    if issues != nil && issues.Err() != nil {
+        return nil, &ExpressionError{Expression: expression, Err: issues.Err()}
+    }
+    // checking rewrites qualified names, so find the fields and facts before
+    // it does
+    fields := referencedFields(parsed.NativeRep().Expr())
+    observed := Facts{}
+    for _, name := range referencedFacts(parsed.NativeRep().Expr()) {
+        if observe, ok := facts[name]; ok {
+            observed[name] = observe
+        }
+    }
+
+    ast, issues := env.Check(parsed)
+    if issues != nil && issues.Err() != nil {
+        return nil, &ExpressionError{Expression: expression, Err: issues.Err()}
+    }
+    if ast.OutputType() != cel.BoolType {
+        return nil, &ExpressionError{
+            Expression: expression,
+            Err:        fmt.Errorf("expression must evaluate to a bool, not %v", ast.OutputType()),
+        }
+    }
+
+    program, err := env.Program(ast)
+    if err != nil {
+        return nil, &ExpressionError{Expression: expression, Err: err}
+    }
+
+    return &ExpressionRule{
+        name:       name,
+        expression: expression,
+        fields:     fields,
+        facts:      observed,
+        program:    program,
+    }, nil
+}
+
+// Checks that an expression parses, without type-checking it against the
+// license, so rules can be validated before the license is available
+func ValidateExpression(expression string) error {
+    env, err := expressionEnv(nil, nil)
+    if err != nil {
+        return &ExpressionError{Expression: expression, Err: err}
+    }
+    if _, issues := env.Parse(expression); issues != nil && issues.Err() != nil {
+        return &ExpressionError{Expression: expression, Err: issues.Err()}
+    }
+    return nil
+}
+
+// Derives the schema for a set of expressions by fetching every license field
+// they reference, a field that doesn't exist in the license makes the
+// expression invalid. Any other error fetching a field, like the Replicated
+// SDK being unavailable, is returned as it is so the check can be retried.
+func DiscoverSchema(sdkClient client.ReplicatedClient, expressions ...string) (Schema, error) {
+    env, err := cel.NewEnv()
+    if err != nil {
+        return nil, err
+    }
+
+    schema := Schema{}
+    for _, expression := range expressions {
+        ast, issues := env.Parse(expression)
+        if issues != nil && issues.Err() != nil {
+            return nil, &ExpressionError{Expression: expression, Err: issues.Err()}
+        }
+        for _, name := range referencedFields(ast.NativeRep().Expr()) {
+            if _, ok := schema[name]; ok {
+                continue
+            }
+            field, err := sdkClient.GetLicenseField(name)
+            if err != nil && !errors.Is(err, ErrFieldNotFound) {
+                return nil, fmt.Errorf("license field %s: %w", name, err)
+            }
+            if field == nil {
+                return nil, &ExpressionError{Expression: expression, Err: fieldNotFound(name)}
+            }
+            schema[name] = field.ValueType
+        }
+    }
+    return schema, nil
+}
+
+// Compiles a set of expressions into rules named for the expression itself,
+// discovering the schema from the license first
+func CompileExpressions(sdkClient client.ReplicatedClient, facts Facts, expressions ...string) ([]Rule, error) {
+    schema, err := DiscoverSchema(sdkClient, expressions...)
+    if err != nil {
+        return nil, err
+    }
+
+    rules := []Rule{}
+    for _, expression := range expressions {
+        rule, err := NewExpressionRule(expression, expression, schema, facts)
+        if err != nil {
+            return nil, err
+        }
+        rules = append(rules, rule)
+    }
+    return rules, nil
+}
+
+func (r *ExpressionRule) Name() string {
+    return r.name
+}
+
+// Returns the source of the expression
+func (r *ExpressionRule) Expression() string {
+    return r.expression
+}
+
+func (r *ExpressionRule) Evaluate(sdkClient client.ReplicatedClient) error {
+    return r.EvaluateContext(context.Background(), sdkClient)
+}
+
+func (r *ExpressionRule) EvaluateContext(ctx context.Context, sdkClient client.ReplicatedClient) error {
+    activation, err := r.activation(ctx, sdkClient)
+    if err != nil {
+        return err
+    }
+
+    value, _, err := r.program.Eval(activation)
+    if err != nil {
+        return fmt.Errorf("evaluating %q: %w", r.expression, err)
+    }
+    if satisfied, ok := value.Value().(bool); !ok || !satisfied {
+        return fmt.Errorf("%q is not satisfied", r.expression)
+    }
+    return nil
+}
+
+func (r *ExpressionRule) activation(ctx context.Context, sdkClient client.ReplicatedClient) (map[string]any, error) {
+    expiration, err := sdkClient.GetExpirationDate()
+    if err != nil {
+        return nil, readFailure(fmt.Errorf("could not get license expiration: %w", err))
+    }
+    name, _ := sdkClient.GetAppName()
+    slug, _ := sdkClient.GetAppSlug()
+
+    activation := map[string]any{
+        "now":               time.Now(),
+        "license.expiresAt": expiration,
+        "license.perpetual": client.IsPerpetual(expiration),
+        "license.appName":   name,
+        "license.appSlug":   slug,
+    }
+
+    for _, name := range r.fields {
+        field, err := sdkClient.GetLicenseField(name)
+        if err != nil {
+            return nil, readFailure(fmt.Errorf("could not get license field %s: %w", name, err))
+        }
+        if field == nil {
+            return nil, fieldNotFound(name)
+        }
+        value, err := expressionValue(field)
+        if err != nil {
+            return nil, err
+        }
+        activation["license.fields."+name] = value
+    }
+
+    for name, observe := range r.facts {
+        observed, err := observe(ctx)
+        if err != nil {
+            return nil, fmt.Errorf("could not observe cluster.%s: %w", name, err)
+        }
+        activation["cluster."+name] = observed
+    }
+
+    return activation, nil
+}
+
+func expressionEnv(schema Schema, facts Facts) (*cel.Env, error) {
+    options := []cel.EnvOption{
+        cel.Variable("now", cel.TimestampType),
+        cel.Variable("license.expiresAt", cel.TimestampType),
+        cel.Variable("license.perpetual", cel.BoolType),
+        cel.Variable("license.appName", cel.StringType),
+        cel.Variable("license.appSlug", cel.StringType),
+    }
+
+    for name, valueType := range schema {
+        celType, err := expressionType(valueType)
+        if err != nil {
+            return nil, fmt.Errorf("license field %s: %w", name, err)
+        }
+        options = append(options, cel.Variable("license.fields."+name, celType))
+    }
+
+    for name := range facts {
+        options = append(options, cel.Variable("cluster."+name, cel.IntType))
+    }
+
+    return cel.NewEnv(options...)
+}
+
+func expressionType(valueType string) (*cel.Type, error) {
+    switch valueType {
+    case "String", "Text":
+        return cel.StringType, nil
+    case "Integer":
+        return cel.IntType, nil
+    case "Boolean":
+        return cel.BoolType, nil
+    }
+    return nil, fmt.Errorf("value type %q cannot be used in an expression", valueType)
+}
+
+func expressionValue(field *license.LicenseField) (any, error) {
+    switch field.ValueType {
+    case "String", "Text":
+        return stringValue(field)
+    case "Integer":
+        return integerValue(field)
+    case "Boolean":
+        return booleanValue(field)
+    }
+    return nil, fmt.Errorf("value type %q of license field %s cannot be used in an expression", field.ValueType, field.Name)
+}
+
+// finds the names of every `license.fields.<name>` selection in the expression
+func referencedFields(expr celast.Expr) []string {
+    seen := map[string]bool{}
+    fields := []string{}
+    celast.PostOrderVisit(expr, celast.NewExprVisitor(func(e celast.Expr) {
+        if e.Kind() != celast.SelectKind {
+            return
+        }
+        selection := e.AsSelect()
+        operand := selection.Operand()
+        if operand.Kind() != celast.SelectKind || operand.AsSelect().FieldName() != "fields" {
+            return
+        }
+        root := operand.AsSelect().Operand()
+        if root.Kind() != celast.IdentKind || root.AsIdent() != "license" {
+            return
+        }
+        if !seen[selection.FieldName()] {
+            seen[selection.FieldName()] = true
+            fields = append(fields, selection.FieldName())
+        }
+    }))
+    return fields
+}
+
+// finds the names of every `cluster.<name>` selection in the expression
+func referencedFacts(expr celast.Expr) []string {
+    seen := map[string]bool{}
+    facts := []string{}
+    celast.PostOrderVisit(expr, celast.NewExprVisitor(func(e celast.Expr) {
+        if e.Kind() != celast.SelectKind {
+            return
+        }
+        selection := e.AsSelect()
+        operand := selection.Operand()
+        if operand.Kind() != celast.IdentKind || operand.AsIdent() != "cluster" {
+            return
+        }
+        if !seen[selection.FieldName()] {
+            seen[selection.FieldName()] = true
+            facts = append(facts, selection.FieldName())
+        }
+    }))
+    return facts
+}
@@ -0,0 +1,198 @@
+package enforce
+
+import (
+    "context"
+    "errors"
+    "time"
+    "testing"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/client"
+    "github.com/crdant/replicated-license-enforcer/pkg/events"
+
+    license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func seatsClient(expiration time.Time) *client.MockAPIClient {
+    return client.NewMockAPIClient("Slackernews", "slackernews-mackerel", expiration,
+        &license.LicenseField{Name: "max_seats", Value: float64(5), ValueType: "Integer"},
+        &license.LicenseField{Name: "is_enterprise", Value: true, ValueType: "Boolean"},
+        &license.LicenseField{Name: "tier", Value: "business", ValueType: "String"},
+    )
+}
+
+func nodes(count int64) Facts {
+    return Facts{"nodes": func(context.Context) (int64, error) { return count, nil }}
+}
+
+func TestExpressionSatisfied(t *testing.T) {
+    sdkClient := seatsClient(time.Now().Add(30 * 24 * time.Hour))
+    rules, err := CompileExpressions(sdkClient, nodes(3),
+        "license.fields.max_seats >= cluster.nodes && license.expiresAt > now + duration('72h')",
+        "license.fields.is_enterprise && license.fields.tier == 'business'",
+        "license.appSlug.startsWith('slackernews')",
+    )
+    require.NoError(t, err)
+    require.Len(t, rules, 3)
+
+    result := NewPolicy(rules...).Evaluate(sdkClient)
+    assert.True(t, result.Passed())
+}
+
+func TestExpressionNotSatisfied(t *testing.T) {
+    sdkClient := seatsClient(time.Now().Add(24 * time.Hour))
+    rules, err := CompileExpressions(sdkClient, nodes(6),
+        "license.fields.max_seats >= cluster.nodes",
+        "license.expiresAt > now + duration('72h')",
+    )
+    require.NoError(t, err)
+
+    result := NewPolicy(rules...).Evaluate(sdkClient)
+    assert.Len(t, result.Failures(), 2)
+}
+
+func TestExpressionTypeMismatch(t *testing.T) {
+    schema := Schema{"max_seats": "Integer"}
+    _, err := NewExpressionRule("seats", "license.fields.max_seats == 'five'", schema, nil)
+
+    var expressionErr *ExpressionError
+    require.True(t, errors.As(err, &expressionErr))
+    assert.Equal(t, "license.fields.max_seats == 'five'", expressionErr.Expression)
+}
+
+func TestExpressionUndeclaredReference(t *testing.T) {
+    schema := Schema{"max_seats": "Integer"}
+    _, err := NewExpressionRule("seats", "license.fields.max_seats >= cluster.nodez", schema, nodes(1))
+    assert.Error(t, err)
+
+    _, err = NewExpressionRule("seats", "license.fields.max_seat >= 1", schema, nil)
+    assert.Error(t, err)
+}
+
+func TestExpressionMustBeBoolean(t *testing.T) {
+    schema := Schema{"max_seats": "Integer"}
+    _, err := NewExpressionRule("seats", "license.fields.max_seats + 1", schema, nil)
+    assert.ErrorContains(t, err, "must evaluate to a bool")
+}
+
+func TestExpressionUnsupportedFieldType(t *testing.T) {
+    schema := Schema{"logo": "File"}
+    _, err := NewExpressionRule("logo", "license.fields.logo != ''", schema, nil)
+    assert.Error(t, err)
+}
+
+func TestDiscoverSchema(t *testing.T) {
+    sdkClient := seatsClient(time.Now().Add(24 * time.Hour))
+    schema, err := DiscoverSchema(sdkClient,
+        "license.fields.max_seats > 1 && license.fields.tier == 'business'",
+        "license.fields.max_seats < 100 && 'license.fields.ignored' != ''",
+    )
+    require.NoError(t, err)
+    assert.Equal(t, Schema{"max_seats": "Integer", "tier": "String"}, schema)
+}
+
+func TestDiscoverSchemaMissingField(t *testing.T) {
+    sdkClient := seatsClient(time.Now().Add(24 * time.Hour))
+    sdkClient.On("GetLicenseField", "max_seets").Return(nil, nil)
+
+    _, err := DiscoverSchema(sdkClient, "license.fields.max_seets > 1")
+
+    var expressionErr *ExpressionError
+    assert.True(t, errors.As(err, &expressionErr))
+}
+
+func unavailableSeatsClient() *client.MockAPIClient {
+    sdkClient := seatsClient(time.Now().Add(24 * time.Hour))
+    sdkClient.On("GetLicenseField", "seats").Return(nil, &client.RequestError{URL: "/api/v1/license/fields/seats", StatusCode: 503}).Once()
+    sdkClient.On("GetLicenseField", "seats").Return(&license.LicenseField{Name: "seats", Value: float64(10), ValueType: "Integer"}, nil)
+    return sdkClient
+}
+
+func TestDiscoverSchemaUnavailableSDK(t *testing.T) {
+    _, err := DiscoverSchema(unavailableSeatsClient(), "license.fields.seats > 5")
+    assert.ErrorIs(t, err, ErrSDKUnavailable)
+    assert.NotErrorIs(t, err, ErrInvalidExpression)
+    assert.Equal(t, ClassSDKUnavailable, ErrorClass(err))
+}
+
+func TestValidateRetriesCompilingWhenSDKUnavailable(t *testing.T) {
+    sdkClient := unavailableSeatsClient()
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient(), WithExpressions(nil, "license.fields.seats > 5"),
+        WithRetryPolicy(RetryPolicy{InitialInterval: time.Millisecond}))
+
+    result, err := enforcer.Validate()
+    require.NoError(t, err)
+    assert.True(t, result.Valid)
+    // the first attempt to compile the rule, then compiling and evaluating it
+    sdkClient.AssertNumberOfCalls(t, "GetLicenseField", 3)
+}
+
+func TestValidateStopsOnInvalidExpression(t *testing.T) {
+    sdkClient := seatsClient(time.Now().Add(24 * time.Hour))
+    k8sClient := events.NewMockEventClient()
+    enforcer := NewEnforcer(sdkClient, k8sClient, WithExpressions(nil, "license.fields.max_seats == 'five'"))
+
+    started := time.Now()
+    _, err := enforcer.Validate()
+
+    var expressionErr *ExpressionError
+    assert.True(t, errors.As(err, &expressionErr))
+    assert.Less(t, time.Since(started), time.Second)
+}
+
+func TestCheckWithExpressions(t *testing.T) {
+    sdkClient := seatsClient(time.Now().Add(24 * time.Hour))
+    k8sClient := events.NewMockEventClient()
+    enforcer := NewEnforcer(sdkClient, k8sClient,
+        WithPolicy(NewPolicy(RequireTrue("is_enterprise"))),
+        WithExpressions(nodes(10), "license.fields.max_seats >= cluster.nodes"),
+    )
+
+    _, err := enforcer.Check()
+
+    var policyErr *PolicyError
+    require.True(t, errors.As(err, &policyErr))
+    require.Len(t, policyErr.Result.Results, 2)
+    require.Len(t, policyErr.Result.Failures(), 1)
+    assert.Equal(t, "license.fields.max_seats >= cluster.nodes", policyErr.Result.Failures()[0].Rule)
+}
+
+func TestExpressionObservesReferencedFacts(t *testing.T) {
+    type key struct{}
+    observed := []context.Context{}
+    facts := Facts{
+        "nodes": func(ctx context.Context) (int64, error) {
+            observed = append(observed, ctx)
+            return 3, nil
+        },
+        // like listing nodes without permission to
+        "zones": func(context.Context) (int64, error) { return 0, errors.New("nodes is forbidden") },
+    }
+    enforcer := NewEnforcer(seatsClient(time.Now().Add(24*time.Hour)), events.NewMockEventClient(),
+        WithExpressions(facts, "license.fields.max_seats > 1", "license.fields.max_seats >= cluster.nodes"))
+
+    ctx := context.WithValue(t.Context(), key{}, "check")
+    _, err := enforcer.CheckContext(ctx)
+    require.NoError(t, err)
+    require.Len(t, observed, 1)
+    assert.Equal(t, "check", observed[0].Value(key{}))
+}
+
+func TestExpressionPerpetualLicense(t *testing.T) {
+    rule := "license.perpetual || license.expiresAt > now + duration('72h')"
+    enforcer := NewEnforcer(seatsClient(time.Time{}), events.NewMockEventClient(), WithExpressions(nil, rule))
+    _, err := enforcer.Check()
+    assert.NoError(t, err)
+
+    enforcer = NewEnforcer(seatsClient(time.Now().Add(24 * time.Hour)), events.NewMockEventClient(), WithExpressions(nil, rule))
+    _, err = enforcer.Check()
+    assert.ErrorIs(t, err, ErrPolicyNotSatisfied)
+}
+
+func TestValidateExpression(t *testing.T) {
+    assert.NoError(t, ValidateExpression("license.fields.max_seats >= cluster.nodes"))
+
+    err := ValidateExpression("license.fields.max_seats >=")
+    assert.ErrorIs(t, err, ErrInvalidExpression)
+}
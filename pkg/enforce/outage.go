@@ -0,0 +1,218 @@
+package enforce
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "time"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/client"
+    "github.com/crdant/replicated-license-enforcer/pkg/events"
+
+    "github.com/charmbracelet/log"
+    license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
+)
+
+// What the enforcer does when the license can't be checked because the
+// Replicated SDK is unavailable
+type OutageMode string
+
+const (
+    // Fails the check, so the application doesn't start until the SDK is
+    // back. This is the default.
+    FailClosed OutageMode = "fail-closed"
+
+    // Passes the check if the license was valid the last time it was checked,
+    // that check was recent enough, and the license hasn't expired since
+    FailOpen OutageMode = "fail-open"
+)
+
+// How old the last valid check can be for the enforcer to fail open, when the
+// outage policy doesn't say
+const DefaultOutageMaxAge = 24 * time.Hour
+
+// How `Validate` handles an outage of the Replicated SDK, once it's given up
+// retrying. Failing open uses the last valid check, which is kept in memory
+// and, when there's a snapshot path, in a file so it survives a restart.
+// Zero values fail closed, and use the default maximum age.
+type OutagePolicy struct {
+    Mode         OutageMode
+    MaxAge       time.Duration
+    SnapshotPath string
+}
+
+// Handles outages of the Replicated SDK according to the policy
+func WithOutagePolicy(policy OutagePolicy) Option {
+    return func(e *Enforcer) {
+        e.outage = policy
+    }
+}
+
+// Returns the outage mode with the name, `fail-closed` or `fail-open`
+func ParseOutageMode(mode string) (OutageMode, error) {
+    switch OutageMode(mode) {
+    case FailClosed, FailOpen:
+        return OutageMode(mode), nil
+    }
+    return "", fmt.Errorf("unknown outage policy %q, use %s or %s", mode, FailClosed, FailOpen)
+}
+
+// The last check that found the license valid, which the enforcer falls back
+// on when it fails open. The expiration date is kept as the `expires_at` field
+// the vendor signed, with its signature, and is verified again before the
+// enforcer trusts it. The rest of the snapshot isn't signed.
+type Snapshot struct {
+    Application string                `json:"application"`
+    AppSlug     string                `json:"appSlug"`
+    ExpiresAt   *license.LicenseField `json:"expiresAt"`
+    Signature   client.FieldSignature `json:"signature"`
+    VerifiedAt  time.Time             `json:"verifiedAt"`
+}
+
+// Reads a snapshot written by an enforcer with a snapshot path
+func LoadSnapshot(path string) (*Snapshot, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    snapshot := &Snapshot{}
+    if err := json.Unmarshal(data, snapshot); err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    return snapshot, nil
+}
+
+// remembers a check that found the license valid when the enforcer can fail
+// open, saving it to the snapshot path if there is one. Only clients that
+// return the signed expiration date can be snapshotted.
+func (e *Enforcer) recordSnapshot(ctx context.Context, result *Result) {
+    if e.outage.Mode != FailOpen {
+        return
+    }
+    signedClient, ok := e.sdkClient.(client.SignedExpirationClient)
+    if !ok {
+        log.Debug("Client doesn't return the signed expiration date, not saving a license snapshot")
+        return
+    }
+    expiresAt, signature, err := signedClient.GetSignedExpirationContext(ctx)
+    if err != nil {
+        log.Error("Error getting the signed expiration date for the license snapshot", "error", err)
+        return
+    }
+    snapshot := &Snapshot{
+        Application: result.Application,
+        AppSlug:     result.AppSlug,
+        ExpiresAt:   expiresAt,
+        Signature:   signature,
+        VerifiedAt:  result.CheckedAt,
+    }
+    e.mutex.Lock()
+    e.snapshot = snapshot
+    e.mutex.Unlock()
+
+    if e.outage.SnapshotPath == "" {
+        return
+    }
+    data, err := json.Marshal(snapshot)
+    if err == nil {
+        err = os.WriteFile(e.outage.SnapshotPath, data, 0600)
+    }
+    if err != nil {
+        log.Error("Error saving license snapshot", "path", e.outage.SnapshotPath, "error", err)
+    }
+}
+
+// returns the last check that found the license valid, from this enforcer or
+// from the snapshot file
+func (e *Enforcer) lastKnownGood() (*Snapshot, error) {
+    e.mutex.Lock()
+    snapshot := e.snapshot
+    e.mutex.Unlock()
+    if snapshot != nil {
+        return snapshot, nil
+    }
+    if e.outage.SnapshotPath == "" {
+        return nil, errors.New("the license hasn't been valid since the enforcer started")
+    }
+    return LoadSnapshot(e.outage.SnapshotPath)
+}
+
+// returns the verified expiration date of the snapshot, or why the snapshot
+// can't be trusted to stand in for a check
+func (e *Enforcer) usable(snapshot *Snapshot) (time.Time, error) {
+    maxAge := e.outage.MaxAge
+    if maxAge <= 0 {
+        maxAge = DefaultOutageMaxAge
+    }
+    if snapshot.VerifiedAt.After(time.Now()) {
+        return time.Time{}, fmt.Errorf("the license was verified in the future, at %v", snapshot.VerifiedAt)
+    }
+    if age := time.Since(snapshot.VerifiedAt); age > maxAge {
+        return time.Time{}, fmt.Errorf("the license was last verified %v ago, more than %v", age.Round(time.Second), maxAge)
+    }
+    if snapshot.ExpiresAt == nil {
+        return time.Time{}, errors.New("the snapshot doesn't have a signed expiration date")
+    }
+    expiration, err := client.VerifyExpiration(snapshot.ExpiresAt, snapshot.Signature, e.clientOptions...)
+    if err != nil {
+        return time.Time{}, fmt.Errorf("the snapshot's expiration date can't be verified: %w", err)
+    }
+    if e.licenseState(expiration) == StateExpired {
+        return time.Time{}, fmt.Errorf("the license expired at %v", expiration)
+    }
+    return expiration, nil
+}
+
+// decides whether a check that failed because the Replicated SDK is
+// unavailable passes anyway, recording an event for the decision either way.
+// Passing updates the result to the last known good license, and records it
+// as the outcome of the check for `Status` and `Run`.
+func (e *Enforcer) handleOutage(ctx context.Context, result *Result, err error) bool {
+    if result == nil || !errors.Is(err, ErrSDKUnavailable) {
+        return false
+    }
+    eventClient := events.WithContext(ctx, e.eventClient)
+
+    if e.outage.Mode == FailOpen {
+        snapshot, snapshotErr := e.lastKnownGood()
+        var expiration time.Time
+        if snapshotErr == nil {
+            expiration, snapshotErr = e.usable(snapshot)
+        }
+        if snapshotErr == nil {
+            log.Warn("Replicated SDK is unavailable, failing open with the last known good license", "verifiedAt", snapshot.VerifiedAt, "error", err)
+            if eventErr := eventClient.CreateFailedOpenEvent(snapshot.AppSlug, snapshot.VerifiedAt, err); eventErr != nil {
+                log.Error("Error recording failing open", "error", eventErr)
+            }
+            state := e.licenseState(expiration)
+            result.failOpen(snapshot, expiration, state)
+
+            e.mutex.Lock()
+            e.last, e.lastErr = result, nil
+            e.mutex.Unlock()
+            e.record(ctx, Transition{Application: snapshot.AppSlug, Expiration: expiration, State: state, Valid: true, FailedOpen: true})
+            return true
+        }
+        log.Warn("Replicated SDK is unavailable and there's no last known good license to fail open with", "reason", snapshotErr)
+    }
+
+    log.Error("Replicated SDK is unavailable, failing closed", "error", err)
+    if eventErr := eventClient.CreateFailedClosedEvent(e.eventApplication(), err); eventErr != nil {
+        log.Error("Error recording failing closed", "error", eventErr)
+    }
+    return false
+}
+
+// the application to record events against when the check didn't get as far
+// as reading the license
+func (e *Enforcer) eventApplication() string {
+    if application := e.Status().Application; application != "" {
+        return application
+    }
+    if snapshot, err := e.lastKnownGood(); err == nil && snapshot.AppSlug != "" {
+        return snapshot.AppSlug
+    }
+    return "license-enforcer"
+}
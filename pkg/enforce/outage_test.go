@@ -0,0 +1,242 @@
+package enforce
+
+import (
+    "context"
+    "crypto/ed25519"
+    "crypto/rand"
+    "encoding/base64"
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/client"
+    "github.com/crdant/replicated-license-enforcer/pkg/events"
+
+    license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+// a client for a Replicated SDK that can't be reached
+func unavailableClient() *client.MockAPIClient {
+    sdkClient := &client.MockAPIClient{}
+    sdkClient.On("GetExpirationDate").Return(time.Time{}, &client.RequestError{URL: "/api/v1/license/fields/expires_at", StatusCode: 503})
+    return sdkClient
+}
+
+// gives up on the first failure so outages are decided right away
+var noRetries = WithRetryPolicy(RetryPolicy{MaxAttempts: 1})
+
+// signs expiration dates the way the vendor does, with a key the enforcer
+// trusts when it's created with the signer's option
+type expirationSigner struct {
+    private ed25519.PrivateKey
+    trust   Option
+}
+
+func newExpirationSigner(t *testing.T) *expirationSigner {
+    public, private, err := ed25519.GenerateKey(rand.Reader)
+    require.NoError(t, err)
+    return &expirationSigner{private: private, trust: WithKeySet(client.KeySet{"test-ed25519": public})}
+}
+
+// returns the signed `expires_at` field, which is empty for a license that
+// doesn't expire
+func (s *expirationSigner) sign(expiration time.Time) (*license.LicenseField, client.FieldSignature) {
+    value := ""
+    if !expiration.IsZero() {
+        value = expiration.Format(time.RFC3339)
+    }
+    signature := base64.StdEncoding.EncodeToString(ed25519.Sign(s.private, []byte(value)))
+    return &license.LicenseField{Name: "expires_at", Value: value, ValueType: "String"}, client.FieldSignature{V3: signature}
+}
+
+// returns a snapshot of a check that found the license valid
+func (s *expirationSigner) snapshot(expiration time.Time, verifiedAt time.Time) *Snapshot {
+    expiresAt, signature := s.sign(expiration)
+    return &Snapshot{AppSlug: "slackernews-mackerel", ExpiresAt: expiresAt, Signature: signature, VerifiedAt: verifiedAt}
+}
+
+// a mock client that returns its expiration date signed, like the client for
+// the Replicated SDK
+type signedMockClient struct {
+    *client.MockAPIClient
+    signer     *expirationSigner
+    expiration time.Time
+}
+
+func newSignedMockClient(signer *expirationSigner, expiration time.Time) *signedMockClient {
+    return &signedMockClient{
+        MockAPIClient: client.NewMockAPIClient("Slackernews", "slackernews-mackerel", expiration),
+        signer:        signer,
+        expiration:    expiration,
+    }
+}
+
+func (c *signedMockClient) GetSignedExpirationContext(context.Context) (*license.LicenseField, client.FieldSignature, error) {
+    expiresAt, signature := c.signer.sign(c.expiration)
+    return expiresAt, signature, nil
+}
+
+func writeSnapshot(t *testing.T, snapshot *Snapshot) string {
+    data, err := json.Marshal(snapshot)
+    require.NoError(t, err)
+    path := filepath.Join(t.TempDir(), "snapshot.json")
+    require.NoError(t, os.WriteFile(path, data, 0600))
+    return path
+}
+
+func TestFailClosedByDefault(t *testing.T) {
+    eventClient := events.NewMockEventClient()
+    enforcer := NewEnforcer(unavailableClient(), eventClient, noRetries)
+
+    result, err := enforcer.Validate()
+    assert.ErrorIs(t, err, ErrSDKUnavailable)
+    assert.False(t, result.Valid)
+    assert.False(t, result.FailedOpen)
+
+    event, err := eventClient.FindLicenseEvent(events.ReasonFailedClosed, events.ApplicationLabels("license-enforcer"))
+    require.NoError(t, err)
+    require.NotNil(t, event)
+    assert.Equal(t, int32(1), event.Count)
+}
+
+func TestFailOpenAfterRestart(t *testing.T) {
+    signer := newExpirationSigner(t)
+    path := filepath.Join(t.TempDir(), "snapshot.json")
+    policy := WithOutagePolicy(OutagePolicy{Mode: FailOpen, MaxAge: time.Hour, SnapshotPath: path})
+    expiration := time.Now().Add(10 * 24 * time.Hour).Truncate(time.Second)
+
+    // an enforcer that could reach the SDK saves the valid license
+    _, err := NewEnforcer(newSignedMockClient(signer, expiration), events.NewMockEventClient(), policy, signer.trust).Check()
+    require.NoError(t, err)
+    snapshot, err := LoadSnapshot(path)
+    require.NoError(t, err)
+    assert.Equal(t, "slackernews-mackerel", snapshot.AppSlug)
+    assert.Equal(t, expiration.Format(time.RFC3339), snapshot.ExpiresAt.Value)
+    assert.NotEmpty(t, snapshot.Signature.V3)
+    info, err := os.Stat(path)
+    require.NoError(t, err)
+    assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+    eventClient := events.NewMockEventClient()
+    result, err := NewEnforcer(unavailableClient(), eventClient, policy, signer.trust, noRetries).Validate()
+    require.NoError(t, err)
+    assert.True(t, result.Valid)
+    assert.True(t, result.FailedOpen)
+    assert.Equal(t, StateValid, result.State)
+    assert.Equal(t, ClassSDKUnavailable, result.ErrorClass)
+    assert.True(t, snapshot.VerifiedAt.Equal(*result.LastVerified))
+    assert.Equal(t, 9, *result.DaysRemaining)
+
+    event, err := eventClient.FindLicenseEvent(events.ReasonFailedOpen, events.ApplicationLabels("slackernews-mackerel"))
+    require.NoError(t, err)
+    require.NotNil(t, event)
+}
+
+func TestFailOpenInMemory(t *testing.T) {
+    signer := newExpirationSigner(t)
+    enforcer := NewEnforcer(newSignedMockClient(signer, time.Time{}), events.NewMockEventClient(),
+        WithOutagePolicy(OutagePolicy{Mode: FailOpen}), signer.trust, noRetries)
+    _, err := enforcer.Validate()
+    require.NoError(t, err)
+
+    enforcer.sdkClient = unavailableClient()
+    result, err := enforcer.Validate()
+    require.NoError(t, err)
+    assert.True(t, result.FailedOpen)
+    assert.True(t, result.Perpetual)
+}
+
+func TestFailOpenStatus(t *testing.T) {
+    signer := newExpirationSigner(t)
+    expiration := time.Now().Add(10 * 24 * time.Hour).Truncate(time.Second)
+    path := writeSnapshot(t, signer.snapshot(expiration, time.Now().Add(-time.Minute)))
+    enforcer := NewEnforcer(unavailableClient(), events.NewMockEventClient(), noRetries, signer.trust,
+        WithOutagePolicy(OutagePolicy{Mode: FailOpen, SnapshotPath: path}))
+
+    _, err := enforcer.Validate()
+    require.NoError(t, err)
+    status := enforcer.Status()
+    assert.True(t, status.Valid)
+    assert.True(t, status.FailedOpen)
+    assert.Equal(t, StateValid, status.State)
+    assert.Equal(t, "slackernews-mackerel", status.Application)
+    assert.True(t, expiration.Equal(status.Expiration))
+    assert.Empty(t, status.Error)
+
+    require.NoError(t, enforcer.Reschedule(time.Hour))
+    ctx, cancel := context.WithCancel(t.Context())
+    cancel()
+    result, err := enforcer.Run(ctx)
+    require.NoError(t, err)
+    assert.True(t, result.FailedOpen)
+}
+
+func TestFailOpenFallsBackToClosed(t *testing.T) {
+    signer := newExpirationSigner(t)
+    recently := time.Now().Add(-time.Minute)
+    tampered := signer.snapshot(time.Now().Add(-time.Hour), recently)
+    tampered.ExpiresAt.Value = time.Now().Add(time.Hour).Format(time.RFC3339)
+    unsigned := signer.snapshot(time.Time{}, recently)
+    unsigned.ExpiresAt = nil
+
+    tests := []struct {
+        name     string
+        snapshot *Snapshot
+    }{
+        {"no snapshot", nil},
+        {"stale", signer.snapshot(time.Time{}, time.Now().Add(-2 * time.Hour))},
+        {"expired", signer.snapshot(time.Now().Add(-time.Second), recently)},
+        {"from the future", signer.snapshot(time.Time{}, time.Now().Add(time.Hour))},
+        {"tampered", tampered},
+        {"unsigned", unsigned},
+        {"signed by another key", newExpirationSigner(t).snapshot(time.Time{}, recently)},
+    }
+    for _, test := range tests {
+        path := filepath.Join(t.TempDir(), "missing.json")
+        if test.snapshot != nil {
+            path = writeSnapshot(t, test.snapshot)
+        }
+        eventClient := events.NewMockEventClient()
+        enforcer := NewEnforcer(unavailableClient(), eventClient, noRetries, signer.trust,
+            WithOutagePolicy(OutagePolicy{Mode: FailOpen, MaxAge: time.Hour, SnapshotPath: path}))
+
+        result, err := enforcer.Validate()
+        assert.ErrorIs(t, err, ErrSDKUnavailable, test.name)
+        assert.False(t, result.FailedOpen, test.name)
+
+        application := "license-enforcer"
+        if test.snapshot != nil {
+            application = test.snapshot.AppSlug
+        }
+        event, err := eventClient.FindLicenseEvent(events.ReasonFailedClosed, events.ApplicationLabels(application))
+        require.NoError(t, err, test.name)
+        assert.NotNil(t, event, test.name)
+    }
+}
+
+func TestFailOpenOnlyForOutages(t *testing.T) {
+    eventClient := events.NewMockEventClient()
+    past := time.Now().Add(-time.Hour)
+    path := writeSnapshot(t, newExpirationSigner(t).snapshot(time.Time{}, time.Now()))
+    enforcer := NewEnforcer(client.NewMockAPIClient("Slackernews", "slackernews-mackerel", past), eventClient,
+        WithOutagePolicy(OutagePolicy{Mode: FailOpen, SnapshotPath: path}))
+
+    _, err := enforcer.Validate()
+    assert.ErrorIs(t, err, ErrLicenseExpired)
+    event, err := eventClient.FindLicenseEvent(events.ReasonFailedOpen, events.ApplicationLabels("slackernews-mackerel"))
+    require.NoError(t, err)
+    assert.Nil(t, event)
+}
+
+func TestParseOutageMode(t *testing.T) {
+    mode, err := ParseOutageMode("fail-open")
+    require.NoError(t, err)
+    assert.Equal(t, FailOpen, mode)
+
+    _, err = ParseOutageMode("fail-sometimes")
+    assert.EqualError(t, err, `unknown outage policy "fail-sometimes", use fail-closed or fail-open`)
+}
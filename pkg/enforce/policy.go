@@ -0,0 +1,278 @@
+package enforce
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/client"
+
+    license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
+)
+
+// A rule that the license has to satisfy beyond not being expired, usually
+// a requirement on one of the custom entitlements in the license
+type Rule interface {
+    Name() string
+    Evaluate(sdkClient client.ReplicatedClient) error
+}
+
+// A rule that can abandon what it observes when a context is done. The
+// enforcer evaluates rules that implement it with the context of the check.
+type ContextRule interface {
+    Rule
+    EvaluateContext(ctx context.Context, sdkClient client.ReplicatedClient) error
+}
+
+// Provides a value observed at the time the policy is evaluated, for example
+// the number of nodes in the cluster, so it can be compared to a license
+// entitlement. The context is done when the check is abandoned.
+type Observation func(ctx context.Context) (int64, error)
+
+// A set of rules evaluated together every time the license is checked
+type Policy struct {
+    rules []Rule
+}
+
+// The outcome of evaluating a single rule
+type RuleResult struct {
+    Rule  string
+    Error error
+}
+
+// Returns true when the rule was satisfied by the license
+func (r RuleResult) Passed() bool {
+    return r.Error == nil
+}
+
+// The outcome of evaluating every rule in a policy
+type PolicyResult struct {
+    Results []RuleResult
+}
+
+// Returns true when every rule in the policy was satisfied
+func (r *PolicyResult) Passed() bool {
+    return len(r.Failures()) == 0
+}
+
+// Returns the results for the rules that were not satisfied
+func (r *PolicyResult) Failures() []RuleResult {
+    failures := []RuleResult{}
+    for _, result := range r.Results {
+        if !result.Passed() {
+            failures = append(failures, result)
+        }
+    }
+    return failures
+}
+
+// Returns the first error that kept a rule from being evaluated at all, for
+// example because the Replicated SDK is unavailable, or nil if every rule
+// was evaluated. A policy that couldn't be evaluated isn't a policy the
+// license doesn't satisfy, so the check fails with this error instead.
+func (r *PolicyResult) Err() error {
+    for _, result := range r.Results {
+        var unevaluated *unevaluatedError
+        if errors.As(result.Error, &unevaluated) {
+            return unevaluated.err
+        }
+    }
+    return nil
+}
+
+// a rule that couldn't be evaluated because the license couldn't be read
+type unevaluatedError struct {
+    err error
+}
+
+func (e *unevaluatedError) Error() string {
+    return e.err.Error()
+}
+
+func (e *unevaluatedError) Unwrap() error {
+    return e.err
+}
+
+// classifies an error reading the license for a rule. A field that's missing
+// or isn't signed properly means the license doesn't satisfy the rule, any
+// other error means the rule couldn't be evaluated.
+func readFailure(err error) error {
+    switch ErrorClass(err) {
+    case ClassFieldNotFound, ClassTampered, ClassSignatureInvalid:
+        return err
+    }
+    return &unevaluatedError{err: err}
+}
+
+// Returned from a license check when the license is not expired but does not
+// satisfy the enforcer's policy, use `errors.As` to get to the result and see
+// which rules failed
+type PolicyError struct {
+    Result *PolicyResult
+}
+
+func (e *PolicyError) Error() string {
+    failures := []string{}
+    for _, failure := range e.Result.Failures() {
+        failures = append(failures, fmt.Sprintf("%s: %v", failure.Rule, failure.Error))
+    }
+    return fmt.Sprintf("license does not satisfy policy (%s)", strings.Join(failures, "; "))
+}
+
+// Creates a policy from a set of rules
+func NewPolicy(rules ...Rule) *Policy {
+    return &Policy{rules: rules}
+}
+
+// Returns the rules in the policy
+func (p *Policy) Rules() []Rule {
+    return p.rules
+}
+
+// Evaluates every rule in the policy against the license, rules are all
+// evaluated even if an earlier one fails so the result names every failure
+func (p *Policy) Evaluate(sdkClient client.ReplicatedClient) *PolicyResult {
+    return p.EvaluateContext(context.Background(), sdkClient)
+}
+
+// Evaluates every rule in the policy, passing the context to the rules that
+// implement `ContextRule`
+func (p *Policy) EvaluateContext(ctx context.Context, sdkClient client.ReplicatedClient) *PolicyResult {
+    result := &PolicyResult{Results: []RuleResult{}}
+    for _, rule := range p.rules {
+        var err error
+        if contextRule, ok := rule.(ContextRule); ok {
+            err = contextRule.EvaluateContext(ctx, sdkClient)
+        } else {
+            err = rule.Evaluate(sdkClient)
+        }
+        result.Results = append(result.Results, RuleResult{Rule: rule.Name(), Error: err})
+    }
+    return result
+}
+
+type fieldRule struct {
+    name  string
+    field string
+    check func(ctx context.Context, field *license.LicenseField) error
+}
+
+func (r *fieldRule) Name() string {
+    return r.name
+}
+
+func (r *fieldRule) Evaluate(sdkClient client.ReplicatedClient) error {
+    return r.EvaluateContext(context.Background(), sdkClient)
+}
+
+func (r *fieldRule) EvaluateContext(ctx context.Context, sdkClient client.ReplicatedClient) error {
+    field, err := sdkClient.GetLicenseField(r.field)
+    if err != nil {
+        return readFailure(fmt.Errorf("could not get license field %s: %w", r.field, err))
+    }
+    if field == nil {
+        return fieldNotFound(r.field)
+    }
+    return r.check(ctx, field)
+}
+
+// Requires a boolean license field to be true, for example a field
+// `is_enterprise` or `feature_x_enabled`
+func RequireTrue(field string) Rule {
+    return &fieldRule{
+        name:  fmt.Sprintf("%s is true", field),
+        field: field,
+        check: func(_ context.Context, licenseField *license.LicenseField) error {
+            value, err := booleanValue(licenseField)
+            if err != nil {
+                return err
+            }
+            if !value {
+                return fmt.Errorf("%s is false", field)
+            }
+            return nil
+        },
+    }
+}
+
+// Requires a string or text license field to have one of the provided
+// values, useful for tiers like `enterprise` or `business`
+func RequireOneOf(field string, values ...string) Rule {
+    return &fieldRule{
+        name:  fmt.Sprintf("%s is one of [%s]", field, strings.Join(values, ", ")),
+        field: field,
+        check: func(_ context.Context, licenseField *license.LicenseField) error {
+            value, err := stringValue(licenseField)
+            if err != nil {
+                return err
+            }
+            for _, allowed := range values {
+                if value == allowed {
+                    return nil
+                }
+            }
+            return fmt.Errorf("%s is %q", field, value)
+        },
+    }
+}
+
+// Requires an integer license field to be at least the provided minimum
+func RequireAtLeast(field string, minimum int64) Rule {
+    return coversRule(fmt.Sprintf("%s >= %d", field, minimum), field, func(context.Context) (int64, error) {
+        return minimum, nil
+    })
+}
+
+// Requires an integer license field to be greater than or equal to a value
+// observed when the rule is evaluated, for example a field `max_nodes`
+// compared to the number of nodes in the cluster
+func RequireCovers(field string, observe Observation) Rule {
+    return coversRule(fmt.Sprintf("%s >= observed value", field), field, observe)
+}
+
+func coversRule(name string, field string, observe Observation) Rule {
+    return &fieldRule{
+        name:  name,
+        field: field,
+        check: func(ctx context.Context, licenseField *license.LicenseField) error {
+            value, err := integerValue(licenseField)
+            if err != nil {
+                return err
+            }
+            observed, err := observe(ctx)
+            if err != nil {
+                return fmt.Errorf("could not observe value to compare to %s: %w", field, err)
+            }
+            if value < observed {
+                return fmt.Errorf("%s is %d, observed %d", field, value, observed)
+            }
+            return nil
+        },
+    }
+}
+
+func booleanValue(field *license.LicenseField) (bool, error) {
+    value, ok := field.Value.(bool)
+    if !ok || field.ValueType != "Boolean" {
+        return false, fmt.Errorf("%s is not a boolean field", field.Name)
+    }
+    return value, nil
+}
+
+func stringValue(field *license.LicenseField) (string, error) {
+    value, ok := field.Value.(string)
+    if !ok || (field.ValueType != "String" && field.ValueType != "Text") {
+        return "", fmt.Errorf("%s is not a string field", field.Name)
+    }
+    return value, nil
+}
+
+func integerValue(field *license.LicenseField) (int64, error) {
+    // JSON numbers are decoded as floats
+    value, ok := field.Value.(float64)
+    if !ok || field.ValueType != "Integer" {
+        return 0, fmt.Errorf("%s is not an integer field", field.Name)
+    }
+    return int64(value), nil
+}
@@ -0,0 +1,137 @@
+package enforce
+
+import (
+    "context"
+    "errors"
+    "time"
+    "testing"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/client"
+    "github.com/crdant/replicated-license-enforcer/pkg/events"
+
+    license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func entitlementClient(expiration time.Time) *client.MockAPIClient {
+    return client.NewMockAPIClient("Slackernews", "slackernews-mackerel", expiration,
+        &license.LicenseField{Name: "is_enterprise", Value: true, ValueType: "Boolean"},
+        &license.LicenseField{Name: "feature_x_enabled", Value: false, ValueType: "Boolean"},
+        &license.LicenseField{Name: "tier", Value: "business", ValueType: "String"},
+        &license.LicenseField{Name: "max_nodes", Value: float64(5), ValueType: "Integer"},
+    )
+}
+
+func TestPolicyPasses(t *testing.T) {
+    sdkClient := entitlementClient(time.Now().Add(24 * time.Hour))
+    policy := NewPolicy(
+        RequireTrue("is_enterprise"),
+        RequireOneOf("tier", "business", "enterprise"),
+        RequireAtLeast("max_nodes", 3),
+        RequireCovers("max_nodes", func(context.Context) (int64, error) { return 5, nil }),
+    )
+
+    result := policy.Evaluate(sdkClient)
+    assert.True(t, result.Passed())
+    assert.Len(t, result.Results, 4)
+    assert.Empty(t, result.Failures())
+}
+
+func TestPolicyNamesEveryFailure(t *testing.T) {
+    sdkClient := entitlementClient(time.Now().Add(24 * time.Hour))
+    policy := NewPolicy(
+        RequireTrue("is_enterprise"),
+        RequireTrue("feature_x_enabled"),
+        RequireOneOf("tier", "enterprise"),
+        RequireCovers("max_nodes", func(context.Context) (int64, error) { return 6, nil }),
+    )
+
+    result := policy.Evaluate(sdkClient)
+    assert.False(t, result.Passed())
+
+    failures := result.Failures()
+    require.Len(t, failures, 3)
+    assert.Equal(t, "feature_x_enabled is true", failures[0].Rule)
+    assert.Equal(t, "tier is one of [enterprise]", failures[1].Rule)
+    assert.Equal(t, "max_nodes >= observed value", failures[2].Rule)
+}
+
+func TestPolicyWrongFieldType(t *testing.T) {
+    sdkClient := entitlementClient(time.Now().Add(24 * time.Hour))
+    policy := NewPolicy(RequireTrue("tier"), RequireAtLeast("is_enterprise", 1))
+
+    result := policy.Evaluate(sdkClient)
+    assert.Len(t, result.Failures(), 2)
+}
+
+func TestPolicyObservationError(t *testing.T) {
+    sdkClient := entitlementClient(time.Now().Add(24 * time.Hour))
+    policy := NewPolicy(RequireCovers("max_nodes", func(context.Context) (int64, error) {
+        return 0, errors.New("cannot count nodes")
+    }))
+
+    result := policy.Evaluate(sdkClient)
+    require.Len(t, result.Failures(), 1)
+    assert.ErrorContains(t, result.Failures()[0].Error, "cannot count nodes")
+}
+
+func TestCheckWithFailingPolicy(t *testing.T) {
+    future := time.Now().Add(24 * time.Hour)
+    sdkClient := entitlementClient(future)
+    k8sClient := events.NewMockEventClient()
+    enforcer := NewEnforcer(sdkClient, k8sClient, WithPolicy(NewPolicy(RequireTrue("feature_x_enabled"))))
+
+    _, err := enforcer.Check()
+    require.Error(t, err)
+
+    var policyErr *PolicyError
+    require.True(t, errors.As(err, &policyErr))
+    require.Len(t, policyErr.Result.Failures(), 1)
+    assert.Equal(t, "feature_x_enabled is true", policyErr.Result.Failures()[0].Rule)
+}
+
+func TestCheckWithPassingPolicy(t *testing.T) {
+    future := time.Now().Add(24 * time.Hour)
+    sdkClient := entitlementClient(future)
+    k8sClient := events.NewMockEventClient()
+    enforcer := NewEnforcer(sdkClient, k8sClient, WithPolicy(NewPolicy(RequireTrue("is_enterprise"))))
+
+    _, err := enforcer.Check()
+    assert.NoError(t, err)
+}
+
+func TestPolicyUnavailableSDK(t *testing.T) {
+    sdkClient := entitlementClient(time.Now().Add(24 * time.Hour))
+    sdkClient.On("GetLicenseField", "seats").Return(nil, &client.RequestError{URL: "/api/v1/license/fields/seats", StatusCode: 503})
+    sdkClient.On("GetLicenseField", "missing").Return(nil, &client.FieldError{Field: "missing", Err: client.ErrFieldNotFound})
+
+    result := NewPolicy(RequireAtLeast("seats", 5)).Evaluate(sdkClient)
+    assert.ErrorIs(t, result.Err(), ErrSDKUnavailable)
+
+    // a missing field is a rule the license doesn't satisfy
+    result = NewPolicy(RequireTrue("missing")).Evaluate(sdkClient)
+    assert.NoError(t, result.Err())
+    assert.Len(t, result.Failures(), 1)
+}
+
+func TestCheckRetriesRuleWhenSDKUnavailable(t *testing.T) {
+    sdkClient := entitlementClient(time.Now().Add(24 * time.Hour))
+    sdkClient.On("GetLicenseField", "seats").Return(nil, &client.RequestError{URL: "/api/v1/license/fields/seats", StatusCode: 503}).Once()
+    sdkClient.On("GetLicenseField", "seats").Return(&license.LicenseField{Name: "seats", Value: float64(10), ValueType: "Integer"}, nil)
+    action := &recordingAction{}
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient(),
+        WithPolicy(NewPolicy(RequireAtLeast("seats", 5))), WithActions(action),
+        WithRetryPolicy(RetryPolicy{InitialInterval: time.Millisecond}))
+
+    _, err := enforcer.Check()
+    assert.ErrorIs(t, err, ErrSDKUnavailable)
+    assert.False(t, IsPermanent(err))
+    assert.Empty(t, action.transitions)
+
+    result, err := enforcer.Validate()
+    require.NoError(t, err)
+    assert.True(t, result.Valid)
+    require.Len(t, action.transitions, 1)
+    assert.True(t, action.transitions[0].Valid)
+}
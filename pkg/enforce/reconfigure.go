@@ -0,0 +1,42 @@
+package enforce
+
+import (
+    "context"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/events"
+
+    "github.com/charmbracelet/log"
+)
+
+// Replaces the license rules written as CEL expressions, for example when the
+// configuration changes. The new expressions are compiled and type-checked
+// against the license first, so the current rules stay in place when any of
+// them is invalid. Rules from `WithPolicy` aren't replaced.
+func (e *Enforcer) ReplaceExpressions(facts Facts, expressions ...string) error {
+    // compiling reads the license from the SDK, so checks shouldn't wait on it
+    rules := []Rule{}
+    if len(expressions) > 0 {
+      compiled, err := CompileExpressions(e.sdkClient, facts, expressions...)
+      if err != nil {
+        return err
+      }
+      rules = compiled
+    }
+
+    e.rulesMutex.Lock()
+    defer e.rulesMutex.Unlock()
+    e.facts = facts
+    e.expressions = nil
+    e.rules = rules
+    return nil
+}
+
+// Records a warning event that a new configuration was rejected, the enforcer
+// keeps running with the configuration it already has
+func (e *Enforcer) RejectConfiguration(ctx context.Context, reason error) {
+    log.Error("Rejected new configuration, keeping the previous one", "error", reason)
+    err := events.WithContext(ctx, e.eventClient).CreateConfigRejectedEvent(e.eventApplication(), reason)
+    if err != nil {
+      log.Error("Error recording rejected configuration", "error", err)
+    }
+}
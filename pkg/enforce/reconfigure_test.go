@@ -0,0 +1,105 @@
+package enforce
+
+import (
+    "errors"
+    "testing"
+    "time"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/events"
+
+    license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
+    cron "github.com/robfig/cron/v3"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/mock"
+    "github.com/stretchr/testify/require"
+)
+
+func TestReplaceExpressions(t *testing.T) {
+    enforcer := NewEnforcer(entitlementClient(time.Now().Add(24*time.Hour)), events.NewMockEventClient(),
+        WithPolicy(NewPolicy(RequireTrue("is_enterprise"))),
+        WithExpressions(nil, "license.fields.max_nodes >= 3"))
+
+    _, err := enforcer.Check()
+    require.NoError(t, err)
+
+    require.NoError(t, enforcer.ReplaceExpressions(nil, "license.fields.feature_x_enabled"))
+    _, err = enforcer.Check()
+    var policyErr *PolicyError
+    require.ErrorAs(t, err, &policyErr)
+    require.Len(t, policyErr.Result.Results, 2)
+    assert.Equal(t, "is_enterprise is true", policyErr.Result.Results[0].Rule)
+    assert.Equal(t, "license.fields.feature_x_enabled", policyErr.Result.Failures()[0].Rule)
+
+    require.NoError(t, enforcer.ReplaceExpressions(nil))
+    _, err = enforcer.Check()
+    assert.NoError(t, err)
+}
+
+func TestReplaceExpressionsKeepsRulesWhenInvalid(t *testing.T) {
+    enforcer := NewEnforcer(entitlementClient(time.Now().Add(24*time.Hour)), events.NewMockEventClient(),
+        WithExpressions(nil, "license.fields.feature_x_enabled"))
+
+    err := enforcer.ReplaceExpressions(nil, "license.fields.tier > 3")
+    assert.ErrorIs(t, err, ErrInvalidExpression)
+
+    _, err = enforcer.Check()
+    assert.ErrorIs(t, err, ErrPolicyNotSatisfied)
+}
+
+func TestReplaceExpressionsCompilesWithoutBlockingChecks(t *testing.T) {
+    compiling := make(chan struct{})
+    release := make(chan struct{})
+    sdkClient := entitlementClient(time.Now().Add(24*time.Hour))
+    sdkClient.On("GetLicenseField", "seats").Run(func(mock.Arguments) {
+        close(compiling)
+        <-release
+    }).Return(&license.LicenseField{Name: "seats", Value: float64(10), ValueType: "Integer"}, nil)
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient(),
+        WithExpressions(nil, "license.fields.max_nodes >= 3"))
+    _, err := enforcer.Check()
+    require.NoError(t, err)
+
+    replaced := make(chan error)
+    go func() { replaced <- enforcer.ReplaceExpressions(nil, "license.fields.seats > 5") }()
+    <-compiling
+
+    // the rules in place are still usable while the new ones compile
+    policy := make(chan *Policy)
+    go func() { policy <- enforcer.currentPolicy() }()
+    select {
+    case current := <-policy:
+        assert.Equal(t, "license.fields.max_nodes >= 3", current.Rules()[0].Name())
+    case <-time.After(time.Second):
+        t.Fatal("reading the rules waited for the new ones to compile")
+    }
+
+    close(release)
+    require.NoError(t, <-replaced)
+    assert.Equal(t, "license.fields.seats > 5", enforcer.currentPolicy().Rules()[0].Name())
+}
+
+func TestReschedule(t *testing.T) {
+    enforcer := NewEnforcer(entitlementClient(time.Now().Add(24*time.Hour)), events.NewMockEventClient())
+
+    require.NoError(t, enforcer.Reschedule(time.Hour))
+    require.NoError(t, enforcer.Reschedule(15*time.Minute))
+    assert.Error(t, enforcer.Reschedule(0))
+
+    entries := enforcer.scheduler.Entries()
+    require.Len(t, entries, 1)
+    assert.Equal(t, cron.ConstantDelaySchedule{Delay: 15 * time.Minute}, entries[0].Schedule)
+}
+
+func TestRejectConfiguration(t *testing.T) {
+    eventClient := events.NewMockEventClient()
+    enforcer := NewEnforcer(entitlementClient(time.Now().Add(24*time.Hour)), eventClient)
+    _, err := enforcer.Check()
+    require.NoError(t, err)
+
+    enforcer.RejectConfiguration(t.Context(), errors.New("version: 2 is not supported, use 1"))
+
+    event, err := eventClient.FindLicenseEvent(events.ReasonConfigRejected, events.ApplicationLabels("slackernews-mackerel"))
+    require.NoError(t, err)
+    require.NotNil(t, event)
+    assert.Equal(t, "Warning", event.Type)
+}
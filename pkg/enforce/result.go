@@ -0,0 +1,154 @@
+package enforce
+
+import (
+    "fmt"
+    "math"
+    "time"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/client"
+
+    license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
+)
+
+// The outcome of a single license check, with field names that are stable
+// enough for scripts, CI, and support bundles to rely on
+type Result struct {
+    Application   string        `json:"application"`
+    AppSlug       string        `json:"appSlug"`
+    Expiration    *time.Time    `json:"expiration,omitempty"`
+    DaysRemaining *int          `json:"daysRemaining,omitempty"`
+    Perpetual     bool          `json:"perpetual,omitempty"`
+    FailedOpen    bool          `json:"failedOpen,omitempty"`
+    LastVerified  *time.Time    `json:"lastVerified,omitempty"`
+    State         LicenseState  `json:"state,omitempty"`
+    Valid         bool          `json:"valid"`
+    CheckedAt     time.Time     `json:"checkedAt"`
+    Fields        []FieldResult `json:"fields"`
+    Events        []EventResult `json:"events"`
+    ErrorClass    string        `json:"errorClass,omitempty"`
+    Permanent     bool          `json:"permanent,omitempty"`
+    Error         string        `json:"error,omitempty"`
+}
+
+// A license field the check read, and whether it could be verified
+type FieldResult struct {
+    Name     string `json:"name"`
+    Type     string `json:"type,omitempty"`
+    Value    any    `json:"value,omitempty"`
+    Verified bool   `json:"verified"`
+    Error    string `json:"error,omitempty"`
+}
+
+// An event the check recorded. Events that already exist are updated
+// rather than created again, so these may not all be new.
+type EventResult struct {
+    Reason string `json:"reason"`
+    Error  string `json:"error,omitempty"`
+}
+
+func newResult() *Result {
+    return &Result{CheckedAt: time.Now(), Fields: []FieldResult{}, Events: []EventResult{}}
+}
+
+// records the expiration date, and the `expires_at` field it came from
+func (r *Result) recordExpiration(expiration time.Time) {
+    value := ""
+    if !client.IsPerpetual(expiration) {
+        value = expiration.Format(time.RFC3339)
+    }
+    r.recordField("expires_at", &license.LicenseField{Name: "expires_at", Value: value, ValueType: "String"}, nil)
+    r.setExpiration(expiration)
+}
+
+func (r *Result) setExpiration(expiration time.Time) {
+    if client.IsPerpetual(expiration) {
+        r.Perpetual = true
+        return
+    }
+    r.Expiration = &expiration
+    days := int(math.Floor(expiration.Sub(r.CheckedAt).Hours() / 24))
+    r.DaysRemaining = &days
+}
+
+// records the outcome of reading a field, replacing an earlier read of the
+// same field since rules can read a field more than once
+func (r *Result) recordField(name string, field *license.LicenseField, err error) {
+    recorded := FieldResult{Name: name, Verified: err == nil && field != nil}
+    switch {
+    case err != nil:
+        recorded.Error = err.Error()
+    case field == nil:
+        recorded.Error = fieldNotFound(name).Error()
+    default:
+        recorded.Type = field.ValueType
+        recorded.Value = field.Value
+    }
+
+    for i := range r.Fields {
+        if r.Fields[i].Name == name {
+            r.Fields[i] = recorded
+            return
+        }
+    }
+    r.Fields = append(r.Fields, recorded)
+}
+
+func (r *Result) recordEvent(reason string, err error) {
+    recorded := EventResult{Reason: reason}
+    if err != nil {
+        recorded.Error = err.Error()
+    }
+    r.Events = append(r.Events, recorded)
+}
+
+func (r *Result) recordError(err error) {
+    r.Valid = false
+    r.Error = err.Error()
+    r.ErrorClass = ErrorClass(err)
+    r.Permanent = IsPermanent(err)
+}
+
+// stands the last known good license in for a check that couldn't reach the
+// Replicated SDK, keeping the error that says why and the fields that
+// couldn't be read
+func (r *Result) failOpen(snapshot *Snapshot, expiration time.Time, state LicenseState) {
+    r.Application = snapshot.Application
+    r.AppSlug = snapshot.AppSlug
+    r.State = state
+    r.Valid = true
+    r.FailedOpen = true
+    r.LastVerified = &snapshot.VerifiedAt
+    r.setExpiration(expiration)
+}
+
+// Summarizes the result in a sentence, for logs and plain text output
+func (r *Result) String() string {
+    name := r.Application
+    if name == "" {
+        name = r.AppSlug
+    }
+    switch {
+    case r.Valid && r.FailedOpen:
+        return fmt.Sprintf("License for %s was valid at %s, allowing it while the Replicated SDK is unavailable (%s)", name, r.LastVerified.Format(time.RFC3339), r.Error)
+    case r.Valid && r.Perpetual:
+        return fmt.Sprintf("License for %s is valid and does not expire", name)
+    case r.Valid && r.DaysRemaining != nil:
+        return fmt.Sprintf("License for %s is valid, %d days remaining", name, *r.DaysRemaining)
+    case r.Valid:
+        return fmt.Sprintf("License for %s is valid", name)
+    }
+    return fmt.Sprintf("License check failed (%s): %s", r.ErrorClass, r.Error)
+}
+
+// a client that records every license field read through it, so the result
+// can say which fields the check verified
+type fieldRecorder struct {
+    client.ReplicatedClient
+    result *Result
+}
+
+func (r *fieldRecorder) GetLicenseField(name string) (*license.LicenseField, error) {
+    field, err := r.ReplicatedClient.GetLicenseField(name)
+    r.result.recordField(name, field, err)
+    return field, err
+}
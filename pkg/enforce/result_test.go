@@ -0,0 +1,122 @@
+package enforce
+
+import (
+    "encoding/json"
+    "testing"
+    "time"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/client"
+    "github.com/crdant/replicated-license-enforcer/pkg/events"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func TestCheckResult(t *testing.T) {
+    future := time.Now().Add(10*24*time.Hour + time.Hour)
+    enforcer := NewEnforcer(entitlementClient(future), events.NewMockEventClient(),
+        WithPolicy(NewPolicy(RequireTrue("is_enterprise"))),
+        WithExpiryWarnings(30*24*time.Hour))
+
+    result, err := enforcer.Check()
+    require.NoError(t, err)
+
+    assert.True(t, result.Valid)
+    assert.Equal(t, "Slackernews", result.Application)
+    assert.Equal(t, "slackernews-mackerel", result.AppSlug)
+    assert.Equal(t, StateValid, result.State)
+    require.NotNil(t, result.Expiration)
+    assert.True(t, future.Equal(*result.Expiration))
+    require.NotNil(t, result.DaysRemaining)
+    assert.Equal(t, 10, *result.DaysRemaining)
+    assert.Empty(t, result.ErrorClass)
+
+    require.Len(t, result.Fields, 2)
+    assert.Equal(t, FieldResult{Name: "expires_at", Type: "String", Value: future.Format(time.RFC3339), Verified: true}, result.Fields[0])
+    assert.Equal(t, FieldResult{Name: "is_enterprise", Type: "Boolean", Value: true, Verified: true}, result.Fields[1])
+
+    assert.Equal(t, []EventResult{{Reason: events.ReasonValid}, {Reason: events.ReasonExpiringSoon}}, result.Events)
+}
+
+func TestCheckResultFailingPolicy(t *testing.T) {
+    sdkClient := entitlementClient(time.Now().Add(24 * time.Hour))
+    sdkClient.On("GetLicenseField", "seats").Return(nil, nil)
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient(),
+        WithPolicy(NewPolicy(RequireTrue("feature_x_enabled"), RequireAtLeast("seats", 5))))
+
+    result, err := enforcer.Check()
+    require.Error(t, err)
+
+    assert.False(t, result.Valid)
+    assert.Equal(t, ClassPolicyNotSatisfied, result.ErrorClass)
+    assert.Equal(t, err.Error(), result.Error)
+    require.Len(t, result.Fields, 3)
+    assert.True(t, result.Fields[1].Verified)
+    assert.Equal(t, "seats", result.Fields[2].Name)
+    assert.False(t, result.Fields[2].Verified)
+    assert.Equal(t, "license field seats not found", result.Fields[2].Error)
+}
+
+func TestCheckResultExpired(t *testing.T) {
+    past := time.Now().Add(-36 * time.Hour)
+    enforcer := NewEnforcer(client.NewMockAPIClient("Slackernews", "slackernews-mackerel", past), events.NewMockEventClient())
+
+    result, err := enforcer.Check()
+    require.Error(t, err)
+
+    assert.False(t, result.Valid)
+    assert.Equal(t, StateExpired, result.State)
+    assert.Equal(t, ClassExpired, result.ErrorClass)
+    assert.True(t, result.Permanent)
+    assert.Equal(t, -2, *result.DaysRemaining)
+    assert.Equal(t, []EventResult{{Reason: events.ReasonExpired}}, result.Events)
+}
+
+func TestCheckResultPerpetual(t *testing.T) {
+    enforcer := NewEnforcer(client.NewMockAPIClient("Slackernews", "slackernews-mackerel", time.Time{}), events.NewMockEventClient(),
+        WithExpiryWarnings(30 * 24 * time.Hour), WithExpirationCheck())
+
+    result, err := enforcer.Check()
+    require.NoError(t, err)
+
+    assert.True(t, result.Valid)
+    assert.True(t, result.Perpetual)
+    assert.Equal(t, StateValid, result.State)
+    assert.Nil(t, result.Expiration)
+    assert.Nil(t, result.DaysRemaining)
+    assert.Equal(t, []EventResult{{Reason: events.ReasonValid}}, result.Events)
+    assert.Equal(t, "License for Slackernews is valid and does not expire", result.String())
+    assert.True(t, enforcer.Status().Perpetual)
+    assert.Empty(t, enforcer.scheduler.Entries())
+}
+
+func TestResultJSON(t *testing.T) {
+    expiration := time.Date(2025, 6, 30, 4, 0, 0, 0, time.UTC)
+    days := 29
+    result := &Result{
+        Application:   "Slackernews",
+        AppSlug:       "slackernews-mackerel",
+        Expiration:    &expiration,
+        DaysRemaining: &days,
+        State:         StateValid,
+        Valid:         true,
+        CheckedAt:     time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+        Fields:        []FieldResult{{Name: "expires_at", Type: "String", Value: "2025-06-30T04:00:00Z", Verified: true}},
+        Events:        []EventResult{{Reason: "Valid"}},
+    }
+
+    document, err := json.Marshal(result)
+    require.NoError(t, err)
+    assert.JSONEq(t, `{
+        "application": "Slackernews",
+        "appSlug": "slackernews-mackerel",
+        "expiration": "2025-06-30T04:00:00Z",
+        "daysRemaining": 29,
+        "state": "Valid",
+        "valid": true,
+        "checkedAt": "2025-06-01T00:00:00Z",
+        "fields": [{"name": "expires_at", "type": "String", "value": "2025-06-30T04:00:00Z", "verified": true}],
+        "events": [{"reason": "Valid"}]
+    }`, string(document))
+    assert.Equal(t, "License for Slackernews is valid, 29 days remaining", result.String())
+}
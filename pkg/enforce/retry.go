@@ -0,0 +1,68 @@
+package enforce
+
+import (
+    "time"
+
+    backoff "github.com/cenkalti/backoff/v4"
+)
+
+// Waits exactly the backoff interval between retries, without jitter
+const NoJitter = -1
+
+// How `Validate` retries a license check that fails for a transient reason,
+// for example because the Replicated SDK isn't up yet. Retries back off
+// exponentially from the initial interval up to the maximum, with each wait
+// randomized by the jitter so a fleet of pods doesn't retry in lockstep.
+// They stop once the maximum elapsed time has passed or the check has been
+// tried the maximum number of attempts. Zero values use the defaults, and
+// zero attempts means there's no limit on the number of attempts.
+type RetryPolicy struct {
+    InitialInterval time.Duration
+    MaxInterval     time.Duration
+    MaxElapsedTime  time.Duration
+    Jitter          float64
+    MaxAttempts     int
+}
+
+// Returns the policy used when none is configured, which gives up after
+// fifteen minutes
+func DefaultRetryPolicy() RetryPolicy {
+    return RetryPolicy{
+        InitialInterval: backoff.DefaultInitialInterval,
+        MaxInterval:     backoff.DefaultMaxInterval,
+        MaxElapsedTime:  backoff.DefaultMaxElapsedTime,
+        Jitter:          backoff.DefaultRandomizationFactor,
+    }
+}
+
+// Retries failed checks according to the policy
+func WithRetryPolicy(policy RetryPolicy) Option {
+    return func(e *Enforcer) {
+        e.retry = policy
+    }
+}
+
+func (p RetryPolicy) backOff() backoff.BackOff {
+    b := backoff.NewExponentialBackOff()
+    if p.InitialInterval > 0 {
+        b.InitialInterval = p.InitialInterval
+    }
+    if p.MaxInterval > 0 {
+        b.MaxInterval = p.MaxInterval
+    }
+    if p.MaxElapsedTime > 0 {
+        b.MaxElapsedTime = p.MaxElapsedTime
+    }
+    if p.Jitter > 0 {
+        b.RandomizationFactor = p.Jitter
+    } else if p.Jitter < 0 {
+        b.RandomizationFactor = 0
+    }
+    b.Reset()
+
+    if p.MaxAttempts > 0 {
+        // the first attempt isn't a retry
+        return backoff.WithMaxRetries(b, uint64(p.MaxAttempts-1))
+    }
+    return b
+}
@@ -0,0 +1,95 @@
+package enforce
+
+import (
+    "errors"
+    "testing"
+    "time"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/client"
+    "github.com/crdant/replicated-license-enforcer/pkg/events"
+
+    backoff "github.com/cenkalti/backoff/v4"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestValidateGivesUpAfterMaxElapsedTime(t *testing.T) {
+    sdkClient := &client.MockAPIClient{}
+    sdkClient.On("GetExpirationDate").Return(time.Time{}, errors.New("connection refused"))
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient(), WithRetryPolicy(RetryPolicy{
+        InitialInterval: 10 * time.Millisecond,
+        MaxElapsedTime:  100 * time.Millisecond,
+    }))
+
+    started := time.Now()
+    _, err := enforcer.Validate()
+    assert.Error(t, err)
+    assert.Less(t, time.Since(started), time.Second)
+    assert.Greater(t, len(sdkClient.Calls), 1)
+}
+
+func TestDefaultRetryPolicy(t *testing.T) {
+    policy := DefaultRetryPolicy()
+    assert.Equal(t, 15*time.Minute, policy.MaxElapsedTime)
+
+    // an empty policy falls back to the defaults
+    empty := RetryPolicy{}.backOff().(*backoff.ExponentialBackOff)
+    assert.Equal(t, policy.InitialInterval, empty.InitialInterval)
+    assert.Equal(t, policy.MaxInterval, empty.MaxInterval)
+    assert.Equal(t, policy.MaxElapsedTime, empty.MaxElapsedTime)
+}
+
+func TestValidateStopsOnExpiredLicense(t *testing.T) {
+    sdkClient := client.NewMockAPIClient("Slackernews", "slackernews-mackerel", time.Now().Add(-24 * time.Hour))
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient(), WithRetryPolicy(RetryPolicy{
+        InitialInterval: 10 * time.Millisecond,
+        MaxElapsedTime:  time.Minute,
+    }))
+
+    result, err := enforcer.Validate()
+    assert.ErrorIs(t, err, ErrLicenseExpired)
+    assert.True(t, result.Permanent)
+    sdkClient.AssertNumberOfCalls(t, "GetExpirationDate", 1)
+}
+
+func TestValidateRetriesUnavailableSDK(t *testing.T) {
+    unavailable := &client.RequestError{URL: "http://replicated:3000/api/v1/license/info", Err: errors.New("connection refused")}
+    sdkClient := &client.MockAPIClient{}
+    sdkClient.On("GetExpirationDate").Return(time.Time{}, unavailable).Twice()
+    sdkClient.On("GetExpirationDate").Return(time.Now().Add(24 * time.Hour), nil)
+    sdkClient.On("GetAppName").Return("Slackernews", nil)
+    sdkClient.On("GetAppSlug").Return("slackernews-mackerel", nil)
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient(), WithRetryPolicy(RetryPolicy{
+        InitialInterval: time.Millisecond,
+        Jitter:          NoJitter,
+    }))
+
+    result, err := enforcer.Validate()
+    assert.NoError(t, err)
+    assert.True(t, result.Valid)
+    sdkClient.AssertNumberOfCalls(t, "GetExpirationDate", 3)
+}
+
+func TestValidateGivesUpAfterMaxAttempts(t *testing.T) {
+    sdkClient := &client.MockAPIClient{}
+    sdkClient.On("GetExpirationDate").Return(time.Time{}, errors.New("connection refused"))
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient(), WithRetryPolicy(RetryPolicy{
+        InitialInterval: time.Millisecond,
+        MaxAttempts:     3,
+    }))
+
+    result, err := enforcer.Validate()
+    assert.Error(t, err)
+    assert.False(t, result.Permanent)
+    sdkClient.AssertNumberOfCalls(t, "GetExpirationDate", 3)
+}
+
+func TestRetryPolicyJitter(t *testing.T) {
+    assert.Equal(t, backoff.DefaultRandomizationFactor, DefaultRetryPolicy().Jitter)
+
+    jittered := RetryPolicy{Jitter: 0.2}.backOff().(*backoff.ExponentialBackOff)
+    assert.Equal(t, 0.2, jittered.RandomizationFactor)
+
+    exact := RetryPolicy{InitialInterval: time.Second, Jitter: NoJitter}.backOff()
+    assert.Equal(t, time.Second, exact.NextBackOff())
+    assert.Equal(t, 1500 * time.Millisecond, exact.NextBackOff())
+}
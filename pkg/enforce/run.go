@@ -0,0 +1,66 @@
+package enforce
+
+import (
+    "context"
+    "time"
+
+    "github.com/charmbracelet/log"
+)
+
+// How long `Run` waits for a check that's already running when its context
+// is done, before abandoning the check
+const DefaultDrainTimeout = 10 * time.Second
+
+// Sets how long `Run` waits for a check that's already running to finish when
+// it's stopped. Keep it shorter than the pod's termination grace period.
+func WithDrainTimeout(timeout time.Duration) Option {
+    return func(e *Enforcer) {
+        e.drainTimeout = timeout
+    }
+}
+
+// Checks the license on its schedule, set with `Reschedule`,
+// `RescheduleCron`, or `RescheduleAdaptive`, until the context is done. A
+// check that's running when the context is done gets the drain timeout to
+// finish before it's abandoned. Returns the result of the last check that
+// decided whether the license is valid and its error, which is nil when the
+// license was valid, or a nil result if no check ever decided. Checks that
+// failed for a transient reason, like the Replicated SDK being unavailable or
+// the check being abandoned, don't change the outcome.
+func (e *Enforcer) Run(ctx context.Context) (*Result, error) {
+    // checks outlive the context so they can finish while draining
+    checks, abandon := context.WithCancel(context.WithoutCancel(ctx))
+    defer abandon()
+    e.mutex.Lock()
+    e.running = checks
+    e.mutex.Unlock()
+
+    e.scheduler.Start()
+    <-ctx.Done()
+
+    log.Info("Stopping license checks")
+    stopped := e.scheduler.Stop()
+    select {
+    case <-stopped.Done():
+    case <-time.After(e.drainTimeout):
+      log.Warn("Abandoning license check that didn't finish", "timeout", e.drainTimeout)
+      abandon()
+      <-stopped.Done()
+    }
+
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+    e.running = nil
+    return e.last, e.lastErr
+}
+
+// returns the context for scheduled checks, which is cancelled when `Run`
+// abandons them
+func (e *Enforcer) recheckContext() context.Context {
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+    if e.running != nil {
+      return e.running
+    }
+    return context.Background()
+}
@@ -0,0 +1,179 @@
+package enforce
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/client"
+    "github.com/crdant/replicated-license-enforcer/pkg/events"
+
+    license "github.com/replicatedhq/replicated-sdk/pkg/license/types"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+// A client that holds each request for the expiration date until it's
+// released or its context is done, so tests can stop the enforcer in the
+// middle of a check
+type blockingClient struct {
+    expiration time.Time
+    started    chan struct{}
+    release    chan struct{}
+}
+
+func newBlockingClient(expiration time.Time) *blockingClient {
+    return &blockingClient{expiration: expiration, started: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (c *blockingClient) GetAppName() (string, error) {
+    return "Slackernews", nil
+}
+
+func (c *blockingClient) GetAppSlug() (string, error) {
+    return "slackernews-mackerel", nil
+}
+
+func (c *blockingClient) GetExpirationDate() (time.Time, error) {
+    return c.GetExpirationDateContext(context.Background())
+}
+
+func (c *blockingClient) GetLicenseField(string) (*license.LicenseField, error) {
+    return nil, nil
+}
+
+func (c *blockingClient) GetAppNameContext(context.Context) (string, error) {
+    return c.GetAppName()
+}
+
+func (c *blockingClient) GetAppSlugContext(context.Context) (string, error) {
+    return c.GetAppSlug()
+}
+
+func (c *blockingClient) GetExpirationDateContext(ctx context.Context) (time.Time, error) {
+    c.started <- struct{}{}
+    select {
+    case <-c.release:
+        return c.expiration, nil
+    case <-ctx.Done():
+        return time.Time{}, ctx.Err()
+    }
+}
+
+func (c *blockingClient) GetLicenseFieldContext(context.Context, string) (*license.LicenseField, error) {
+    return nil, nil
+}
+
+// A schedule that runs as soon as the scheduler starts, then never again
+type immediateSchedule struct {
+    fired bool
+}
+
+func (s *immediateSchedule) Next(t time.Time) time.Time {
+    if s.fired {
+        return time.Time{}
+    }
+    s.fired = true
+    return t
+}
+
+func TestRunReturnsLastResult(t *testing.T) {
+    enforcer := NewEnforcer(entitlementClient(time.Now().Add(24*time.Hour)), events.NewMockEventClient())
+    _, err := enforcer.Check()
+    require.NoError(t, err)
+    require.NoError(t, enforcer.Reschedule(time.Hour))
+
+    ctx, cancel := context.WithCancel(t.Context())
+    cancel()
+    result, err := enforcer.Run(ctx)
+    require.NoError(t, err)
+    require.NotNil(t, result)
+    assert.True(t, result.Valid)
+}
+
+func TestRunWithoutChecks(t *testing.T) {
+    enforcer := NewEnforcer(entitlementClient(time.Now().Add(24*time.Hour)), events.NewMockEventClient())
+
+    ctx, cancel := context.WithCancel(t.Context())
+    cancel()
+    result, err := enforcer.Run(ctx)
+    assert.NoError(t, err)
+    assert.Nil(t, result)
+}
+
+func TestRunDrainsRunningCheck(t *testing.T) {
+    sdkClient := newBlockingClient(time.Now().Add(24 * time.Hour))
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient(), WithDrainTimeout(time.Hour))
+    require.NoError(t, enforcer.reschedule(&immediateSchedule{}))
+
+    ctx, cancel := context.WithCancel(t.Context())
+    type outcome struct {
+        result *Result
+        err    error
+    }
+    done := make(chan outcome)
+    go func() {
+        result, err := enforcer.Run(ctx)
+        done <- outcome{result, err}
+    }()
+
+    <-sdkClient.started
+    cancel()
+    select {
+    case <-done:
+        t.Fatal("Expected Run to wait for the running check")
+    case <-time.After(100 * time.Millisecond):
+    }
+
+    close(sdkClient.release)
+    stopped := <-done
+    require.NoError(t, stopped.err)
+    assert.True(t, stopped.result.Valid)
+    assert.Equal(t, StateValid, enforcer.Status().State)
+}
+
+func TestRunAbandonsCheckAfterDrainTimeout(t *testing.T) {
+    sdkClient := newBlockingClient(time.Now().Add(24 * time.Hour))
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient(),
+        WithDrainTimeout(time.Millisecond), WithRetryPolicy(RetryPolicy{MaxElapsedTime: time.Hour}))
+    require.NoError(t, enforcer.reschedule(&immediateSchedule{}))
+
+    ctx, cancel := context.WithCancel(t.Context())
+    done := make(chan error)
+    go func() {
+        _, err := enforcer.Run(ctx)
+        done <- err
+    }()
+
+    <-sdkClient.started
+    cancel()
+    // an abandoned check doesn't decide anything
+    assert.NoError(t, <-done)
+}
+
+func TestRunIgnoresTransientFailures(t *testing.T) {
+    sdkClient := client.NewMockAPIClient("Slackernews", "slackernews-mackerel", time.Now().Add(24*time.Hour))
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient())
+    _, err := enforcer.Check()
+    require.NoError(t, err)
+
+    enforcer.sdkClient = unavailableClient()
+    _, err = enforcer.Check()
+    require.ErrorIs(t, err, ErrSDKUnavailable)
+    require.NoError(t, enforcer.Reschedule(time.Hour))
+
+    ctx, cancel := context.WithCancel(t.Context())
+    cancel()
+    result, err := enforcer.Run(ctx)
+    require.NoError(t, err)
+    require.NotNil(t, result)
+    assert.True(t, result.Valid)
+
+    // a license that's found to be expired is the new outcome
+    enforcer.sdkClient = client.NewMockAPIClient("Slackernews", "slackernews-mackerel", time.Now().Add(-24*time.Hour))
+    _, err = enforcer.Check()
+    require.ErrorIs(t, err, ErrLicenseExpired)
+    result, err = enforcer.Run(ctx)
+    assert.ErrorIs(t, err, ErrLicenseExpired)
+    assert.False(t, result.Valid)
+}
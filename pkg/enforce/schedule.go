@@ -0,0 +1,233 @@
+package enforce
+
+import (
+    "fmt"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/client"
+
+    "github.com/charmbracelet/log"
+    cron "github.com/robfig/cron/v3"
+)
+
+// Bounds for adaptive rechecks that suit most licenses, checking at least
+// daily and at most every minute
+const (
+    DefaultAdaptiveMin = time.Minute
+    DefaultAdaptiveMax = 24 * time.Hour
+)
+
+// Interprets cron schedules in the timezone instead of the local time of the
+// enforcer, which is usually UTC in a container
+func WithTimezone(location *time.Location) Option {
+    return func(e *Enforcer) {
+        e.location = location
+    }
+}
+
+// Also checks the license at the moment it expires, and at the end of the
+// grace period if there is one, so the license becomes invalid right away
+// instead of at the next scheduled check
+func WithExpirationCheck() Option {
+    return func(e *Enforcer) {
+        e.checkAtExpiration = true
+    }
+}
+
+// Parses a standard five field cron schedule like `5 0 * * *`, or a
+// descriptor like `@daily`. Schedules are in local time unless they start
+// with `CRON_TZ=<timezone>`.
+func ParseSchedule(spec string) (cron.Schedule, error) {
+    schedule, err := cron.ParseStandard(spec)
+    if err != nil {
+        return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+    }
+    return schedule, nil
+}
+
+// Changes how often the license is rechecked, taking effect right away when
+// the enforcer is already monitoring the license
+func (e *Enforcer) Reschedule(interval time.Duration) error {
+    if interval <= 0 {
+      return fmt.Errorf("recheck interval must be positive, got %v", interval)
+    }
+    return e.reschedule(cron.Every(interval))
+}
+
+// Rechecks the license on a cron schedule like `5 0 * * *` instead of an
+// interval, taking effect right away when the enforcer is already monitoring
+// the license. The schedule is in the enforcer's timezone.
+func (e *Enforcer) RescheduleCron(spec string) error {
+    if !strings.HasPrefix(spec, "TZ=") && !strings.HasPrefix(spec, "CRON_TZ=") {
+      spec = fmt.Sprintf("CRON_TZ=%s %s", e.location, spec)
+    }
+    schedule, err := ParseSchedule(spec)
+    if err != nil {
+      return err
+    }
+    return e.reschedule(schedule)
+}
+
+// Rechecks the license more often as it gets closer to expiring, a tenth of
+// the time left but never more often than min or less often than max. Once
+// the license has expired it's rechecked every min so a renewal is noticed
+// quickly, and a new expiration date reschedules the next check right away.
+func (e *Enforcer) RescheduleAdaptive(min time.Duration, max time.Duration) error {
+    if min <= 0 || max < min {
+      return fmt.Errorf("adaptive rechecks need a positive minimum no greater than the maximum, got %v and %v", min, max)
+    }
+    e.mutex.Lock()
+    adaptive := &adaptiveSchedule{min: min, max: max, gracePeriod: e.gracePeriod, expiration: e.status.Expiration, checked: !e.status.CheckedAt.IsZero()}
+    e.mutex.Unlock()
+    return e.reschedule(adaptive)
+}
+
+func (e *Enforcer) reschedule(schedule cron.Schedule) error {
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+    e.adaptive, _ = schedule.(*adaptiveSchedule)
+    entry := e.scheduler.Schedule(schedule, cron.FuncJob(e.Recheck))
+    e.scheduler.Remove(e.entry)
+    e.entry = entry
+    return nil
+}
+
+// Checks the license on the cron schedule until the enforcer is stopped
+func (e *Enforcer) MonitorCron(spec string) error {
+    if err := e.RescheduleCron(spec); err != nil {
+      return err
+    }
+    e.scheduler.Start()
+    return nil
+}
+
+// Checks the license more often as it gets closer to expiring until the
+// enforcer is stopped, see `RescheduleAdaptive`
+func (e *Enforcer) MonitorAdaptive(min time.Duration, max time.Duration) error {
+    if err := e.RescheduleAdaptive(min, max); err != nil {
+      return err
+    }
+    e.scheduler.Start()
+    return nil
+}
+
+// returns when the license next changes state on its own, when it expires or
+// when its grace period ends, or the zero time if it won't
+func (e *Enforcer) nextExpiration(expiration time.Time) time.Time {
+    now := time.Now()
+    if expiration.After(now) {
+      return expiration
+    }
+    if graceEnds := expiration.Add(e.gracePeriod); e.gracePeriod > 0 && graceEnds.After(now) {
+      return graceEnds
+    }
+    return time.Time{}
+}
+
+// schedules a single check for when the license next changes state, moving
+// it if the expiration date has changed since the last check
+func (e *Enforcer) scheduleExpirationCheck(expiration time.Time) {
+    if !e.checkAtExpiration {
+      return
+    }
+
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+    at := e.nextExpiration(expiration)
+    if at.Equal(e.expirationCheck) {
+      return
+    }
+    e.scheduler.Remove(e.expirationEntry)
+    e.expirationEntry = 0
+    e.expirationCheck = at
+    if !at.IsZero() {
+      log.Debug("Scheduling license check at expiration", "at", at)
+      e.expirationEntry = e.scheduler.Schedule(onceSchedule{at: at}, cron.FuncJob(e.Recheck))
+    }
+}
+
+// reschedules adaptive checks when the license has a new expiration date,
+// for example after it's renewed, since the next check was planned for the
+// old date
+func (e *Enforcer) adaptSchedule(expiration time.Time) {
+    e.mutex.Lock()
+    adaptive := e.adaptive
+    e.mutex.Unlock()
+    if adaptive == nil || !adaptive.update(expiration) {
+      return
+    }
+    log.Info("License expiration changed, rescheduling checks", "expiration", expiration)
+    if err := e.reschedule(adaptive); err != nil {
+      log.Error("Could not reschedule license checks", "error", err)
+    }
+}
+
+// A schedule whose checks get closer together as the license gets closer to
+// expiring. It has its own lock since the scheduler asks for the next check
+// while the enforcer is holding its lock to reschedule.
+type adaptiveSchedule struct {
+    min         time.Duration
+    max         time.Duration
+    gracePeriod time.Duration
+    expiration  time.Time
+    checked     bool
+    mutex       sync.Mutex
+}
+
+// the fraction of the time left until the license changes state to wait
+// before checking again
+const adaptiveDivisor = 10
+
+// records the expiration date, returning true when it changed
+func (s *adaptiveSchedule) update(expiration time.Time) bool {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    if s.checked && s.expiration.Equal(expiration) {
+      return false
+    }
+    s.expiration, s.checked = expiration, true
+    return true
+}
+
+func (s *adaptiveSchedule) Next(t time.Time) time.Time {
+    s.mutex.Lock()
+    expiration, checked := s.expiration, s.checked
+    s.mutex.Unlock()
+    // check soon until the expiration is known, and rarely once it's known
+    // the license doesn't expire
+    if !checked {
+      return t.Add(s.min)
+    }
+    if client.IsPerpetual(expiration) {
+      return t.Add(s.max)
+    }
+
+    change := expiration
+    if !change.After(t) && s.gracePeriod > 0 {
+      change = expiration.Add(s.gracePeriod)
+    }
+    remaining := change.Sub(t)
+    if remaining <= 0 {
+      return t.Add(s.min)
+    }
+    interval := min(max(remaining/adaptiveDivisor, s.min), s.max)
+    // don't sleep through the license expiring
+    if remaining < interval {
+      interval = remaining
+    }
+    return t.Add(interval)
+}
+
+// A schedule that runs once at a moment in time, then never again
+type onceSchedule struct {
+    at time.Time
+}
+
+func (s onceSchedule) Next(t time.Time) time.Time {
+    if t.Before(s.at) {
+      return s.at
+    }
+    return time.Time{}
+}
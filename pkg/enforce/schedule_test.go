@@ -0,0 +1,156 @@
+package enforce
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/client"
+    "github.com/crdant/replicated-license-enforcer/pkg/events"
+
+    cron "github.com/robfig/cron/v3"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func TestRescheduleCron(t *testing.T) {
+    newYork, err := time.LoadLocation("America/New_York")
+    require.NoError(t, err)
+    enforcer := NewEnforcer(entitlementClient(time.Now().Add(24*time.Hour)), events.NewMockEventClient(), WithTimezone(newYork))
+
+    require.NoError(t, enforcer.RescheduleCron("5 0 * * *"))
+    entries := enforcer.scheduler.Entries()
+    require.Len(t, entries, 1)
+    schedule, ok := entries[0].Schedule.(*cron.SpecSchedule)
+    require.True(t, ok)
+    assert.Equal(t, newYork, schedule.Location)
+
+    next := schedule.Next(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC))
+    assert.Equal(t, time.Date(2025, 6, 2, 4, 5, 0, 0, time.UTC), next.UTC())
+
+    // a timezone in the schedule wins over the enforcer's
+    require.NoError(t, enforcer.RescheduleCron("CRON_TZ=UTC @daily"))
+    entries = enforcer.scheduler.Entries()
+    require.Len(t, entries, 1)
+    assert.Equal(t, time.UTC, entries[0].Schedule.(*cron.SpecSchedule).Location)
+
+    assert.Error(t, enforcer.RescheduleCron("5 0 * *"))
+    assert.Len(t, enforcer.scheduler.Entries(), 1)
+}
+
+func TestExpirationCheckScheduled(t *testing.T) {
+    expiration := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+    sdkClient := client.NewMockAPIClient("Slackernews", "slackernews-mackerel", expiration)
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient(), WithExpirationCheck(), WithGracePeriod(24*time.Hour))
+
+    _, err := enforcer.Check()
+    require.NoError(t, err)
+    _, err = enforcer.Check()
+    require.NoError(t, err)
+
+    entries := enforcer.scheduler.Entries()
+    require.Len(t, entries, 1)
+    assert.Equal(t, onceSchedule{at: expiration}, entries[0].Schedule)
+
+    // once expired, the next change is the end of the grace period
+    assert.Equal(t, expiration, enforcer.nextExpiration(expiration))
+    past := time.Now().Add(-time.Hour)
+    assert.Equal(t, past.Add(24*time.Hour), enforcer.nextExpiration(past))
+    assert.True(t, enforcer.nextExpiration(time.Now().Add(-48*time.Hour)).IsZero())
+}
+
+// An action that sends each transition to invalid on a channel, so tests can
+// wait for a scheduled check to find the license invalid
+type invalidatedAction chan Transition
+
+func (a invalidatedAction) Invalidated(ctx context.Context, transition Transition) error {
+    a <- transition
+    return nil
+}
+
+func (a invalidatedAction) Restored(ctx context.Context, transition Transition) error {
+    return nil
+}
+
+func TestExpirationCheckRuns(t *testing.T) {
+    expiration := time.Now().Add(time.Second)
+    sdkClient := client.NewMockAPIClient("Slackernews", "slackernews-mackerel", expiration)
+    invalidated := make(invalidatedAction, 1)
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient(), WithExpirationCheck(), WithActions(invalidated),
+        WithRetryPolicy(RetryPolicy{MaxElapsedTime: time.Second}))
+
+    require.NoError(t, enforcer.MonitorCron("@yearly"))
+    defer enforcer.Stop()
+    _, err := enforcer.Check()
+    require.NoError(t, err)
+
+    select {
+    case transition := <-invalidated:
+        assert.Equal(t, StateExpired, transition.State)
+        assert.Equal(t, StateExpired, enforcer.Status().State)
+    case <-time.After(time.Minute):
+        t.Fatal("Expected the license to be checked when it expired")
+    }
+}
+
+func TestOnceSchedule(t *testing.T) {
+    at := time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
+    schedule := onceSchedule{at: at}
+    assert.Equal(t, at, schedule.Next(at.Add(-time.Minute)))
+    assert.True(t, schedule.Next(at).IsZero())
+}
+
+func TestAdaptiveSchedule(t *testing.T) {
+    now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+    tests := []struct {
+        name       string
+        checked    bool
+        expiration time.Time
+        grace      time.Duration
+        expected   time.Duration
+    }{
+        {"unknown expiration", false, time.Time{}, 0, time.Minute},
+        {"perpetual", true, time.Time{}, 0, 24 * time.Hour},
+        {"far from expiring", true, now.Add(300 * 24 * time.Hour), 0, 24 * time.Hour},
+        {"expiring in days", true, now.Add(5 * 24 * time.Hour), 0, 12 * time.Hour},
+        {"expiring in minutes", true, now.Add(10 * time.Minute), 0, time.Minute},
+        {"expiring in seconds", true, now.Add(20 * time.Second), 0, 20 * time.Second},
+        {"expired", true, now.Add(-time.Hour), 0, time.Minute},
+        {"in grace", true, now.Add(-time.Hour), 101 * time.Hour, 10 * time.Hour},
+    }
+    for _, test := range tests {
+        schedule := &adaptiveSchedule{min: time.Minute, max: 24 * time.Hour, gracePeriod: test.grace, expiration: test.expiration, checked: test.checked}
+        assert.Equal(t, now.Add(test.expected), schedule.Next(now), test.name)
+    }
+}
+
+func TestAdaptiveScheduleFollowsRenewal(t *testing.T) {
+    expiration := time.Now().Add(10 * 24 * time.Hour)
+    enforcer := NewEnforcer(client.NewMockAPIClient("Slackernews", "slackernews-mackerel", expiration), events.NewMockEventClient())
+    _, err := enforcer.Check()
+    require.NoError(t, err)
+
+    assert.Error(t, enforcer.RescheduleAdaptive(time.Hour, time.Minute))
+    require.NoError(t, enforcer.RescheduleAdaptive(time.Minute, 24*time.Hour))
+    entries := enforcer.scheduler.Entries()
+    require.Len(t, entries, 1)
+    first := entries[0].ID
+    assert.WithinDuration(t, time.Now().Add(24*time.Hour), entries[0].Schedule.Next(time.Now()), time.Second)
+
+    // checking the same license again doesn't move the next check
+    _, err = enforcer.Check()
+    require.NoError(t, err)
+    assert.Equal(t, first, enforcer.scheduler.Entries()[0].ID)
+
+    enforcer.sdkClient = client.NewMockAPIClient("Slackernews", "slackernews-mackerel", time.Now().Add(time.Hour))
+    _, err = enforcer.Check()
+    require.NoError(t, err)
+    entries = enforcer.scheduler.Entries()
+    require.Len(t, entries, 1)
+    assert.NotEqual(t, first, entries[0].ID)
+    assert.WithinDuration(t, time.Now().Add(6*time.Minute), entries[0].Schedule.Next(time.Now()), time.Second)
+
+    // switching back to an interval stops adapting
+    require.NoError(t, enforcer.Reschedule(time.Hour))
+    assert.Nil(t, enforcer.adaptive)
+}
@@ -0,0 +1,36 @@
+package enforce
+
+import (
+    "time"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/metrics"
+)
+
+// The outcome of the most recent license check
+type Status struct {
+    Application string       `json:"application"`
+    Expiration  time.Time    `json:"expiration"`
+    Perpetual   bool         `json:"perpetual,omitempty"`
+    State       LicenseState `json:"state"`
+    Valid       bool         `json:"valid"`
+    FailedOpen  bool         `json:"failedOpen,omitempty"`
+    CheckedAt   time.Time    `json:"checkedAt"`
+    Error       string       `json:"error,omitempty"`
+}
+
+// Returns the outcome of the most recent license check. A check that fails
+// without reaching the license, for example because the Replicated SDK is
+// unavailable, records its error but keeps the previous validity.
+func (e *Enforcer) Status() Status {
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+    return e.status
+}
+
+func (e *Enforcer) recordError(err error) {
+    e.mutex.Lock()
+    defer e.mutex.Unlock()
+    e.status.CheckedAt = time.Now()
+    e.status.Error = err.Error()
+    metrics.RecordCheckError()
+}
@@ -0,0 +1,79 @@
+package enforce
+
+import (
+    "errors"
+    "time"
+    "testing"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/client"
+    "github.com/crdant/replicated-license-enforcer/pkg/events"
+    "github.com/crdant/replicated-license-enforcer/pkg/metrics"
+
+    "github.com/prometheus/client_golang/prometheus/testutil"
+    "github.com/stretchr/testify/assert"
+)
+
+func TestStatusAfterChecks(t *testing.T) {
+    past := time.Now().Add(-24 * time.Hour)
+    slug := "slackernews-mackerel"
+
+    sdkClient := client.NewMockAPIClient("Slackernews", slug, past)
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient())
+
+    status := enforcer.Status()
+    assert.False(t, status.Valid)
+    assert.True(t, status.CheckedAt.IsZero())
+
+    enforcer.Check()
+    status = enforcer.Status()
+    assert.False(t, status.Valid)
+    assert.Equal(t, StateExpired, status.State)
+    assert.Equal(t, slug, status.Application)
+    assert.Equal(t, past, status.Expiration)
+    assert.Equal(t, "License for Slackernews is expired", status.Error)
+    assert.False(t, status.CheckedAt.IsZero())
+}
+
+func TestStatusKeepsValidityOnError(t *testing.T) {
+    future := time.Now().Add(24 * time.Hour)
+    sdkClient := &client.MockAPIClient{}
+    sdkClient.On("GetAppName").Return("Slackernews", nil)
+    sdkClient.On("GetAppSlug").Return("slackernews-mackerel", nil)
+    sdkClient.On("GetExpirationDate").Return(future, nil).Once()
+    sdkClient.On("GetExpirationDate").Return(time.Time{}, errors.New("connection refused"))
+
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient())
+    _, err := enforcer.Check()
+    assert.NoError(t, err)
+    _, err = enforcer.Check()
+    assert.Error(t, err)
+
+    status := enforcer.Status()
+    assert.True(t, status.Valid)
+    assert.Equal(t, "connection refused", status.Error)
+}
+
+func TestCheckRecordsMetrics(t *testing.T) {
+    past := time.Now().Add(-24 * time.Hour)
+    slug := "metrics-expired"
+    expired := testutil.ToFloat64(metrics.LicenseChecks.WithLabelValues(metrics.ResultExpired))
+
+    sdkClient := client.NewMockAPIClient("Slackernews", slug, past)
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient())
+    enforcer.Check()
+
+    assert.Equal(t, expired+1, testutil.ToFloat64(metrics.LicenseChecks.WithLabelValues(metrics.ResultExpired)))
+    assert.Equal(t, float64(0), testutil.ToFloat64(metrics.LicenseValid.WithLabelValues(slug)))
+    assert.Equal(t, float64(past.Unix()), testutil.ToFloat64(metrics.LicenseExpiration.WithLabelValues(slug)))
+}
+
+func TestCheckRecordsErrorMetrics(t *testing.T) {
+    errored := testutil.ToFloat64(metrics.LicenseChecks.WithLabelValues(metrics.ResultError))
+
+    sdkClient := &client.MockAPIClient{}
+    sdkClient.On("GetExpirationDate").Return(time.Time{}, errors.New("connection refused"))
+    enforcer := NewEnforcer(sdkClient, events.NewMockEventClient())
+    enforcer.Check()
+
+    assert.Equal(t, errored+1, testutil.ToFloat64(metrics.LicenseChecks.WithLabelValues(metrics.ResultError)))
+}
@@ -0,0 +1,112 @@
+package events
+
+import (
+    "context"
+    "time"
+
+    v1 "k8s.io/api/core/v1"
+)
+
+// An event client that can abandon its requests when a context is done
+type ContextEventClient interface {
+    GetLicenseEventContext(ctx context.Context, application string, date time.Time) (*v1.Event, error)
+    FindLicenseEventContext(ctx context.Context, reason string, labels map[string]string) (*v1.Event, error)
+    CreateLicenseEventContext(ctx context.Context, application string, date time.Time) error
+    CreateGracePeriodEventContext(ctx context.Context, application string, date time.Time, graceEnds time.Time) error
+    CreateExpiringSoonEventContext(ctx context.Context, application string, date time.Time, threshold time.Duration) error
+    CreateConfigRejectedEventContext(ctx context.Context, application string, reason error) error
+    CreateFailedOpenEventContext(ctx context.Context, application string, verifiedAt time.Time, reason error) error
+    CreateFailedClosedEventContext(ctx context.Context, application string, reason error) error
+}
+
+// Returns an event client whose requests are abandoned when the context is
+// done. Clients that don't implement `ContextEventClient` are checked for
+// cancellation before each request instead.
+func WithContext(ctx context.Context, c EventClient) EventClient {
+    return &boundClient{ctx: ctx, client: c}
+}
+
+type boundClient struct {
+    ctx    context.Context
+    client EventClient
+}
+
+func (b *boundClient) GetLicenseEvent(application string, date time.Time) (*v1.Event, error) {
+    if c, ok := b.client.(ContextEventClient); ok {
+        return c.GetLicenseEventContext(b.ctx, application, date)
+    }
+    if err := b.ctx.Err(); err != nil {
+        return nil, err
+    }
+    return b.client.GetLicenseEvent(application, date)
+}
+
+func (b *boundClient) FindLicenseEvent(reason string, labels map[string]string) (*v1.Event, error) {
+    if c, ok := b.client.(ContextEventClient); ok {
+        return c.FindLicenseEventContext(b.ctx, reason, labels)
+    }
+    if err := b.ctx.Err(); err != nil {
+        return nil, err
+    }
+    return b.client.FindLicenseEvent(reason, labels)
+}
+
+func (b *boundClient) CreateLicenseEvent(application string, date time.Time) error {
+    if c, ok := b.client.(ContextEventClient); ok {
+        return c.CreateLicenseEventContext(b.ctx, application, date)
+    }
+    if err := b.ctx.Err(); err != nil {
+        return err
+    }
+    return b.client.CreateLicenseEvent(application, date)
+}
+
+func (b *boundClient) CreateGracePeriodEvent(application string, date time.Time, graceEnds time.Time) error {
+    if c, ok := b.client.(ContextEventClient); ok {
+        return c.CreateGracePeriodEventContext(b.ctx, application, date, graceEnds)
+    }
+    if err := b.ctx.Err(); err != nil {
+        return err
+    }
+    return b.client.CreateGracePeriodEvent(application, date, graceEnds)
+}
+
+func (b *boundClient) CreateExpiringSoonEvent(application string, date time.Time, threshold time.Duration) error {
+    if c, ok := b.client.(ContextEventClient); ok {
+        return c.CreateExpiringSoonEventContext(b.ctx, application, date, threshold)
+    }
+    if err := b.ctx.Err(); err != nil {
+        return err
+    }
+    return b.client.CreateExpiringSoonEvent(application, date, threshold)
+}
+
+func (b *boundClient) CreateConfigRejectedEvent(application string, reason error) error {
+    if c, ok := b.client.(ContextEventClient); ok {
+        return c.CreateConfigRejectedEventContext(b.ctx, application, reason)
+    }
+    if err := b.ctx.Err(); err != nil {
+        return err
+    }
+    return b.client.CreateConfigRejectedEvent(application, reason)
+}
+
+func (b *boundClient) CreateFailedOpenEvent(application string, verifiedAt time.Time, reason error) error {
+    if c, ok := b.client.(ContextEventClient); ok {
+        return c.CreateFailedOpenEventContext(b.ctx, application, verifiedAt, reason)
+    }
+    if err := b.ctx.Err(); err != nil {
+        return err
+    }
+    return b.client.CreateFailedOpenEvent(application, verifiedAt, reason)
+}
+
+func (b *boundClient) CreateFailedClosedEvent(application string, reason error) error {
+    if c, ok := b.client.(ContextEventClient); ok {
+        return c.CreateFailedClosedEventContext(b.ctx, application, reason)
+    }
+    if err := b.ctx.Err(); err != nil {
+        return err
+    }
+    return b.client.CreateFailedClosedEvent(application, reason)
+}
@@ -0,0 +1,26 @@
+package events
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/stretchr/testify/assert"
+)
+
+func TestWithContextCancelled(t *testing.T) {
+    ctx, cancel := context.WithCancel(t.Context())
+    client := NewMockEventClient()
+    bound := WithContext(ctx, client)
+    date := time.Now().Add(24 * time.Hour)
+
+    assert.NoError(t, bound.CreateLicenseEvent("slackernews", date))
+    event, err := bound.GetLicenseEvent("slackernews", date)
+    assert.NoError(t, err)
+    assert.NotNil(t, event)
+
+    cancel()
+    assert.ErrorIs(t, bound.CreateLicenseEvent("slackernews", date), context.Canceled)
+    _, err = bound.FindLicenseEvent(ReasonValid, LicenseLabels("slackernews", date))
+    assert.ErrorIs(t, err, context.Canceled)
+}
@@ -2,6 +2,8 @@ package events
 
 import (
     "fmt"
+    "math"
+    "sort"
     "strings"
     "os"
     "time"
@@ -16,9 +18,25 @@ import (
 
 )
 
+const (
+    ReasonValid = "Valid"
+    ReasonExpired = "Expired"
+    ReasonExpiredInGrace = "Expired-InGrace"
+    ReasonExpiringSoon = "ExpiringSoon"
+    ReasonConfigRejected = "ConfigRejected"
+    ReasonFailedOpen = "FailedOpen"
+    ReasonFailedClosed = "FailedClosed"
+)
+
 type EventClient interface {
     GetLicenseEvent(application string, date time.Time) (*v1.Event, error)
+    FindLicenseEvent(reason string, labels map[string]string) (*v1.Event, error)
     CreateLicenseEvent(application string, date time.Time) error
+    CreateGracePeriodEvent(application string, date time.Time, graceEnds time.Time) error
+    CreateExpiringSoonEvent(application string, date time.Time, threshold time.Duration) error
+    CreateConfigRejectedEvent(application string, reason error) error
+    CreateFailedOpenEvent(application string, verifiedAt time.Time, reason error) error
+    CreateFailedClosedEvent(application string, reason error) error
 }
 
 type KubernetesEventClient struct {
@@ -54,41 +72,113 @@ func NewKubernetesEventClient() (*KubernetesEventClient, error) {
 }
 
 
+// Returns the labels that identify the license events for an application
+// and expiration date, the zero date is a license that doesn't expire
+func LicenseLabels(application string, date time.Time) map[string]string {
+  expiresAt := "never"
+  if !date.IsZero() {
+    expiresAt = date.Format(time.DateOnly)
+  }
+  return map[string]string{
+    "replicated.com/application": application,
+    "replicated.com/expires-at": expiresAt,
+  }
+}
+
 func PrepareLicenseEvent(client EventClient, application string, date time.Time) (*v1.Event, error) {
+  if date.IsZero() {
+    message := fmt.Sprintf("%s license is valid and does not expire", application)
+    return prepareEvent(client, application, LicenseLabels(application, date), "Normal", ReasonValid, message, false)
+  }
   valid := date.After(time.Now())
-  event, err := client.GetLicenseEvent(application, date)
+  if valid {
+    message := fmt.Sprintf("%s license is valid, expires %v", application, date)
+    return prepareEvent(client, application, LicenseLabels(application, date), "Normal", ReasonValid, message, false)
+  }
+  message := fmt.Sprintf("%s license is not valid, expired %v", application, date)
+  return prepareEvent(client, application, LicenseLabels(application, date), "Warning", ReasonExpired, message, true)
+}
+
+// Prepares a warning that the license has expired but is still in its grace
+// period, repeated warnings update the remaining grace time in the message
+func PrepareGracePeriodEvent(client EventClient, application string, date time.Time, graceEnds time.Time) (*v1.Event, error) {
+  remaining := time.Until(graceEnds).Round(time.Minute)
+  message := fmt.Sprintf("%s license expired %v, grace period ends in %v at %v", application, date, remaining, graceEnds)
+  return prepareEvent(client, application, LicenseLabels(application, date), "Warning", ReasonExpiredInGrace, message, true)
+}
+
+// Returns the labels that identify the warning for a threshold before the
+// license expires, so each threshold is only warned about once
+func ExpiringSoonLabels(application string, date time.Time, threshold time.Duration) map[string]string {
+  labels := LicenseLabels(application, date)
+  labels["replicated.com/expiry-warning"] = formatThreshold(threshold)
+  return labels
+}
+
+// Prepares a warning that the license will expire within the threshold, the
+// warning is only created once for each threshold and expiration date
+func PrepareExpiringSoonEvent(client EventClient, application string, date time.Time, threshold time.Duration) (*v1.Event, error) {
+  days := int(math.Ceil(time.Until(date).Hours() / 24))
+  message := fmt.Sprintf("%s license expires in %d days, on %v", application, days, date)
+  labels := ExpiringSoonLabels(application, date, threshold)
+  return prepareEvent(client, application, labels, "Warning", ReasonExpiringSoon, message, false)
+}
+
+// Returns the labels that identify the events about an application that
+// aren't about a particular expiration date, like rejected configurations or
+// what the enforcer decided while the Replicated SDK was unavailable
+func ApplicationLabels(application string) map[string]string {
+  return map[string]string{
+    "replicated.com/application": application,
+  }
+}
+
+// Prepares a warning that a new configuration for the enforcer was rejected
+// and the previous one is still in use, repeated rejections update the
+// message with the latest reason
+func PrepareConfigRejectedEvent(client EventClient, application string, reason error) (*v1.Event, error) {
+  message := fmt.Sprintf("Rejected new license enforcer configuration, keeping the previous one: %v", reason)
+  return prepareEvent(client, application, ApplicationLabels(application), "Warning", ReasonConfigRejected, message, true)
+}
+
+// Prepares a warning that the enforcer is letting the application run on the
+// license it verified at `verifiedAt` because the current one couldn't be
+// checked, each time it fails open the count goes up
+func PrepareFailedOpenEvent(client EventClient, application string, verifiedAt time.Time, reason error) (*v1.Event, error) {
+  message := fmt.Sprintf("%s license could not be checked, allowing it since it was valid at %v: %v", application, verifiedAt, reason)
+  return prepareEvent(client, application, ApplicationLabels(application), "Warning", ReasonFailedOpen, message, true)
+}
+
+// Prepares a warning that the enforcer treated the license as invalid because
+// it couldn't be checked and there was no recently verified license to fall
+// back on, each time it fails closed the count goes up
+func PrepareFailedClosedEvent(client EventClient, application string, reason error) (*v1.Event, error) {
+  message := fmt.Sprintf("%s license could not be checked, not allowing it: %v", application, reason)
+  return prepareEvent(client, application, ApplicationLabels(application), "Warning", ReasonFailedClosed, message, true)
+}
+
+func prepareEvent(client EventClient, application string, labels map[string]string, eventType string, reason string, message string, repeat bool) (*v1.Event, error) {
+  event, err := client.FindLicenseEvent(reason, labels)
   if err != nil {
     log.Error("Error getting existing event", "error", err)
     return nil, err
   }
   if event != nil {
     log.Debug("Event already exists")
-    if !valid {
-      log.Debug("Expired event, incrementing count", "previous", event.Count)
+    if repeat {
+      log.Debug("Repeated event, incrementing count", "previous", event.Count)
       event.Count++
+      event.Message = message
     }
     return event, nil
   }
 
   podRef := GetObjectReference()
-  eventType := "Normal" 
-  reason := "Valid"
-  message := fmt.Sprintf("%s license is valid, expires %v", application, date)
-
-  if !valid {
-      eventType = "Warning"
-      reason = "Expired"
-      message = fmt.Sprintf("%s license is not valid, expired %v", application, date)
-  } 
-
   event = &v1.Event{
     ObjectMeta: metav1.ObjectMeta{
       GenerateName: fmt.Sprintf("%s.", strings.ToLower(application)),
       Namespace:   podRef.Namespace,
-      Labels: map[string]string{
-        "replicated.com/application": application,
-        "replicated.com/expires-at": date.Format(time.DateOnly),
-      },
+      Labels: labels,
     },
     Type:    eventType,
     Reason:  reason,
@@ -102,12 +192,27 @@ func PrepareLicenseEvent(client EventClient, application string, date time.Time)
 }
 
 func (c *KubernetesEventClient) GetLicenseEvent(application string, date time.Time) (*v1.Event, error) {
+    return c.GetLicenseEventContext(context.Background(), application, date)
+}
+
+func (c *KubernetesEventClient) GetLicenseEventContext(ctx context.Context, application string, date time.Time) (*v1.Event, error) {
+    return c.FindLicenseEventContext(ctx, licenseReason(date), LicenseLabels(application, date))
+}
+
+// Finds the most recent event for the pod with the provided reason and labels
+func (c *KubernetesEventClient) FindLicenseEvent(reason string, labels map[string]string) (*v1.Event, error) {
+    return c.FindLicenseEventContext(context.Background(), reason, labels)
+}
+
+// Finds the most recent event for the pod with the provided reason and
+// labels, abandoning the request when the context is done
+func (c *KubernetesEventClient) FindLicenseEventContext(ctx context.Context, reason string, labels map[string]string) (*v1.Event, error) {
     podRef := GetObjectReference()
     listOptions := metav1.ListOptions{
-        FieldSelector: getFieldSelector(date),
-        LabelSelector: getLabelSelector(application, date),
+        FieldSelector: getFieldSelector(reason),
+        LabelSelector: getLabelSelector(labels),
     }
-    events, err := c.Clientset.CoreV1().Events(podRef.Namespace).List(context.TODO(), listOptions)
+    events, err := c.Clientset.CoreV1().Events(podRef.Namespace).List(ctx, listOptions)
     if err != nil {
         log.Error("Error getting events from Kubernertes", "error", err)
         return nil, err
@@ -121,33 +226,126 @@ func (c *KubernetesEventClient) GetLicenseEvent(application string, date time.Ti
 
 
 func (c *KubernetesEventClient) CreateLicenseEvent(application string, date time.Time) error {
-    event, err := PrepareLicenseEvent(c, application, date)
+    return c.CreateLicenseEventContext(context.Background(), application, date)
+}
+
+func (c *KubernetesEventClient) CreateLicenseEventContext(ctx context.Context, application string, date time.Time) error {
+    event, err := PrepareLicenseEvent(WithContext(ctx, c), application, date)
     if err != nil {
       log.Error("Error preparing Kubernetes event", "error", err)
       return nil
     }
+    return c.saveEvent(ctx, event)
+}
+
+func (c *KubernetesEventClient) CreateGracePeriodEvent(application string, date time.Time, graceEnds time.Time) error {
+    return c.CreateGracePeriodEventContext(context.Background(), application, date, graceEnds)
+}
 
-    if event.Count > 1 {
-      log.Debug("Updating existing event", "count", event.Count)
-      _, err := c.Clientset.CoreV1().Events(event.ObjectMeta.Namespace).Update(context.TODO(), event, metav1.UpdateOptions{});
-      return err
+func (c *KubernetesEventClient) CreateGracePeriodEventContext(ctx context.Context, application string, date time.Time, graceEnds time.Time) error {
+    event, err := PrepareGracePeriodEvent(WithContext(ctx, c), application, date, graceEnds)
+    if err != nil {
+      log.Error("Error preparing Kubernetes event", "error", err)
+      return nil
     }
+    return c.saveEvent(ctx, event)
+}
 
-    _, err = c.Clientset.CoreV1().Events(event.ObjectMeta.Namespace).Create(context.TODO(), event, metav1.CreateOptions{});
+func (c *KubernetesEventClient) CreateExpiringSoonEvent(application string, date time.Time, threshold time.Duration) error {
+    return c.CreateExpiringSoonEventContext(context.Background(), application, date, threshold)
+}
+
+func (c *KubernetesEventClient) CreateExpiringSoonEventContext(ctx context.Context, application string, date time.Time, threshold time.Duration) error {
+    event, err := PrepareExpiringSoonEvent(WithContext(ctx, c), application, date, threshold)
+    if err != nil {
+      log.Error("Error preparing Kubernetes event", "error", err)
+      return nil
+    }
+    return c.saveEvent(ctx, event)
+}
+
+func (c *KubernetesEventClient) CreateConfigRejectedEvent(application string, reason error) error {
+    return c.CreateConfigRejectedEventContext(context.Background(), application, reason)
+}
+
+func (c *KubernetesEventClient) CreateConfigRejectedEventContext(ctx context.Context, application string, reason error) error {
+    event, err := PrepareConfigRejectedEvent(WithContext(ctx, c), application, reason)
+    if err != nil {
+      log.Error("Error preparing Kubernetes event", "error", err)
+      return nil
+    }
+    return c.saveEvent(ctx, event)
+}
+
+func (c *KubernetesEventClient) CreateFailedOpenEvent(application string, verifiedAt time.Time, reason error) error {
+    return c.CreateFailedOpenEventContext(context.Background(), application, verifiedAt, reason)
+}
+
+func (c *KubernetesEventClient) CreateFailedOpenEventContext(ctx context.Context, application string, verifiedAt time.Time, reason error) error {
+    event, err := PrepareFailedOpenEvent(WithContext(ctx, c), application, verifiedAt, reason)
+    if err != nil {
+      log.Error("Error preparing Kubernetes event", "error", err)
+      return nil
+    }
+    return c.saveEvent(ctx, event)
+}
+
+func (c *KubernetesEventClient) CreateFailedClosedEvent(application string, reason error) error {
+    return c.CreateFailedClosedEventContext(context.Background(), application, reason)
+}
+
+func (c *KubernetesEventClient) CreateFailedClosedEventContext(ctx context.Context, application string, reason error) error {
+    event, err := PrepareFailedClosedEvent(WithContext(ctx, c), application, reason)
+    if err != nil {
+      log.Error("Error preparing Kubernetes event", "error", err)
+      return nil
+    }
+    return c.saveEvent(ctx, event)
+}
+
+func (c *KubernetesEventClient) saveEvent(ctx context.Context, event *v1.Event) error {
+    if event.ObjectMeta.Name != "" {
+      // existing events only change when they're repeated
+      if event.Count > 1 {
+        log.Debug("Updating existing event", "count", event.Count)
+        _, err := c.Clientset.CoreV1().Events(event.ObjectMeta.Namespace).Update(ctx, event, metav1.UpdateOptions{});
+        return err
+      }
+      return nil
+    }
+
+    _, err := c.Clientset.CoreV1().Events(event.ObjectMeta.Namespace).Create(ctx, event, metav1.CreateOptions{});
     return err
 }
 
-func getFieldSelector(date time.Time) string {
-  valid := date.After(time.Now())
-  reason := "Valid"
+func licenseReason(date time.Time) string {
+  valid := date.IsZero() || date.After(time.Now())
   if !valid {
-      reason = "Expired"
+      return ReasonExpired
+  }
+  return ReasonValid
+}
+
+func formatThreshold(threshold time.Duration) string {
+  day := 24 * time.Hour
+  if threshold % day == 0 {
+    return fmt.Sprintf("%dd", threshold / day)
   }
+  return threshold.String()
+}
+
+func getFieldSelector(reason string) string {
   log.Debug("Creating field selector", "involvedObject.name", os.Getenv("POD_NAME"), "involvedObject.namespace", os.Getenv("POD_NAMESPACE"), "reason", reason)
   return fmt.Sprintf("involvedObject.name=%s,involvedObject.namespace=%s,reason=%s", os.Getenv("POD_NAME"), os.Getenv("POD_NAMESPACE"), reason)
 }
 
-func getLabelSelector(application string, date time.Time) string {
-  log.Debug("Creating label selector", "replicated.com/application", application, "replicated.com/expires-at", date)
-  return fmt.Sprintf("replicated.com/application=%s,replicated.com/expires-at=%s", application, date.Format(time.DateOnly))
+func getLabelSelector(labels map[string]string) string {
+  log.Debug("Creating label selector", "labels", labels)
+  selectors := []string{}
+  for key, value := range labels {
+    selectors = append(selectors, fmt.Sprintf("%s=%s", key, value))
+  }
+  // sorted so the same labels always produce the same selector
+  sort.Strings(selectors)
+  return strings.Join(selectors, ",")
 }
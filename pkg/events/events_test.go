@@ -1,6 +1,7 @@
 package events
 
 import (
+    "errors"
     "fmt"
     "strings"
     "time"
@@ -71,6 +72,20 @@ func TestValidEvent(t *testing.T) {
     assert.Equal(t, "Valid", event.Reason)
 }
 
+func TestPerpetualLicenseEvent(t *testing.T) {
+    client := NewMockEventClient()
+    application := "slackernews-mackerel"
+
+    err := client.CreateLicenseEvent(application, time.Time{})
+    assert.NoError(t, err)
+
+    event, err := client.GetLicenseEvent(application, time.Time{})
+    assert.NoError(t, err)
+    assert.Equal(t, "Valid", event.Reason)
+    assert.Equal(t, "never", event.Labels["replicated.com/expires-at"])
+    assert.Equal(t, "slackernews-mackerel license is valid and does not expire", event.Message)
+}
+
 func TestSecondValidEvent(t *testing.T) {
     client := NewMockEventClient() 
     application := "slackernews-mackerel"
@@ -103,3 +118,122 @@ func TestValidNewExpiration(t *testing.T) {
     assert.NoError(t, err)
     assert.Len(t, client.Events, 2)
 }
+
+func TestGracePeriodEvent(t *testing.T) {
+    client := NewMockEventClient()
+    application := "slackernews-mackerel"
+    past := time.Now().Add(-24 * time.Hour)
+    graceEnds := past.Add(72 * time.Hour)
+
+    err := client.CreateGracePeriodEvent(application, past, graceEnds)
+    assert.NoError(t, err)
+    assert.Len(t, client.Events, 1)
+
+    event, err := client.FindLicenseEvent(ReasonExpiredInGrace, LicenseLabels(application, past))
+    assert.NoError(t, err)
+    assert.Equal(t, "Warning", event.Type)
+    assert.Equal(t, "Expired-InGrace", event.Reason)
+    assert.Equal(t, fmt.Sprintf("%s license expired %v, grace period ends in 48h0m0s at %v", application, past, graceEnds), event.Message)
+
+    // the grace period event doesn't stand in for the expired event
+    expired, err := client.GetLicenseEvent(application, past)
+    assert.NoError(t, err)
+    assert.Nil(t, expired)
+}
+
+func TestSecondGracePeriodEvent(t *testing.T) {
+    client := NewMockEventClient()
+    application := "slackernews-mackerel"
+    past := time.Now().Add(-24 * time.Hour)
+
+    err := client.CreateGracePeriodEvent(application, past, past.Add(72 * time.Hour))
+    assert.NoError(t, err)
+    err = client.CreateGracePeriodEvent(application, past, past.Add(72 * time.Hour))
+    assert.NoError(t, err)
+    assert.Len(t, client.Events, 1)
+
+    event, err := client.FindLicenseEvent(ReasonExpiredInGrace, LicenseLabels(application, past))
+    assert.NoError(t, err)
+    assert.Equal(t, int32(2), event.Count)
+}
+
+func TestExpiringSoonEvent(t *testing.T) {
+    client := NewMockEventClient()
+    application := "slackernews-mackerel"
+    future := time.Now().Add(10 * 24 * time.Hour)
+    threshold := 14 * 24 * time.Hour
+
+    err := client.CreateExpiringSoonEvent(application, future, threshold)
+    assert.NoError(t, err)
+    assert.Len(t, client.Events, 1)
+
+    event, err := client.FindLicenseEvent(ReasonExpiringSoon, ExpiringSoonLabels(application, future, threshold))
+    assert.NoError(t, err)
+    assert.Equal(t, "Warning", event.Type)
+    assert.Equal(t, "ExpiringSoon", event.Reason)
+    assert.Equal(t, "14d", event.ObjectMeta.Labels["replicated.com/expiry-warning"])
+    assert.Equal(t, fmt.Sprintf("%s license expires in 10 days, on %v", application, future), event.Message)
+}
+
+func TestExpiringSoonEventOncePerThreshold(t *testing.T) {
+    client := NewMockEventClient()
+    application := "slackernews-mackerel"
+    future := time.Now().Add(5 * 24 * time.Hour)
+
+    err := client.CreateExpiringSoonEvent(application, future, 7 * 24 * time.Hour)
+    assert.NoError(t, err)
+    err = client.CreateExpiringSoonEvent(application, future, 7 * 24 * time.Hour)
+    assert.NoError(t, err)
+    assert.Len(t, client.Events, 1)
+
+    event, err := client.FindLicenseEvent(ReasonExpiringSoon, ExpiringSoonLabels(application, future, 7 * 24 * time.Hour))
+    assert.NoError(t, err)
+    assert.Equal(t, int32(1), event.Count)
+
+    err = client.CreateExpiringSoonEvent(application, future, 12 * time.Hour)
+    assert.NoError(t, err)
+    assert.Len(t, client.Events, 2)
+
+    event, err = client.FindLicenseEvent(ReasonExpiringSoon, ExpiringSoonLabels(application, future, 12 * time.Hour))
+    assert.NoError(t, err)
+    assert.Equal(t, "12h0m0s", event.ObjectMeta.Labels["replicated.com/expiry-warning"])
+}
+
+func TestConfigRejectedEvent(t *testing.T) {
+    client := NewMockEventClient()
+    application := "slackernews-mackerel"
+
+    err := client.CreateConfigRejectedEvent(application, errors.New("version: 2 is not supported, use 1"))
+    assert.NoError(t, err)
+    err = client.CreateConfigRejectedEvent(application, errors.New("rules[0]: undeclared reference to 'licence'"))
+    assert.NoError(t, err)
+    assert.Len(t, client.Events, 1)
+
+    event, err := client.FindLicenseEvent(ReasonConfigRejected, ApplicationLabels(application))
+    assert.NoError(t, err)
+    assert.Equal(t, "Warning", event.Type)
+    assert.Equal(t, int32(2), event.Count)
+    assert.Equal(t, "Rejected new license enforcer configuration, keeping the previous one: rules[0]: undeclared reference to 'licence'", event.Message)
+}
+
+func TestOutageEvents(t *testing.T) {
+    client := NewMockEventClient()
+    application := "slackernews-mackerel"
+    verifiedAt := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+    unavailable := errors.New("Replicated SDK is unavailable")
+
+    assert.NoError(t, client.CreateFailedOpenEvent(application, verifiedAt, unavailable))
+    assert.NoError(t, client.CreateFailedOpenEvent(application, verifiedAt, unavailable))
+    assert.NoError(t, client.CreateFailedClosedEvent(application, unavailable))
+    assert.Len(t, client.Events, 2)
+
+    event, err := client.FindLicenseEvent(ReasonFailedOpen, ApplicationLabels(application))
+    assert.NoError(t, err)
+    assert.Equal(t, "Warning", event.Type)
+    assert.Equal(t, int32(2), event.Count)
+    assert.Equal(t, "slackernews-mackerel license could not be checked, allowing it since it was valid at 2025-06-01 00:00:00 +0000 UTC: Replicated SDK is unavailable", event.Message)
+
+    event, err = client.FindLicenseEvent(ReasonFailedClosed, ApplicationLabels(application))
+    assert.NoError(t, err)
+    assert.Equal(t, int32(1), event.Count)
+}
@@ -20,9 +20,9 @@ func setupMockEnvironment() {
     os.Setenv("POD_UID", "0e8d56c7-6277-4a79-9847-bdcb3b4e3184")
 }
 
-func generateEventKey(application string, date time.Time) string {
-    fieldSelector := getFieldSelector(date)
-    labelSelector := getLabelSelector(application, date)
+func generateEventKey(reason string, labels map[string]string) string {
+    fieldSelector := getFieldSelector(reason)
+    labelSelector := getLabelSelector(labels)
     log.Debug("Generated event key", "key", fmt.Sprintf("%s,%s", fieldSelector, labelSelector))
     return fmt.Sprintf("%s,%s", fieldSelector, labelSelector)
 }
@@ -40,7 +40,11 @@ func NewMockEventClient() *MockEventClient {
 }
 
 func (c *MockEventClient) GetLicenseEvent(application string, date time.Time) (*v1.Event, error) {
-    key := generateEventKey(application, date)
+    return c.FindLicenseEvent(licenseReason(date), LicenseLabels(application, date))
+}
+
+func (c *MockEventClient) FindLicenseEvent(reason string, labels map[string]string) (*v1.Event, error) {
+    key := generateEventKey(reason, labels)
     event, ok := c.Events[key]
     if !ok { 
       log.Debug("Event not found", "key", key)
@@ -57,8 +61,62 @@ func (c *MockEventClient) CreateLicenseEvent(application string, date time.Time)
       log.Error("Error preparing event", "error", err)
       return err
     }
-    key := generateEventKey(application, date)
+    c.saveEvent(event)
+    return nil
+}
+
+func (c *MockEventClient) CreateGracePeriodEvent(application string, date time.Time, graceEnds time.Time) error {
+    event, err := PrepareGracePeriodEvent(c, application, date, graceEnds)
+    if err != nil {
+      log.Error("Error preparing event", "error", err)
+      return err
+    }
+    c.saveEvent(event)
+    return nil
+}
+
+func (c *MockEventClient) CreateExpiringSoonEvent(application string, date time.Time, threshold time.Duration) error {
+    event, err := PrepareExpiringSoonEvent(c, application, date, threshold)
+    if err != nil {
+      log.Error("Error preparing event", "error", err)
+      return err
+    }
+    c.saveEvent(event)
+    return nil
+}
+
+func (c *MockEventClient) CreateConfigRejectedEvent(application string, reason error) error {
+    event, err := PrepareConfigRejectedEvent(c, application, reason)
+    if err != nil {
+      log.Error("Error preparing event", "error", err)
+      return err
+    }
+    c.saveEvent(event)
+    return nil
+}
+
+func (c *MockEventClient) CreateFailedOpenEvent(application string, verifiedAt time.Time, reason error) error {
+    event, err := PrepareFailedOpenEvent(c, application, verifiedAt, reason)
+    if err != nil {
+      log.Error("Error preparing event", "error", err)
+      return err
+    }
+    c.saveEvent(event)
+    return nil
+}
+
+func (c *MockEventClient) CreateFailedClosedEvent(application string, reason error) error {
+    event, err := PrepareFailedClosedEvent(c, application, reason)
+    if err != nil {
+      log.Error("Error preparing event", "error", err)
+      return err
+    }
+    c.saveEvent(event)
+    return nil
+}
+
+func (c *MockEventClient) saveEvent(event *v1.Event) {
+    key := generateEventKey(event.Reason, event.ObjectMeta.Labels)
     log.Debug("adding event to store", "key", key, "event", event)
     c.Events[key] = event
-    return nil
 }
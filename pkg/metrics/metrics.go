@@ -0,0 +1,107 @@
+package metrics
+
+import (
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/prometheus/client_golang/prometheus"
+    "github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// The registry for the enforcer's metrics, kept separate from the default
+// registry so embedding applications decide whether to expose them
+var Registry = prometheus.NewRegistry()
+
+var (
+    // When the license expires, as a Unix timestamp
+    LicenseExpiration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+        Name: "replicated_license_expiration_timestamp_seconds",
+        Help: "Expiration date of the license as a Unix timestamp",
+    }, []string{"app"})
+
+    // Whether the license was valid as of the most recent check
+    LicenseValid = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+        Name: "replicated_license_valid",
+        Help: "Whether the license was valid (1) or not (0) as of the most recent check",
+    }, []string{"app"})
+
+    // License checks broken down by their result
+    LicenseChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+        Name: "replicated_license_check_total",
+        Help: "Number of license checks by result",
+    }, []string{"result"})
+
+    // How long requests to the Replicated SDK take
+    SDKRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+        Name:    "replicated_sdk_request_duration_seconds",
+        Help:    "Duration of requests to the Replicated SDK by endpoint",
+        Buckets: prometheus.DefBuckets,
+    }, []string{"endpoint", "method", "code"})
+
+    // How many times validation retried a failed license check
+    ValidateRetries = prometheus.NewCounter(prometheus.CounterOpts{
+        Name: "replicated_license_validate_retries_total",
+        Help: "Number of times a failed license check was retried while validating the license",
+    })
+)
+
+// The results recorded for license checks
+const (
+    ResultValid = "valid"
+    ResultInGrace = "in_grace"
+    ResultExpired = "expired"
+    ResultPolicyFailed = "policy_failed"
+    ResultError = "error"
+)
+
+func init() {
+    Registry.MustRegister(
+        LicenseExpiration,
+        LicenseValid,
+        LicenseChecks,
+        SDKRequestDuration,
+        ValidateRetries,
+    )
+}
+
+// Returns a handler that serves the enforcer's metrics
+func Handler() http.Handler {
+    return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Records the state of the license after a check that reached a verdict, a
+// license that doesn't expire has the zero time and no expiration metric
+func RecordLicense(app string, expiration time.Time, valid bool, result string) {
+    if expiration.IsZero() {
+        LicenseExpiration.DeleteLabelValues(app)
+    } else {
+        LicenseExpiration.WithLabelValues(app).Set(float64(expiration.Unix()))
+    }
+    if valid {
+        LicenseValid.WithLabelValues(app).Set(1)
+    } else {
+        LicenseValid.WithLabelValues(app).Set(0)
+    }
+    LicenseChecks.WithLabelValues(result).Inc()
+}
+
+// Records a check that failed before reaching a verdict on the license
+func RecordCheckError() {
+    LicenseChecks.WithLabelValues(ResultError).Inc()
+}
+
+// Records how long a request to the Replicated SDK took, the code is the HTTP
+// status code or `error` when the request failed
+func RecordSDKRequest(method string, path string, code string, duration time.Duration) {
+    SDKRequestDuration.WithLabelValues(Endpoint(path), method, code).Observe(duration.Seconds())
+}
+
+// Returns the endpoint a request path belongs to, collapsing the field name
+// in license field requests so each field doesn't become its own series
+func Endpoint(path string) string {
+    if strings.HasPrefix(path, "/api/v1/license/fields/") {
+        return "/api/v1/license/fields/{field}"
+    }
+    return path
+}
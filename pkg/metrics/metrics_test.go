@@ -0,0 +1,52 @@
+package metrics
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "io"
+    "time"
+    "testing"
+
+    "github.com/prometheus/client_golang/prometheus/testutil"
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func TestRecordLicense(t *testing.T) {
+    expiration := time.Date(2025, 6, 30, 4, 0, 0, 0, time.UTC)
+    before := testutil.ToFloat64(LicenseChecks.WithLabelValues(ResultValid))
+
+    RecordLicense("slackernews-mackerel", expiration, true, ResultValid)
+    assert.Equal(t, float64(expiration.Unix()), testutil.ToFloat64(LicenseExpiration.WithLabelValues("slackernews-mackerel")))
+    assert.Equal(t, float64(1), testutil.ToFloat64(LicenseValid.WithLabelValues("slackernews-mackerel")))
+    assert.Equal(t, before+1, testutil.ToFloat64(LicenseChecks.WithLabelValues(ResultValid)))
+
+    RecordLicense("slackernews-mackerel", expiration, false, ResultExpired)
+    assert.Equal(t, float64(0), testutil.ToFloat64(LicenseValid.WithLabelValues("slackernews-mackerel")))
+
+    // a license that doesn't expire has no expiration to report
+    RecordLicense("slackernews-mackerel", time.Time{}, true, ResultValid)
+    assert.Equal(t, 0, testutil.CollectAndCount(LicenseExpiration))
+}
+
+func TestRecordCheckError(t *testing.T) {
+    before := testutil.ToFloat64(LicenseChecks.WithLabelValues(ResultError))
+    RecordCheckError()
+    assert.Equal(t, before+1, testutil.ToFloat64(LicenseChecks.WithLabelValues(ResultError)))
+}
+
+func TestEndpoint(t *testing.T) {
+    assert.Equal(t, "/api/v1/license/fields/{field}", Endpoint("/api/v1/license/fields/expires_at"))
+    assert.Equal(t, "/api/v1/app/info", Endpoint("/api/v1/app/info"))
+}
+
+func TestHandler(t *testing.T) {
+    RecordSDKRequest("GET", "/api/v1/app/info", "200", 10*time.Millisecond)
+
+    recorder := httptest.NewRecorder()
+    Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+    require.Equal(t, http.StatusOK, recorder.Code)
+
+    body, _ := io.ReadAll(recorder.Body)
+    assert.Contains(t, string(body), `replicated_sdk_request_duration_seconds_count{code="200",endpoint="/api/v1/app/info",method="GET"}`)
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+    "encoding/json"
+    "net/http"
+    "time"
+
+    "github.com/charmbracelet/log"
+    "github.com/crdant/replicated-license-enforcer/pkg/enforce"
+    "github.com/crdant/replicated-license-enforcer/pkg/metrics"
+)
+
+// Reports the outcome of the most recent license check, implemented by
+// `enforce.Enforcer`
+type StatusReporter interface {
+    Status() enforce.Status
+}
+
+// Returns a handler that serves the health and license state of the enforcer:
+// `/healthz` succeeds as long as the process is serving, `/readyz` fails when
+// the most recent check found the license invalid, `/license` returns the
+// most recent status as JSON, and `/metrics` serves Prometheus metrics
+func Handler(reporter StatusReporter) http.Handler {
+    mux := http.NewServeMux()
+    mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusOK)
+        w.Write([]byte("ok\n"))
+    })
+    mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+        status := reporter.Status()
+        if !status.Valid {
+            w.WriteHeader(http.StatusServiceUnavailable)
+            w.Write([]byte("license is not valid\n"))
+            return
+        }
+        w.WriteHeader(http.StatusOK)
+        w.Write([]byte("ok\n"))
+    })
+    mux.HandleFunc("GET /license", func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        if err := json.NewEncoder(w).Encode(reporter.Status()); err != nil {
+            log.Error("Error encoding license status", "error", err)
+        }
+    })
+    mux.Handle("GET /metrics", metrics.Handler())
+    return mux
+}
+
+// Returns a server for the enforcer's endpoints listening on the provided
+// address
+func NewServer(address string, reporter StatusReporter) *http.Server {
+    return &http.Server{
+        Addr:              address,
+        Handler:           Handler(reporter),
+        ReadHeaderTimeout: 10 * time.Second,
+    }
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "time"
+    "testing"
+
+    "github.com/crdant/replicated-license-enforcer/pkg/enforce"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+type staticReporter struct {
+    status enforce.Status
+}
+
+func (r *staticReporter) Status() enforce.Status {
+    return r.status
+}
+
+func get(t *testing.T, handler http.Handler, path string) *httptest.ResponseRecorder {
+    request := httptest.NewRequest(http.MethodGet, path, nil)
+    recorder := httptest.NewRecorder()
+    handler.ServeHTTP(recorder, request)
+    return recorder
+}
+
+func TestHealthz(t *testing.T) {
+    handler := Handler(&staticReporter{})
+    response := get(t, handler, "/healthz")
+    assert.Equal(t, http.StatusOK, response.Code)
+}
+
+func TestReadyzValid(t *testing.T) {
+    handler := Handler(&staticReporter{status: enforce.Status{Valid: true, State: enforce.StateValid}})
+    response := get(t, handler, "/readyz")
+    assert.Equal(t, http.StatusOK, response.Code)
+}
+
+func TestReadyzInvalid(t *testing.T) {
+    handler := Handler(&staticReporter{status: enforce.Status{Valid: false, State: enforce.StateExpired}})
+    response := get(t, handler, "/readyz")
+    assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+}
+
+func TestReadyzBeforeFirstCheck(t *testing.T) {
+    handler := Handler(&staticReporter{})
+    response := get(t, handler, "/readyz")
+    assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+}
+
+func TestLicense(t *testing.T) {
+    expiration := time.Date(2025, 6, 30, 4, 0, 0, 0, time.UTC)
+    checkedAt := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+    handler := Handler(&staticReporter{status: enforce.Status{
+        Application: "slackernews-mackerel",
+        Expiration:  expiration,
+        State:       enforce.StateValid,
+        Valid:       true,
+        CheckedAt:   checkedAt,
+        Error:       "connection refused",
+    }})
+
+    response := get(t, handler, "/license")
+    assert.Equal(t, http.StatusOK, response.Code)
+    assert.Equal(t, "application/json", response.Header().Get("Content-Type"))
+
+    var body map[string]any
+    require.NoError(t, json.NewDecoder(response.Body).Decode(&body))
+    assert.Equal(t, "slackernews-mackerel", body["application"])
+    assert.Equal(t, "2025-06-30T04:00:00Z", body["expiration"])
+    assert.Equal(t, "2025-06-01T12:00:00Z", body["checkedAt"])
+    assert.Equal(t, "Valid", body["state"])
+    assert.Equal(t, true, body["valid"])
+    assert.Equal(t, "connection refused", body["error"])
+}
+
+func TestLicenseOnlyAllowsGet(t *testing.T) {
+    handler := Handler(&staticReporter{})
+    request := httptest.NewRequest(http.MethodPost, "/license", nil)
+    recorder := httptest.NewRecorder()
+    handler.ServeHTTP(recorder, request)
+    assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestMetrics(t *testing.T) {
+    handler := Handler(&staticReporter{})
+    response := get(t, handler, "/metrics")
+    assert.Equal(t, http.StatusOK, response.Code)
+    assert.Contains(t, response.Body.String(), "replicated_license_validate_retries_total")
+}